@@ -6,6 +6,7 @@ require (
 	github.com/creack/pty v1.1.18
 	github.com/docker/docker v28.0.0+incompatible
 	github.com/gorilla/websocket v1.5.3
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
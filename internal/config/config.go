@@ -17,6 +17,15 @@ type Config struct {
 	CustomHeadHTML  string          `json:"customHeadHtml"`  // Custom HTML to inject in <head> (for fonts, etc.)
 	Sections        SectionSettings `json:"sections"`        // Which sections to show
 	SectionOrder    []string        `json:"sectionOrder"`    // Order of sections on dashboard
+	ProjectRoots    []ProjectRoot   `json:"projectRoots"`    // Directories searched for projects, besides -projects
+}
+
+// ProjectRoot is a directory searched for projects (see projects.Find)
+type ProjectRoot struct {
+	Path     string   `json:"path"`              // ~ is expanded
+	MaxDepth int      `json:"maxDepth"`          // Levels below Path to search; 0 means projects.DefaultMaxDepth
+	Include  []string `json:"include,omitempty"` // Globs a project's path relative to Path must match, e.g. "acme/**"
+	Exclude  []string `json:"exclude,omitempty"` // Globs of relative paths not to search, e.g. "archive"
 }
 
 // SectionSettings controls visibility of dashboard sections
@@ -82,6 +91,9 @@ type Manager struct {
 	dailyTasks DailyTasksData
 	tasksPath  string
 	mu         sync.RWMutex
+
+	tokenPath   string
+	actionToken string // Loaded lazily by ActionToken
 }
 
 // NewManager creates a config manager
@@ -90,6 +102,7 @@ func NewManager() *Manager {
 		config:    DefaultConfig(),
 		path:      getConfigPath(),
 		tasksPath: getDailyTasksPath(),
+		tokenPath: getActionTokenPath(),
 	}
 	m.Load()
 	m.LoadDailyTasks()
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// getActionTokenPath returns the path to the token that authorizes
+// state-changing actions (container start/stop, compose up/down, ...)
+func getActionTokenPath() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		configDir = os.Getenv("HOME")
+	}
+	return filepath.Join(configDir, "dev-machine-proxy", "action-token")
+}
+
+// ActionTokenPath returns where the action token is stored, so users can be
+// told where to find it
+func (m *Manager) ActionTokenPath() string {
+	return m.tokenPath
+}
+
+// ActionToken returns the action token, generating and saving a random one
+// (readable only by the current user) the first time
+func (m *Manager) ActionToken() (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.actionToken != "" {
+		return m.actionToken, nil
+	}
+
+	data, err := os.ReadFile(m.tokenPath)
+	if err == nil && strings.TrimSpace(string(data)) != "" {
+		m.actionToken = strings.TrimSpace(string(data))
+		return m.actionToken, nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(buf)
+
+	if err := os.MkdirAll(filepath.Dir(m.tokenPath), 0755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(m.tokenPath, []byte(token+"\n"), 0600); err != nil {
+		return "", err
+	}
+
+	m.actionToken = token
+	return token, nil
+}
@@ -0,0 +1,237 @@
+package discovery
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// Container actions accepted by ContainerAction
+const (
+	ActionStart   = "start"
+	ActionStop    = "stop"
+	ActionRestart = "restart"
+	ActionPause   = "pause"
+	ActionUnpause = "unpause"
+	ActionRemove  = "remove"
+)
+
+// Compose project actions accepted by ComposeAction
+const (
+	ComposeUp      = "up"
+	ComposeDown    = "down"
+	ComposeRestart = "restart"
+)
+
+// ErrUnknownContainer is returned for containers discovery doesn't know about
+var ErrUnknownContainer = errors.New("unknown container")
+
+// ErrUnknownStack is returned for compose projects discovery doesn't know about
+var ErrUnknownStack = errors.New("unknown compose project")
+
+// ContainerAction starts, stops, restarts, pauses, unpauses or removes a
+// container. Only containers discovery knows about are accepted: running ones
+// from the trackers and stopped members of compose stacks. The trackers pick
+// up the resulting state change from the events API.
+func (d *Discoverer) ContainerAction(ctx context.Context, ref, action string) error {
+	t, id := d.knownContainers(ctx).lookup(ref)
+	if t == nil {
+		return fmt.Errorf("%w: %s", ErrUnknownContainer, ref)
+	}
+
+	cli, err := t.newClient()
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	switch action {
+	case ActionStart:
+		err = cli.ContainerStart(ctx, id, container.StartOptions{})
+	case ActionStop:
+		err = cli.ContainerStop(ctx, id, container.StopOptions{})
+	case ActionRestart:
+		err = cli.ContainerRestart(ctx, id, container.StopOptions{})
+	case ActionPause:
+		err = cli.ContainerPause(ctx, id)
+	case ActionUnpause:
+		err = cli.ContainerUnpause(ctx, id)
+	case ActionRemove:
+		err = cli.ContainerRemove(ctx, id, container.RemoveOptions{Force: true})
+	default:
+		return fmt.Errorf("unsupported container action %q", action)
+	}
+	if err != nil {
+		return fmt.Errorf("%s %s: %w", action, ref, err)
+	}
+	return nil
+}
+
+// containerSet is the containers discovery knows about on each runtime,
+// listed once so a request naming several containers doesn't query the
+// runtimes for each
+type containerSet struct {
+	trackers []*DockerTracker
+	known    []map[string]string // Per tracker, full ID -> name
+}
+
+// knownContainers lists the known containers of every runtime
+func (d *Discoverer) knownContainers(ctx context.Context) *containerSet {
+	set := &containerSet{}
+	for _, t := range d.docker {
+		set.trackers = append(set.trackers, t)
+		set.known = append(set.known, t.knownContainers(ctx))
+	}
+	return set
+}
+
+// lookup finds the runtime that runs a container and the container's full
+// ID. ref is the container name, its full ID, or an ID prefix that no other
+// known container shares; ambiguous prefixes match nothing.
+func (s *containerSet) lookup(ref string) (*DockerTracker, string) {
+	if ref == "" {
+		return nil, ""
+	}
+
+	var found *DockerTracker
+	var foundID string
+	ambiguous := false
+	for i, t := range s.trackers {
+		for id, name := range s.known[i] {
+			if ref == id || ref == name {
+				return t, id
+			}
+			if strings.HasPrefix(id, ref) {
+				ambiguous = ambiguous || found != nil
+				found, foundID = t, id
+			}
+		}
+	}
+	if ambiguous {
+		return nil, ""
+	}
+	return found, foundID
+}
+
+// knownContainers maps the full IDs of a runtime's containers that discovery
+// knows about to their names: running ones and stopped stack members
+func (t *DockerTracker) knownContainers(ctx context.Context) map[string]string {
+	known := make(map[string]string)
+	containers, err := t.Containers()
+	if err != nil {
+		return known
+	}
+	for _, c := range containers {
+		known[c.fullID] = c.Name
+	}
+
+	stacks, _ := t.stacks(ctx)
+	for _, s := range stacks {
+		for _, c := range s.Containers {
+			known[c.fullID] = c.Name
+		}
+	}
+	return known
+}
+
+// ComposeAction runs `docker compose up -d`, `down` or `restart` for a known
+// compose project, with the working directory and compose files recorded on
+// its containers and against the runtime that runs it. host is the runtime
+// endpoint (Stack.Host); it may be empty when only one runtime has the
+// project. Output lines are copied to out as they arrive so callers can show
+// progress.
+func (d *Discoverer) ComposeAction(ctx context.Context, host, project, action string, out io.Writer) error {
+	var args []string
+	switch action {
+	case ComposeUp:
+		args = []string{"up", "-d"}
+	case ComposeDown:
+		args = []string{"down"}
+	case ComposeRestart:
+		args = []string{"restart"}
+	default:
+		return fmt.Errorf("unsupported compose action %q", action)
+	}
+
+	stack, err := d.findStack(ctx, host, project)
+	if err != nil {
+		return err
+	}
+	if stack.WorkingDir == "" {
+		return fmt.Errorf("compose project %s has no working_dir label", project)
+	}
+
+	cmd := exec.CommandContext(ctx, "docker", append(composeArgs(stack), args...)...)
+	cmd.Dir = stack.WorkingDir
+	cmd.Env = append(os.Environ(), "DOCKER_HOST="+stack.Host)
+
+	// Compose writes progress to stderr; interleave both streams
+	pr, pw := io.Pipe()
+	cmd.Stdout = pw
+	cmd.Stderr = pw
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("running docker compose: %w", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		scanner := bufio.NewScanner(pr)
+		for scanner.Scan() {
+			fmt.Fprintln(out, scanner.Text())
+		}
+		io.Copy(io.Discard, pr) // Keep compose from blocking on an overlong line
+	}()
+
+	err = cmd.Wait()
+	pw.Close()
+	<-done
+
+	if err != nil {
+		return fmt.Errorf("docker compose %s: %w", strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+// findStack finds a compose project by name on the runtime at host, or on
+// any runtime when host is empty, as long as only one has the project
+func (d *Discoverer) findStack(ctx context.Context, host, project string) (*Stack, error) {
+	stacks, _ := d.Stacks(ctx)
+	var stack *Stack
+	for i := range stacks {
+		if stacks[i].Name != project || (host != "" && stacks[i].Host != host) {
+			continue
+		}
+		if stack != nil {
+			return nil, fmt.Errorf("compose project %s runs on %s and %s; choose one", project, stack.Host, stacks[i].Host)
+		}
+		stack = &stacks[i]
+	}
+	if stack == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownStack, project)
+	}
+	return stack, nil
+}
+
+// composeArgs are the arguments that select a stack's project: its name and
+// the compose files it was started from, so overrides and files given with
+// -f are used again. Relative paths are relative to the working directory.
+func composeArgs(stack *Stack) []string {
+	args := []string{"compose", "--project-name", stack.Name}
+	for _, file := range stack.ConfigFiles {
+		if !filepath.IsAbs(file) && stack.WorkingDir != "" {
+			file = filepath.Join(stack.WorkingDir, file)
+		}
+		args = append(args, "-f", file)
+	}
+	return args
+}
@@ -0,0 +1,93 @@
+package discovery
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestComposeArgs(t *testing.T) {
+	tests := []struct {
+		name  string
+		stack Stack
+		want  []string
+	}{
+		{
+			name:  "no config files label",
+			stack: Stack{Name: "shop", WorkingDir: "/src/shop"},
+			want:  []string{"compose", "--project-name", "shop"},
+		},
+		{
+			name: "base and override",
+			stack: Stack{Name: "shop", WorkingDir: "/src/shop", ConfigFiles: splitConfigFiles(
+				"/src/shop/compose.yml,/src/shop/compose.override.yml")},
+			want: []string{"compose", "--project-name", "shop", "-f", "/src/shop/compose.yml", "-f", "/src/shop/compose.override.yml"},
+		},
+		{
+			name:  "relative files and spaces",
+			stack: Stack{Name: "shop", WorkingDir: "/src/shop", ConfigFiles: splitConfigFiles(" compose.yml , deploy/dev.yml,")},
+			want:  []string{"compose", "--project-name", "shop", "-f", "/src/shop/compose.yml", "-f", "/src/shop/deploy/dev.yml"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := composeArgs(&tt.stack); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("composeArgs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKnownContainersLookup(t *testing.T) {
+	web := fakeContainer("a", "web", 8080)
+	web.ID = "abc1" + strings.Repeat("0", 60)
+	api := fakeContainer("b", "api", 9090)
+	api.ID = "abd2" + strings.Repeat("0", 60)
+	fake, rt := startFakeDocker(t, web, api)
+
+	changes := make(chan []int, 4)
+	tracker := NewDockerTracker(rt, func(ports []int) { changes <- ports })
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	tracker.Start(ctx)
+	select {
+	case <-changes:
+	case <-time.After(5 * time.Second):
+		t.Fatal("tracker never listed containers")
+	}
+	d := &Discoverer{docker: []*DockerTracker{tracker}}
+	known := d.knownContainers(ctx)
+
+	tests := []struct {
+		ref  string
+		want string // Full ID, or "" for no match
+	}{
+		{"web", web.ID},
+		{web.ID, web.ID},
+		{"abc", web.ID},
+		{"abd2", api.ID},
+		{"ab", ""},         // Ambiguous
+		{web.ID + "0", ""}, // Longer than any ID
+		{"abc1" + "00000000", web.ID},
+		{"db", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			got, id := known.lookup(tt.ref)
+			if id != tt.want || (got != nil) != (tt.want != "") {
+				t.Errorf("lookup(%q) = %v, %q, want %q", tt.ref, got != nil, id, tt.want)
+			}
+		})
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if fake.stackLists != 1 {
+		t.Errorf("listed stacks %d times for %d lookups, want once", fake.stackLists, len(tests))
+	}
+}
@@ -0,0 +1,101 @@
+package discovery
+
+import "net"
+
+// Exposure classifies which interfaces a service's sockets are bound to
+const (
+	ExposureLoopback  = "loopback"  // Only 127.0.0.0/8 or ::1 - unreachable from other machines
+	ExposureAll       = "all"       // Wildcard bind (0.0.0.0 or ::)
+	ExposureInterface = "interface" // Bound to one or more specific non-loopback addresses
+	ExposureInternal  = "internal"  // Container port not published on the host; only on its networks
+)
+
+// ClassifyBind returns the exposure for a set of bind addresses. A wildcard
+// bind wins over everything else; loopback-only means every address is loopback.
+func ClassifyBind(addrs []string) string {
+	if len(addrs) == 0 {
+		return ""
+	}
+
+	loopbackOnly := true
+	for _, addr := range addrs {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			continue
+		}
+		if ip.IsUnspecified() {
+			return ExposureAll
+		}
+		if !ip.IsLoopback() {
+			loopbackOnly = false
+		}
+	}
+
+	if loopbackOnly {
+		return ExposureLoopback
+	}
+	return ExposureInterface
+}
+
+// DialHost picks the address to reach a service bound to addrs: IPv4
+// loopback when it accepts IPv4 connections from this machine, then IPv6
+// loopback, then the first interface address it is bound to
+func DialHost(addrs []string) string {
+	v6Loopback := false
+	var iface string
+	for _, addr := range addrs {
+		ip := net.ParseIP(addr)
+		switch {
+		case ip == nil:
+			continue
+		case ip.To4() != nil && ip.IsUnspecified():
+			return "127.0.0.1"
+		case ip.To4() != nil && ip.IsLoopback():
+			return ip.String() // Bound to that loopback address only, e.g. 127.0.0.2
+		case ip.IsUnspecified() || ip.IsLoopback():
+			v6Loopback = true
+		case iface == "":
+			iface = ip.String()
+		}
+	}
+
+	switch {
+	case v6Loopback:
+		return "::1"
+	case iface != "":
+		return iface
+	default:
+		return "127.0.0.1" // Bind addresses unknown
+	}
+}
+
+// ReachableFrom reports whether a client connecting to localIP (the address
+// a request arrived on) can reach a service bound to addrs.
+func ReachableFrom(addrs []string, localIP net.IP) bool {
+	if localIP == nil {
+		return false
+	}
+	localIsV4 := localIP.To4() != nil
+
+	for _, addr := range addrs {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			continue
+		}
+
+		switch {
+		case ip.Equal(net.IPv6unspecified):
+			// :: is dual-stack unless net.ipv6.bindv6only is set
+			return true
+		case ip.IsUnspecified():
+			// 0.0.0.0 only accepts IPv4
+			if localIsV4 {
+				return true
+			}
+		case ip.Equal(localIP):
+			return true
+		}
+	}
+
+	return false
+}
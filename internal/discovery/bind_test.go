@@ -0,0 +1,27 @@
+package discovery
+
+import "testing"
+
+func TestDialHost(t *testing.T) {
+	tests := []struct {
+		addrs []string
+		want  string
+	}{
+		{nil, "127.0.0.1"},
+		{[]string{"0.0.0.0"}, "127.0.0.1"},
+		{[]string{"127.0.0.2"}, "127.0.0.2"},
+		{[]string{"::"}, "::1"},
+		{[]string{"::1"}, "::1"},
+		{[]string{"::1", "127.0.0.1"}, "127.0.0.1"},
+		{[]string{"192.168.1.20"}, "192.168.1.20"},
+		{[]string{"192.168.1.20", "::1"}, "::1"},
+		{[]string{"172.18.0.3", "10.0.0.4"}, "172.18.0.3"}, // Container networks
+		{[]string{"not-an-ip"}, "127.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		if got := DialHost(tt.addrs); got != tt.want {
+			t.Errorf("DialHost(%q) = %q, want %q", tt.addrs, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// internalDialTimeout bounds the check for whether the host can route to a
+// container network. Rootless runtimes keep containers in a separate network
+// namespace, so their addresses usually aren't reachable from here.
+const internalDialTimeout = 300 * time.Millisecond
+
+// internalProbe is what probing an internal container port found
+type internalProbe struct {
+	Addr        string // Container address that answered; empty when none could be reached
+	HTTP        HTTPProbeResult
+	Fingerprint Fingerprint
+}
+
+// internalServices builds services for container ports that aren't published
+// on the host (databases and sidecars on compose networks). They can't come
+// from /proc, so they skip the port pipeline and are named from the runtime
+// API alone. Probe results are cached per container and port.
+func (d *Discoverer) internalServices(ctx context.Context) []Service {
+	var services []Service
+	var keys []probeKey
+	for _, t := range d.docker {
+		containers, err := t.Containers()
+		if err != nil {
+			continue // Already reported by the docker enricher
+		}
+		for i := range containers {
+			c := &containers[i]
+			for _, p := range c.Internal {
+				services = append(services, internalService(c, p))
+				keys = append(keys, probeKey{port: p.ContainerPort, container: c.ID})
+			}
+		}
+	}
+
+	live := make(map[probeKey]bool, len(keys))
+	for _, key := range keys {
+		live[key] = true
+	}
+	d.internalProbes.pruneInternal(live)
+
+	forEachConcurrently(ctx, len(services), probeWorkers, func(i int) {
+		svc, key := &services[i], keys[i]
+		if svc.Protocol != "tcp" {
+			return
+		}
+		probe, ok := d.internalProbes.getInternal(key.container, key.port)
+		if !ok {
+			probe = probeInternal(ctx, svc, d.icons)
+			if ctx.Err() != nil {
+				return // Cut short by the deadline; don't cache a false negative
+			}
+			d.internalProbes.putInternal(key.container, key.port, probe)
+		}
+		applyInternalProbe(svc, probe, d.icons)
+	})
+	return services
+}
+
+func internalService(c *DockerContainer, p ContainerPort) Service {
+	family := RuntimeDocker
+	if c.Runtime == RuntimePodman {
+		family = RuntimePodman
+	}
+
+	name, reason := GuessServiceFromContainer(c)
+	svc := Service{
+		Port:           p.ContainerPort,
+		Protocol:       p.Protocol,
+		Name:           name,
+		Source:         family,
+		Runtime:        c.Runtime,
+		RuntimeHost:    c.Host,
+		Container:      c.Name,
+		Image:          c.Image,
+		ContainerPort:  p.ContainerPort,
+		ContainerState: c.State,
+		Networks:       c.Networks,
+		ComposeProject: c.Labels[labelComposeProject],
+		ComposeService: c.Labels[labelComposeService],
+		Exposure:       ExposureInternal,
+		Tags:           []string{family, "internal"},
+		Provenance: map[Field]Provenance{
+			FieldName: {Source: "docker", Priority: PriorityDocker, Confidence: 1, Reason: reason},
+		},
+	}
+
+	var networks []string
+	for _, n := range c.Networks {
+		if n.IP == "" {
+			continue
+		}
+		svc.BindAddresses = append(svc.BindAddresses, n.IP)
+		networks = append(networks, n.Name)
+	}
+	if len(networks) > 0 {
+		svc.Description = fmt.Sprintf("Not published; listening on %s", strings.Join(networks, ", "))
+	}
+
+	if projectDir, ok := c.Labels[labelComposeWorkingDir]; ok {
+		svc.ProjectPath = projectDir
+		svc.ProjectSource = ProjectSourceCompose
+		svc.Provenance[FieldProject] = Provenance{Source: "docker", Priority: PriorityDocker, Confidence: 1, Reason: ProjectSourceCompose}
+		svc.Tags = append(svc.Tags, "project")
+	}
+
+	return svc
+}
+
+// probeInternal looks for a container address of an internal service the
+// host can route to, and checks whether it speaks HTTP there or else
+// fingerprints its protocol. An icon is fetched when none is on disk yet.
+func probeInternal(ctx context.Context, svc *Service, icons *iconStore) internalProbe {
+	dialer := net.Dialer{Timeout: internalDialTimeout}
+	for _, ip := range svc.BindAddresses {
+		addr := net.JoinHostPort(ip, strconv.Itoa(svc.Port))
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			continue
+		}
+		conn.Close()
+
+		probe := internalProbe{Addr: addr, HTTP: ProbeHTTPContext(ctx, ip, svc.Port)}
+		if !probe.HTTP.IsHTTP {
+			probe.Fingerprint = FingerprintPort(ctx, ip, svc.Port)
+			return probe
+		}
+
+		id := ServiceID(*svc)
+		if _, err := icons.get(id); err != nil {
+			if icon, ok := FetchIcon(ctx, probe.HTTP); ok {
+				icons.save(id, icon)
+			}
+		}
+		return probe
+	}
+	return internalProbe{}
+}
+
+// applyInternalProbe gives an internal service a URL when it speaks HTTP on a
+// reachable container address, and otherwise its fingerprinted protocol
+func applyInternalProbe(svc *Service, probe internalProbe, icons *iconStore) {
+	if probe.Addr == "" {
+		return
+	}
+	if !probe.HTTP.IsHTTP {
+		if fp := probe.Fingerprint; fp.Protocol != "" {
+			svc.AppProtocol = fp.Protocol
+			svc.Version = fp.Version
+			svc.Tags = append(svc.Tags, fp.Protocol)
+		}
+		return
+	}
+
+	scheme := "http"
+	if probe.HTTP.IsHTTPS {
+		scheme = "https"
+	}
+	svc.IsHTTP = true
+	svc.URL = fmt.Sprintf("%s://%s", scheme, probe.Addr)
+	svc.Provenance[FieldURL] = Provenance{Source: "docker", Priority: PriorityProbe, Confidence: 1, Reason: scheme + " probe of the container address succeeded"}
+	svc.Tags = append(svc.Tags, "http")
+
+	id := ServiceID(*svc)
+	if icon, err := icons.get(id); err == nil {
+		svc.Icon = iconPath(id, icon.Hash)
+		svc.Provenance[FieldIcon] = Provenance{Source: "docker", Priority: PriorityProbe, Confidence: 0.5, Reason: "icon at " + icon.Source}
+	}
+}
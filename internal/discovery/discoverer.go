@@ -1,172 +1,366 @@
 package discovery
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"sort"
 	"sync"
+	"time"
+
+	"dev-machine-proxy/internal/projects"
 )
 
 // Discoverer orchestrates service discovery from multiple sources
 type Discoverer struct {
-	projectsDir string
-	services    []Service
-	mu          sync.RWMutex
+	projects       *projects.Finder
+	raw            []Service // Last run's services before overrides
+	services       []Service // raw with overrides applied
+	discovered     bool      // Whether services holds a completed run (vs. startup empty state)
+	events         *broadcaster
+	docker         []*DockerTracker // One per detected container runtime
+	rules          *RuleSet
+	overrides      *overrideStore
+	icons          *iconStore
+	history        *historyStore
+	stats          *runStats
+	refresher      *refreshBatcher // Batches container events into RefreshPorts calls
+	internalProbes *probeCache[internalProbe]
+	mu             sync.RWMutex
+
+	sources   []Source
+	enrichers []Enricher
+	runMu     sync.Mutex // Serializes runs; enrichers keep per-run state
+
+	flightMu sync.Mutex
+	flight   *discoverFlight // The Discover run in progress, if any
 }
 
-// New creates a new Discoverer
-func New(projectsDir string) *Discoverer {
-	return &Discoverer{
-		projectsDir: projectsDir,
+// discoverFlight is a Discover run that concurrent callers share
+type discoverFlight struct {
+	done     chan struct{} // Closed when the run is over
+	cancel   context.CancelFunc
+	services []Service
+	err      error
+}
+
+// New creates a new Discoverer with the built-in sources and enrichers.
+// Project-based discovery uses the projects finder finds.
+func New(finder *projects.Finder) *Discoverer {
+	d := &Discoverer{
+		projects:       finder,
+		events:         newBroadcaster(),
+		sources:        []Source{procSource{}},
+		rules:          NewRuleSet(getRulesPath()),
+		overrides:      newOverrideStore(getOverridesPath()),
+		icons:          newIconStore(getIconsDir()),
+		history:        newHistoryStore(getHistoryPath()),
+		stats:          newRunStats(),
+		internalProbes: newProbeCache(func(p internalProbe) bool { return !p.HTTP.IsHTTP && p.Fingerprint.Protocol == "" }),
+	}
+	d.refresher = newRefreshBatcher(d.RefreshPorts, refreshDelay, refreshMaxDelay)
+	for _, rt := range DetectRuntimes() {
+		d.docker = append(d.docker, NewDockerTracker(rt, d.refresher.add))
 	}
+	d.enrichers = defaultEnrichers(d.docker, d.rules, d.icons)
+	return d
 }
 
-// Discover runs all discovery mechanisms and returns discovered services
-func (d *Discoverer) Discover() ([]Service, error) {
-	var allErrors []error
+// Rules returns the fingerprint rules used to name services
+func (d *Discoverer) Rules() *RuleSet {
+	return d.rules
+}
 
-	// Step 1: Get all listening ports
-	log.Println("  Scanning listening ports...")
-	listeningPorts, err := GetListeningPorts()
-	if err != nil {
-		allErrors = append(allErrors, fmt.Errorf("port scan: %w", err))
-	}
-	log.Printf("  Found %d listening ports", len(listeningPorts))
-
-	// Step 2: Get Docker containers
-	log.Println("  Querying Docker...")
-	containers, err := GetDockerContainers()
-	if err != nil {
-		log.Printf("  Docker not available: %v", err)
-		// Not fatal - Docker might not be running
-	} else {
-		log.Printf("  Found %d containers with exposed ports", len(containers))
-	}
-
-	// Step 3: Scan projects directory
-	var projectMatches []ProjectMatch
-	if d.projectsDir != "" {
-		log.Printf("  Scanning projects in %s...", d.projectsDir)
-		ports := make([]int, len(listeningPorts))
-		for i, p := range listeningPorts {
-			ports[i] = p.Port
-		}
-		projectMatches, err = ScanProjectsForPorts(d.projectsDir, ports)
-		if err != nil {
-			log.Printf("  Project scan error: %v", err)
-		} else {
-			log.Printf("  Found %d project/port matches", len(projectMatches))
-		}
+// WatchDocker starts tracking containers through the Docker events API of
+// every detected runtime (Docker, rootless Docker, Podman). Container starts
+// and stops trigger a targeted refresh of their ports instead of waiting for
+// the next full Discover; events arriving close together share one refresh.
+func (d *Discoverer) WatchDocker(ctx context.Context) {
+	for _, t := range d.docker {
+		t.Start(ctx)
 	}
+}
 
-	// Step 4: Build service list
-	services := make([]Service, 0, len(listeningPorts))
+// DefaultDiscoverTimeout is a sensible overall deadline for one Discover run
+const DefaultDiscoverTimeout = 20 * time.Second
 
-	for _, lp := range listeningPorts {
-		svc := Service{
-			Port:     lp.Port,
-			Protocol: "tcp",
-			Process:  lp.Process,
-			Source:   "port-scan",
+// refreshTimeout bounds a targeted refresh triggered by a container event
+const refreshTimeout = 10 * time.Second
+
+// ErrDiscoverCancelled is returned by runs stopped with CancelDiscover
+var ErrDiscoverCancelled = errors.New("discovery cancelled")
+
+// Discover runs all discovery mechanisms and returns discovered services.
+// Runs are single-flight: when one is already in progress, Discover waits for
+// it (or for ctx) and returns its result instead of starting another. The run
+// is bound to the ctx of the caller that started it; when ctx expires, probes
+// still in flight are abandoned and the services are built from whatever was
+// learned so far.
+func (d *Discoverer) Discover(ctx context.Context) ([]Service, error) {
+	d.flightMu.Lock()
+	if f := d.flight; f != nil {
+		d.flightMu.Unlock()
+		select {
+		case <-f.done:
+			return f.services, f.err
+		case <-ctx.Done():
+			return d.GetServices(), ctx.Err()
 		}
+	}
+	runCtx, cancel := context.WithCancel(ctx)
+	f := &discoverFlight{done: make(chan struct{}), cancel: cancel}
+	d.flight = f
+	d.flightMu.Unlock()
 
-		var dockerName string
+	f.services, f.err = d.discover(runCtx)
+	cancel()
 
-		// Check if this port belongs to a Docker container (highest priority for naming)
-		if container := GetContainerByPort(containers, lp.Port); container != nil {
-			svc.Source = "docker"
-			svc.Container = container.Name
-			svc.Image = container.Image
-			dockerName = GuessServiceFromContainer(container)
-			svc.Tags = append(svc.Tags, "docker")
+	d.flightMu.Lock()
+	d.flight = nil
+	d.flightMu.Unlock()
+	close(f.done)
+	return f.services, f.err
+}
 
-			// For Docker containers, check if there's a compose project directory
-			if projectDir, ok := container.Labels["com.docker.compose.project.working_dir"]; ok {
-				svc.ProjectPath = projectDir
-				svc.Tags = append(svc.Tags, "project")
-			}
+// CancelDiscover stops the Discover run in progress, keeping the services of
+// the last completed one. It reports whether there was a run to cancel.
+func (d *Discoverer) CancelDiscover() bool {
+	d.flightMu.Lock()
+	defer d.flightMu.Unlock()
+	if d.flight == nil {
+		return false
+	}
+	d.flight.cancel()
+	return true
+}
+
+func (d *Discoverer) discover(ctx context.Context) (services []Service, err error) {
+	d.runMu.Lock()
+	defer d.runMu.Unlock()
+
+	start := time.Now()
+	d.stats.started(start)
+	timer := newStepTimer(start)
+	defer func() { d.stats.finished(time.Since(start), timer.steps, err) }()
+
+	// Step 1: Collect listening ports from every source
+	run, allErrors := d.collectPorts()
+	log.Printf("  Found %d listening ports", len(run.Ports))
+	timer.done("ports")
+
+	// Step 2: Let enrichers gather what they need (Docker, project scans, ...)
+	for _, e := range d.enrichers {
+		if errors.Is(ctx.Err(), context.Canceled) {
+			break
 		}
+		if err := e.Prepare(run); err != nil {
+			log.Printf("  %s: %v", e.Name(), err)
+			d.stats.failed(e.Name())
+		}
+		timer.done("prepare:" + e.Name())
+	}
 
-		// Only check project folder matches for non-Docker services
-		if svc.Source != "docker" {
-			if match := FindProjectForPort(projectMatches, lp.Port); match != nil {
-				svc.ProjectPath = match.ProjectPath
-				if svc.Name == "" {
-					svc.Name = match.ProjectName
-				}
-				svc.Description = fmt.Sprintf("Found in %s: %s", match.File, truncate(match.Context, 60))
-				svc.Tags = append(svc.Tags, "project")
-			}
+	// Step 3: Build each service from the enrichers' contributions
+	services = d.buildServices(ctx, run, run.Ports)
+	timer.done("build")
+
+	// Step 4: Add container ports that aren't published on the host
+	services = append(services, d.internalServices(ctx)...)
+	sortServices(services)
+	timer.done("internal")
+
+	// A cancelled run is incomplete by request, so the last one's services stay
+	if errors.Is(ctx.Err(), context.Canceled) {
+		log.Printf("  Discovery cancelled after %v", time.Since(start).Round(time.Millisecond))
+		return d.GetServices(), ErrDiscoverCancelled
+	}
+	d.store(services)
+	timer.done("store")
+
+	if err := ctx.Err(); err != nil {
+		allErrors = append(allErrors, fmt.Errorf("discovery cut short: %w", err))
+		d.stats.failed("deadline")
+	}
+
+	if len(allErrors) > 0 {
+		return services, fmt.Errorf("discovery completed with errors: %v", allErrors)
+	}
+
+	return services, nil
+}
+
+// RefreshPorts re-discovers only the given host ports, keeping every other
+// service from the last run. Internal container ports are always rebuilt.
+// Enrichers are not re-prepared, so project scan results are reused from the
+// last full Discover.
+func (d *Discoverer) RefreshPorts(ports []int) {
+	d.runMu.Lock()
+	defer d.runMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), refreshTimeout)
+	defer cancel()
+
+	affected := make(map[int]bool, len(ports))
+	for _, p := range ports {
+		affected[p] = true
+	}
+
+	run, errs := d.collectPorts()
+	if len(errs) > 0 {
+		log.Printf("Targeted refresh of ports %v had errors: %v", ports, errs)
+	}
+
+	var targets []ListeningPort
+	for _, lp := range run.Ports {
+		if affected[lp.Port] {
+			targets = append(targets, lp)
 		}
+	}
+	refreshed := d.buildServices(ctx, run, targets)
 
-		// Apply known port names (only if we don't have a better name)
-		if knownName, ok := KnownPorts[lp.Port]; ok {
-			if svc.Name == "" && dockerName == "" {
-				svc.Name = knownName
-			}
-			svc.Tags = append(svc.Tags, "known-port")
+	// Merge: drop the old entries for affected ports, add whatever is listening now
+	d.mu.RLock()
+	previous := d.raw
+	d.mu.RUnlock()
+
+	services := make([]Service, 0, len(refreshed))
+	for _, svc := range previous {
+		if !affected[svc.Port] && svc.Exposure != ExposureInternal {
+			services = append(services, svc)
 		}
+	}
+	services = append(services, refreshed...)
+	services = append(services, d.internalServices(ctx)...)
+	sortServices(services)
+
+	d.store(services)
+}
+
+// collectPorts gathers listening ports from every source, merging duplicates
+// by protocol and port (first source wins)
+func (d *Discoverer) collectPorts() (*Run, []error) {
+	var allErrors []error
+	run := &Run{Projects: d.projects.Find()}
 
-		// HTTP probe for likely HTTP ports or unknown services
-		if HTTPPorts[lp.Port] || svc.Name == "" {
-			probe := ProbeHTTP(lp.Port)
-			if probe.IsHTTP {
-				svc.IsHTTP = true
-				scheme := "http"
-				if probe.IsHTTPS {
-					scheme = "https"
-				}
-				svc.URL = fmt.Sprintf("%s://localhost:%d", scheme, lp.Port)
-
-				// Only use probe name if we don't have a Docker-derived name
-				// (Docker image/container name is more accurate than HTTP server header)
-				if dockerName == "" {
-					if probeName := GuessServiceFromProbe(probe, lp.Port); probeName != "" {
-						svc.Name = probeName
-					}
-				}
-
-				if probe.Server != "" && svc.Description == "" {
-					svc.Description = fmt.Sprintf("Server: %s", probe.Server)
-				}
-
-				svc.Tags = append(svc.Tags, "http")
+	seen := make(map[string]bool)
+	for _, src := range d.sources {
+		ports, err := src.Ports(run)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Errorf("%s: %w", src.Name(), err))
+			d.stats.failed(src.Name())
+		}
+		for _, p := range ports {
+			key := fmt.Sprintf("%s/%d", p.Protocol, p.Port)
+			if !seen[key] {
+				run.Ports = append(run.Ports, p)
+				seen[key] = true
 			}
 		}
+	}
 
-		// Apply Docker name (highest priority - do this late so it wins)
-		if dockerName != "" {
-			svc.Name = dockerName
-		}
+	return run, allErrors
+}
 
-		// If we still don't have a name, use the process name
-		if svc.Name == "" && svc.Process != "" {
-			svc.Name = svc.Process
+// buildServices runs the enrichers over ports and resolves each into a
+// Service. Each enricher sees every candidate before the next one runs, which
+// lets batch enrichers work on all of them at once.
+func (d *Discoverer) buildServices(ctx context.Context, run *Run, ports []ListeningPort) []Service {
+	candidates := make([]*Candidate, len(ports))
+	for i, lp := range ports {
+		c := newCandidate(lp)
+		c.Service = Service{
+			Port:          lp.Port,
+			Protocol:      lp.Protocol,
+			Process:       lp.Process,
+			PID:           lp.PID,
+			Command:       commandLine(lp.Cmdline),
+			User:          lp.User,
+			BindAddresses: lp.BindAddresses,
+			Exposure:      ClassifyBind(lp.BindAddresses),
+			Source:        "port-scan",
 		}
+		candidates[i] = c
+	}
 
-		// Last resort: just use the port
-		if svc.Name == "" {
-			svc.Name = fmt.Sprintf("Port %d", lp.Port)
+	for _, e := range d.enrichers {
+		for _, c := range candidates {
+			c.source = e.Name()
 		}
+		if batch, ok := e.(BatchEnricher); ok {
+			batch.EnrichAll(ctx, run, candidates)
+			continue
+		}
+		for _, c := range candidates {
+			e.Enrich(run, c)
+		}
+	}
 
-		services = append(services, svc)
+	services := make([]Service, len(candidates))
+	for i, c := range candidates {
+		services[i] = c.resolve()
 	}
 
-	// Sort by port number
-	sort.Slice(services, func(i, j int) bool {
-		return services[i].Port < services[j].Port
-	})
+	sortServices(services)
+	return services
+}
+
+// store saves a run's results, applies the overrides and publishes what
+// changed since the last run
+func (d *Discoverer) store(raw []Service) {
+	for i := range raw {
+		raw[i].ID = ServiceID(raw[i])
+	}
 
-	// Store results
 	d.mu.Lock()
-	d.services = services
+	prev, hadPrev := d.services, d.discovered
+	d.raw = raw
+	d.services = d.overrides.apply(raw)
+	d.discovered = true
+	current := d.services
 	d.mu.Unlock()
 
-	if len(allErrors) > 0 {
-		return services, fmt.Errorf("discovery completed with errors: %v", allErrors)
+	d.history.record(current, time.Now())
+
+	if hadPrev {
+		d.publishChanges(prev, current)
 	}
+}
 
-	return services, nil
+// reapplyOverrides recomputes the services after the overrides changed,
+// without waiting for the next run
+func (d *Discoverer) reapplyOverrides() {
+	d.mu.Lock()
+	prev := d.services
+	d.services = d.overrides.apply(d.raw)
+	current := d.services
+	d.mu.Unlock()
+
+	d.publishChanges(prev, current)
+}
+
+func (d *Discoverer) publishChanges(prev, current []Service) {
+	if changes := DiffServices(prev, current); len(changes) > 0 {
+		d.events.publish(ChangeEvent{Timestamp: time.Now(), Changes: changes})
+	}
+}
+
+// sortServices orders by port number, TCP before UDP on the same port, then
+// host ports before internal container ports
+func sortServices(services []Service) {
+	sort.Slice(services, func(i, j int) bool {
+		a, b := services[i], services[j]
+		if a.Port != b.Port {
+			return a.Port < b.Port
+		}
+		if a.Protocol != b.Protocol {
+			return a.Protocol < b.Protocol
+		}
+		if (a.Exposure == ExposureInternal) != (b.Exposure == ExposureInternal) {
+			return b.Exposure == ExposureInternal
+		}
+		return a.Container < b.Container
+	})
 }
 
 // GetServices returns the last discovered services
@@ -180,9 +374,15 @@ func (d *Discoverer) GetServices() []Service {
 	return result
 }
 
-func truncate(s string, maxLen int) string {
-	if len(s) <= maxLen {
-		return s
+// ServiceByID returns the last discovered service with the given ID
+func (d *Discoverer) ServiceByID(id string) (Service, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	for _, svc := range d.services {
+		if svc.ID == id {
+			return svc, true
+		}
 	}
-	return s[:maxLen-3] + "..."
+	return Service{}, false
 }
@@ -0,0 +1,125 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"dev-machine-proxy/internal/config"
+	"dev-machine-proxy/internal/projects"
+)
+
+// gatedSource reports ports, but only once release is sent to
+type gatedSource struct {
+	calls   atomic.Int32
+	started chan struct{}
+	release chan []ListeningPort
+}
+
+func (s *gatedSource) Name() string { return "gated" }
+
+func (s *gatedSource) Ports(run *Run) ([]ListeningPort, error) {
+	s.calls.Add(1)
+	s.started <- struct{}{}
+	return <-s.release, nil
+}
+
+// newGatedDiscoverer returns a Discoverer whose only source is src, with no
+// enrichers and no container runtimes
+func newGatedDiscoverer(t *testing.T) (*Discoverer, *gatedSource) {
+	t.Helper()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	d := New(projects.NewFinder(func() []config.ProjectRoot { return nil }))
+	src := &gatedSource{started: make(chan struct{}, 4), release: make(chan []ListeningPort)}
+	d.sources, d.enrichers, d.docker = []Source{src}, nil, nil
+	return d, src
+}
+
+func servicePorts(services []Service) []int {
+	var result []int
+	for _, svc := range services {
+		result = append(result, svc.Port)
+	}
+	return result
+}
+
+func TestDiscoverSingleFlight(t *testing.T) {
+	d, src := newGatedDiscoverer(t)
+
+	type outcome struct {
+		services []Service
+		err      error
+	}
+	results := make(chan outcome, 2)
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			services, err := d.Discover(context.Background())
+			results <- outcome{services, err}
+		}()
+	}
+	<-src.started
+	time.Sleep(50 * time.Millisecond) // Let the second caller join the run
+
+	// A caller that gives up returns what's known so far without stopping the run
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if services, err := d.Discover(ctx); !errors.Is(err, context.DeadlineExceeded) || len(services) != 0 {
+		t.Errorf("Discover() with an expiring ctx = %v, %v; want no services, DeadlineExceeded", servicePorts(services), err)
+	}
+
+	src.release <- []ListeningPort{{Port: 3000, Protocol: "tcp"}}
+	wg.Wait()
+	close(results)
+	for r := range results {
+		if r.err != nil || len(r.services) != 1 || r.services[0].Port != 3000 {
+			t.Errorf("Discover() = %v, %v; want [3000]", servicePorts(r.services), r.err)
+		}
+	}
+	if n := src.calls.Load(); n != 1 {
+		t.Errorf("concurrent Discover calls ran %d times, want once", n)
+	}
+}
+
+func TestCancelDiscover(t *testing.T) {
+	d, src := newGatedDiscoverer(t)
+	if d.CancelDiscover() {
+		t.Error("CancelDiscover() without a run = true")
+	}
+
+	go func() {
+		<-src.started
+		src.release <- []ListeningPort{{Port: 3000, Protocol: "tcp"}}
+	}()
+	if _, err := d.Discover(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	var services []Service
+	go func() {
+		var err error
+		services, err = d.Discover(context.Background())
+		done <- err
+	}()
+	<-src.started
+	if !d.CancelDiscover() {
+		t.Error("CancelDiscover() during a run = false")
+	}
+	src.release <- []ListeningPort{{Port: 4000, Protocol: "tcp"}}
+
+	if err := <-done; !errors.Is(err, ErrDiscoverCancelled) {
+		t.Errorf("cancelled Discover() error = %v, want ErrDiscoverCancelled", err)
+	}
+	if got := servicePorts(services); len(got) != 1 || got[0] != 3000 {
+		t.Errorf("cancelled Discover() = %v, want the previous run's [3000]", got)
+	}
+	if got := servicePorts(d.GetServices()); len(got) != 1 || got[0] != 3000 {
+		t.Errorf("GetServices() after a cancelled run = %v, want [3000]", got)
+	}
+}
@@ -3,19 +3,37 @@ package discovery
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/client"
 )
 
+// Labels Docker Compose (and podman-compose) set on the containers it creates
+const (
+	labelComposeProject     = "com.docker.compose.project"
+	labelComposeService     = "com.docker.compose.service"
+	labelComposeWorkingDir  = "com.docker.compose.project.working_dir"
+	labelComposeConfigFiles = "com.docker.compose.project.config_files"
+)
+
 // DockerContainer represents a running Docker container with exposed ports
 type DockerContainer struct {
-	ID     string
-	Name   string
-	Image  string
-	Ports  []ContainerPort
-	Labels map[string]string
+	ID       string
+	Name     string
+	Image    string
+	Runtime  string          // docker, docker-rootless, podman (see Runtime* constants)
+	Host     string          // Endpoint of the runtime, see Runtime.Host
+	State    string          // running, paused, ...
+	Status   string          // Human-readable status, e.g. "Up 5 minutes (healthy)"
+	Ports    []ContainerPort // Published on the host
+	Internal []ContainerPort // Exposed but not published; HostPort is 0
+	Networks []ContainerNetwork
+	Labels   map[string]string
+
+	fullID string // ID is shortened to 12 characters for display
 }
 
 // ContainerPort maps a container port to a host port
@@ -25,41 +43,23 @@ type ContainerPort struct {
 	Protocol      string
 }
 
-// GetDockerContainers lists all running containers and their port mappings
-func GetDockerContainers() ([]DockerContainer, error) {
-	ctx := context.Background()
-
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
-	if err != nil {
-		return nil, fmt.Errorf("creating docker client: %w", err)
-	}
-	defer cli.Close()
+// ContainerNetwork is a network a container is attached to and its address on it
+type ContainerNetwork struct {
+	Name string `json:"name"`
+	IP   string `json:"ip"`
+}
 
-	containers, err := cli.ContainerList(ctx, container.ListOptions{})
+// listContainers lists running containers matching args and their port mappings
+func listContainers(ctx context.Context, cli *client.Client, args filters.Args) ([]DockerContainer, error) {
+	containers, err := cli.ContainerList(ctx, container.ListOptions{Filters: args})
 	if err != nil {
 		return nil, fmt.Errorf("listing containers: %w", err)
 	}
 
 	var result []DockerContainer
 	for _, c := range containers {
-		dc := DockerContainer{
-			ID:     c.ID[:12],
-			Name:   strings.TrimPrefix(c.Names[0], "/"),
-			Image:  c.Image,
-			Labels: c.Labels,
-		}
-
-		for _, p := range c.Ports {
-			if p.PublicPort > 0 {
-				dc.Ports = append(dc.Ports, ContainerPort{
-					ContainerPort: int(p.PrivatePort),
-					HostPort:      int(p.PublicPort),
-					Protocol:      p.Type,
-				})
-			}
-		}
-
-		if len(dc.Ports) > 0 {
+		dc := containerFromSummary(c)
+		if len(dc.Ports) > 0 || len(dc.Internal) > 0 {
 			result = append(result, dc)
 		}
 	}
@@ -67,26 +67,62 @@ func GetDockerContainers() ([]DockerContainer, error) {
 	return result, nil
 }
 
-// GetContainerByPort finds a container that has a specific host port mapped
-func GetContainerByPort(containers []DockerContainer, port int) *DockerContainer {
-	for i, c := range containers {
-		for _, p := range c.Ports {
-			if p.HostPort == port {
-				return &containers[i]
+// containerFromSummary converts a container list entry. Exposed ports that
+// aren't published anywhere on the host are kept separately as internal.
+func containerFromSummary(c container.Summary) DockerContainer {
+	dc := DockerContainer{
+		ID:     c.ID[:12],
+		Name:   strings.TrimPrefix(c.Names[0], "/"),
+		Image:  c.Image,
+		State:  c.State,
+		Status: c.Status,
+		Labels: c.Labels,
+		fullID: c.ID,
+	}
+
+	published := make(map[string]bool)
+	for _, p := range c.Ports {
+		if p.PublicPort > 0 {
+			dc.Ports = append(dc.Ports, ContainerPort{
+				ContainerPort: int(p.PrivatePort),
+				HostPort:      int(p.PublicPort),
+				Protocol:      p.Type,
+			})
+			published[fmt.Sprintf("%s/%d", p.Type, p.PrivatePort)] = true
+		}
+	}
+
+	// The API lists a private port once per address family; keep one entry
+	for _, p := range c.Ports {
+		key := fmt.Sprintf("%s/%d", p.Type, p.PrivatePort)
+		if p.PublicPort == 0 && !published[key] {
+			dc.Internal = append(dc.Internal, ContainerPort{ContainerPort: int(p.PrivatePort), Protocol: p.Type})
+			published[key] = true
+		}
+	}
+
+	if c.NetworkSettings != nil {
+		for name, ep := range c.NetworkSettings.Networks {
+			if ep == nil {
+				continue
 			}
+			dc.Networks = append(dc.Networks, ContainerNetwork{Name: name, IP: ep.IPAddress})
 		}
+		sort.Slice(dc.Networks, func(i, j int) bool { return dc.Networks[i].Name < dc.Networks[j].Name })
 	}
-	return nil
+
+	return dc
 }
 
-// GuessServiceFromContainer tries to identify what service a container is running
-func GuessServiceFromContainer(c *DockerContainer) string {
+// GuessServiceFromContainer tries to identify what service a container is
+// running. The second return value says where the name came from.
+func GuessServiceFromContainer(c *DockerContainer) (string, string) {
 	// Check for common labels
-	if name, ok := c.Labels["com.docker.compose.service"]; ok {
-		return name
+	if name, ok := c.Labels[labelComposeService]; ok {
+		return name, "compose service label"
 	}
 	if name, ok := c.Labels["org.opencontainers.image.title"]; ok {
-		return name
+		return name, "image title label"
 	}
 
 	// Try to extract from image name
@@ -102,5 +138,5 @@ func GuessServiceFromContainer(c *DockerContainer) string {
 		image = image[:idx]
 	}
 
-	return image
+	return image, "image name"
 }
@@ -0,0 +1,281 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+)
+
+// Reconnect backoff bounds for the Docker event stream
+const (
+	dockerMinBackoff = time.Second
+	dockerMaxBackoff = time.Minute
+)
+
+// errDockerNotConnected is returned while the tracker has no live connection
+var errDockerNotConnected = errors.New("not connected to the Docker daemon")
+
+// DockerTracker keeps a live view of one runtime's running containers using a
+// long-lived Docker API client. It does a full listing on (re)connect and then
+// applies container events incrementally.
+type DockerTracker struct {
+	runtime Runtime
+
+	mu         sync.RWMutex
+	containers map[string]DockerContainer // by short ID
+	connected  bool
+	lastErr    error
+
+	// onChange is called after a container event with the host ports it
+	// affected; ports is empty when only unpublished ports changed
+	onChange func(ports []int)
+}
+
+// NewDockerTracker creates a tracker for a runtime; call Start to connect
+func NewDockerTracker(rt Runtime, onChange func(ports []int)) *DockerTracker {
+	return &DockerTracker{
+		runtime:    rt,
+		containers: make(map[string]DockerContainer),
+		onChange:   onChange,
+		lastErr:    errDockerNotConnected,
+	}
+}
+
+// Start connects to Docker in the background, reconnecting with exponential
+// backoff whenever the daemon goes away, until ctx is cancelled
+func (t *DockerTracker) Start(ctx context.Context) {
+	go func() {
+		backoff := dockerMinBackoff
+		for {
+			started := time.Now()
+			err := t.watch(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+
+			t.setDisconnected(err)
+
+			// A connection that stayed up for a while resets the backoff
+			if time.Since(started) > dockerMaxBackoff {
+				backoff = dockerMinBackoff
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, dockerMaxBackoff)
+		}
+	}()
+}
+
+// Containers returns a snapshot of the tracked containers
+func (t *DockerTracker) Containers() ([]DockerContainer, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if !t.connected {
+		return nil, t.lastErr
+	}
+
+	result := make([]DockerContainer, 0, len(t.containers))
+	for _, c := range t.containers {
+		result = append(result, c)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+// ContainerByPort finds the tracked container publishing a host port
+func (t *DockerTracker) ContainerByPort(port int, protocol string) *DockerContainer {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	for _, c := range t.containers {
+		for _, p := range c.Ports {
+			if p.HostPort == port && p.Protocol == protocol {
+				found := c
+				return &found
+			}
+		}
+	}
+	return nil
+}
+
+// newClient creates an API client for the tracker's runtime
+func (t *DockerTracker) newClient() (*client.Client, error) {
+	// $DOCKER_HOST may come with TLS settings in the environment; the
+	// well-known local sockets never do
+	hostOpt := client.WithHost(t.runtime.Host)
+	if t.runtime.Host == os.Getenv("DOCKER_HOST") {
+		hostOpt = client.FromEnv
+	}
+
+	cli, err := client.NewClientWithOpts(hostOpt, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return nil, fmt.Errorf("creating docker client: %w", err)
+	}
+	return cli, nil
+}
+
+// watch runs one connection: full sync, then the event loop. It returns when
+// the connection fails or ctx is cancelled.
+func (t *DockerTracker) watch(ctx context.Context) error {
+	cli, err := t.newClient()
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	// Subscribe before listing so nothing that happens in between is missed
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	msgs, errs := cli.Events(watchCtx, events.ListOptions{
+		Filters: filters.NewArgs(filters.Arg("type", string(events.ContainerEventType))),
+	})
+
+	containers, err := listContainers(ctx, cli, filters.NewArgs())
+	if err != nil {
+		return err
+	}
+	affected := t.replaceAll(containers)
+	log.Printf("%s tracker connected to %s, %d containers with exposed ports", t.runtime.Name, t.runtime.Host, len(containers))
+	t.notify(affected)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-errs:
+			return fmt.Errorf("docker event stream: %w", err)
+		case msg := <-msgs:
+			t.handleEvent(ctx, cli, msg)
+		}
+	}
+}
+
+// handleEvent applies one container event to the cache
+func (t *DockerTracker) handleEvent(ctx context.Context, cli *client.Client, msg events.Message) {
+	id := msg.Actor.ID
+	if len(id) > 12 {
+		id = id[:12]
+	}
+
+	var affected []int
+	switch {
+	case msg.Action == events.ActionStart,
+		msg.Action == events.ActionUnPause,
+		msg.Action == events.ActionPause,
+		msg.Action == events.ActionRestart,
+		strings.HasPrefix(string(msg.Action), string(events.ActionHealthStatus)):
+		// Re-read just this container to pick up ports, state and health
+		containers, err := listContainers(ctx, cli, filters.NewArgs(filters.Arg("id", msg.Actor.ID)))
+		if err != nil {
+			log.Printf("%s tracker: refreshing %s: %v", t.runtime.Name, id, err)
+			return
+		}
+		affected, _ = t.remove(id)
+		for _, c := range containers {
+			affected = append(affected, t.put(c)...)
+		}
+
+	case msg.Action == events.ActionStop,
+		msg.Action == events.ActionDie,
+		msg.Action == events.ActionKill,
+		msg.Action == events.ActionDestroy:
+		var known bool
+		if affected, known = t.remove(id); !known {
+			return
+		}
+
+	default:
+		return
+	}
+
+	t.notify(affected)
+}
+
+func (t *DockerTracker) replaceAll(containers []DockerContainer) []int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var affected []int
+	for _, c := range t.containers {
+		affected = append(affected, hostPorts(c)...)
+	}
+
+	t.containers = make(map[string]DockerContainer, len(containers))
+	for _, c := range containers {
+		c.Runtime = t.runtime.Name
+		c.Host = t.runtime.Host
+		t.containers[c.ID] = c
+		affected = append(affected, hostPorts(c)...)
+	}
+	t.connected = true
+	t.lastErr = nil
+	return affected
+}
+
+func (t *DockerTracker) put(c DockerContainer) []int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c.Runtime = t.runtime.Name
+	c.Host = t.runtime.Host
+	t.containers[c.ID] = c
+	return hostPorts(c)
+}
+
+func (t *DockerTracker) remove(id string) ([]int, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	c, ok := t.containers[id]
+	if !ok {
+		return nil, false
+	}
+	delete(t.containers, id)
+	return hostPorts(c), true
+}
+
+func (t *DockerTracker) setDisconnected(err error) {
+	t.mu.Lock()
+	wasConnected := t.connected
+	var affected []int
+	for _, c := range t.containers {
+		affected = append(affected, hostPorts(c)...)
+	}
+	t.containers = make(map[string]DockerContainer)
+	t.connected = false
+	t.lastErr = err
+	t.mu.Unlock()
+
+	if wasConnected {
+		log.Printf("%s tracker disconnected: %v", t.runtime.Name, err)
+		t.notify(affected)
+	}
+}
+
+func (t *DockerTracker) notify(ports []int) {
+	if t.onChange != nil {
+		t.onChange(ports)
+	}
+}
+
+// hostPorts returns the host ports a container publishes
+func hostPorts(c DockerContainer) []int {
+	ports := make([]int, 0, len(c.Ports))
+	for _, p := range c.Ports {
+		ports = append(ports, p.HostPort)
+	}
+	return ports
+}
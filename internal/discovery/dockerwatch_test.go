@@ -0,0 +1,182 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+)
+
+// fakeDocker serves the parts of the Docker API the tracker uses on a Unix
+// socket: ping, container listing and the event stream
+type fakeDocker struct {
+	mu         sync.Mutex
+	containers []container.Summary
+	events     chan events.Message
+	srv        *http.Server
+	stackLists int // Listings of compose containers
+}
+
+var apiVersionPrefix = regexp.MustCompile(`^/v[0-9.]+`)
+
+func startFakeDocker(t *testing.T, containers ...container.Summary) (*fakeDocker, Runtime) {
+	t.Helper()
+	f := &fakeDocker{containers: containers, events: make(chan events.Message, 16)}
+
+	sock := filepath.Join(t.TempDir(), "docker.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.srv = &http.Server{Handler: http.HandlerFunc(f.serve)}
+	go f.srv.Serve(ln)
+	t.Cleanup(func() { f.srv.Close() })
+	return f, Runtime{Name: RuntimeDocker, Host: "unix://" + sock}
+}
+
+func (f *fakeDocker) serve(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("API-Version", "1.45")
+	switch apiVersionPrefix.ReplaceAllString(r.URL.Path, "") {
+	case "/_ping":
+		w.Write([]byte("OK"))
+	case "/containers/json":
+		args, err := filters.FromJSON(r.URL.Query().Get("filters"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.mu.Lock()
+		if args.Contains("label") {
+			f.stackLists++
+		}
+		var list []container.Summary
+		for _, c := range f.containers {
+			if !args.Contains("id") || args.ExactMatch("id", c.ID) {
+				list = append(list, c)
+			}
+		}
+		f.mu.Unlock()
+		json.NewEncoder(w).Encode(list)
+	case "/events":
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case msg := <-f.events:
+				json.NewEncoder(w).Encode(msg)
+				w.(http.Flusher).Flush()
+			}
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeDocker) set(containers ...container.Summary) {
+	f.mu.Lock()
+	f.containers = containers
+	f.mu.Unlock()
+}
+
+func (f *fakeDocker) send(action events.Action, id string) {
+	f.events <- events.Message{Type: events.ContainerEventType, Action: action, Actor: events.Actor{ID: id}}
+}
+
+func fakeContainer(id, name string, hostPort uint16) container.Summary {
+	return container.Summary{
+		ID:    strings.Repeat(id, 64/len(id)),
+		Names: []string{"/" + name},
+		Image: name + ":latest",
+		State: "running",
+		Ports: []container.Port{{PrivatePort: 80, PublicPort: hostPort, Type: "tcp"}},
+	}
+}
+
+func TestDockerTrackerFollowsEvents(t *testing.T) {
+	web := fakeContainer("a", "web", 8080)
+	api := fakeContainer("b", "api", 9090)
+	fake, rt := startFakeDocker(t, web)
+
+	changes := make(chan []int, 16)
+	tracker := NewDockerTracker(rt, func(ports []int) { changes <- ports })
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	tracker.Start(ctx)
+
+	expect := func(want []int) {
+		t.Helper()
+		select {
+		case got := <-changes:
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("affected ports = %v, want %v", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no change reported, want %v", want)
+		}
+	}
+
+	expect([]int{8080}) // Initial listing
+
+	fake.set(web, api)
+	fake.send(events.ActionStart, api.ID)
+	expect([]int{9090})
+
+	fake.set(api)
+	fake.send(events.ActionDie, web.ID)
+	expect([]int{8080})
+
+	containers, err := tracker.Containers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(containers) != 1 || containers[0].Name != "api" || containers[0].Ports[0].HostPort != 9090 {
+		t.Errorf("containers = %+v", containers)
+	}
+	if c := tracker.ContainerByPort(9090, "tcp"); c == nil || c.Name != "api" {
+		t.Errorf("ContainerByPort(9090) = %+v", c)
+	}
+	if c := tracker.ContainerByPort(8080, "tcp"); c != nil {
+		t.Errorf("ContainerByPort(8080) = %+v, want none", c)
+	}
+}
+
+func TestDockerTrackerReportsDisconnect(t *testing.T) {
+	fake, rt := startFakeDocker(t, fakeContainer("a", "web", 8080))
+
+	changes := make(chan []int, 4)
+	tracker := NewDockerTracker(rt, func(ports []int) { changes <- ports })
+	if _, err := tracker.Containers(); err == nil {
+		t.Fatal("Containers() before connecting returned no error")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	tracker.Start(ctx)
+	<-changes // Initial listing
+
+	// The daemon going away drops its containers' ports
+	fake.srv.Close()
+	select {
+	case ports := <-changes:
+		if !reflect.DeepEqual(ports, []int{8080}) {
+			t.Errorf("affected ports = %v, want [8080]", ports)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("disconnect not reported")
+	}
+	if _, err := tracker.Containers(); err == nil {
+		t.Error("Containers() after disconnecting returned no error")
+	}
+}
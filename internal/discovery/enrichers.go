@@ -0,0 +1,417 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+)
+
+// procSource reports listening sockets from /proc/net
+type procSource struct{}
+
+func (procSource) Name() string { return "proc" }
+
+func (procSource) Ports(run *Run) ([]ListeningPort, error) {
+	log.Println("  Scanning listening ports...")
+	return GetListeningPorts()
+}
+
+// dockerEnricher names ports published by containers, reading from the
+// event-driven DockerTracker of each runtime rather than querying daemons
+// each run
+type dockerEnricher struct {
+	trackers []*DockerTracker
+}
+
+func (e *dockerEnricher) Name() string { return "docker" }
+
+func (e *dockerEnricher) Prepare(run *Run) error {
+	var errs []error
+	for _, t := range e.trackers {
+		containers, err := t.Containers()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s (%s): %w", t.runtime.Name, t.runtime.Host, err))
+			continue
+		}
+		log.Printf("  Tracking %d %s containers with exposed ports", len(containers), t.runtime.Name)
+	}
+
+	// Not fatal - no container runtime might be running
+	if len(errs) == len(e.trackers) && len(errs) > 0 {
+		return fmt.Errorf("no container runtime available: %v", errs)
+	}
+	return nil
+}
+
+func (e *dockerEnricher) Enrich(run *Run, c *Candidate) {
+	var container *DockerContainer
+	for _, t := range e.trackers {
+		if container = t.ContainerByPort(c.Port.Port, c.Port.Protocol); container != nil {
+			break
+		}
+	}
+	if container == nil {
+		return
+	}
+
+	// Podman is reported as such; rootless Docker is still Docker
+	family := RuntimeDocker
+	if container.Runtime == RuntimePodman {
+		family = RuntimePodman
+	}
+
+	c.Service.Source = family
+	c.Service.Runtime = container.Runtime
+	c.Service.RuntimeHost = container.Host
+	c.Service.Container = container.Name
+	c.Service.Image = container.Image
+	c.Service.ContainerState = container.State
+	c.Service.Networks = container.Networks
+	c.Service.ComposeProject = container.Labels[labelComposeProject]
+	c.Service.ComposeService = container.Labels[labelComposeService]
+	for _, p := range container.Ports {
+		if p.HostPort == c.Port.Port && p.Protocol == c.Port.Protocol {
+			c.Service.ContainerPort = p.ContainerPort
+			break
+		}
+	}
+	c.AddTag(family)
+
+	name, reason := GuessServiceFromContainer(container)
+	c.Propose(Contribution{Field: FieldName, Value: name, Priority: PriorityDocker, Confidence: 1, Reason: reason})
+
+	// For Docker containers, check if there's a compose project directory
+	if projectDir, ok := container.Labels[labelComposeWorkingDir]; ok {
+		c.Propose(Contribution{Field: FieldProject, Value: projectDir, Priority: PriorityDocker, Confidence: 1, Reason: ProjectSourceCompose})
+	}
+}
+
+// processProjectEnricher ties non-Docker ports to the project containing the
+// listening process
+type processProjectEnricher struct{}
+
+func (processProjectEnricher) Name() string { return "process" }
+
+func (processProjectEnricher) Prepare(run *Run) error { return nil }
+
+func (processProjectEnricher) Enrich(run *Run, c *Candidate) {
+	if c.Service.Container != "" {
+		return
+	}
+
+	projectPath, method := FindProjectForProcess(run.Projects, c.Port)
+	if projectPath == "" {
+		return
+	}
+
+	confidence := map[string]float64{
+		ProjectSourceCwd:     0.95,
+		ProjectSourceCmdline: 0.9,
+		ProjectSourceParent:  0.8,
+	}[method]
+
+	c.Propose(Contribution{Field: FieldProject, Value: projectPath, Priority: PriorityProcess, Confidence: confidence, Reason: method})
+	c.Propose(Contribution{Field: FieldName, Value: filepath.Base(projectPath), Priority: PriorityProject, Confidence: confidence, Reason: "project containing the process"})
+}
+
+// systemdEnricher records the systemd unit each non-container port's process
+// runs in, and names the port after the unit's description
+type systemdEnricher struct {
+	descriptions *unitDescriptions
+}
+
+func (e *systemdEnricher) Name() string { return "systemd" }
+
+func (e *systemdEnricher) Prepare(run *Run) error {
+	e.descriptions.prune(run.Ports)
+	return nil
+}
+
+func (e *systemdEnricher) Enrich(run *Run, c *Candidate) {
+	if c.Service.Container != "" {
+		return // Published by docker-proxy or rootlessport, not the service
+	}
+	unit, ok := ParseCgroup(c.Port.Cgroup)
+	if !ok {
+		return
+	}
+	if unit.Container == "" {
+		unit.Description = e.descriptions.get(unit)
+	}
+	c.Service.Unit = &unit
+
+	if unit.namesService() {
+		c.Propose(Contribution{Field: FieldName, Value: unit.Description, Priority: PrioritySystemd, Confidence: 0.8, Reason: "description of " + unit.Name})
+		c.AddTag("systemd")
+	}
+}
+
+// configScanEnricher ties non-Docker ports to projects whose config files
+// declare or mention the port number, trusting each match as much as its
+// ProjectMatch.Confidence
+type configScanEnricher struct {
+	matches []ProjectMatch
+}
+
+func (e *configScanEnricher) Name() string { return "config-scan" }
+
+func (e *configScanEnricher) Prepare(run *Run) error {
+	e.matches = nil
+	if len(run.Projects) == 0 {
+		return nil
+	}
+
+	log.Printf("  Scanning %d projects...", len(run.Projects))
+	ports := make([]int, len(run.Ports))
+	for i, p := range run.Ports {
+		ports[i] = p.Port
+	}
+
+	e.matches = ScanProjectsForPorts(run.Projects, ports)
+	log.Printf("  Found %d project/port matches", len(e.matches))
+	return nil
+}
+
+func (e *configScanEnricher) Enrich(run *Run, c *Candidate) {
+	if c.Service.Container != "" {
+		return
+	}
+
+	match := FindProjectForPort(e.matches, c.Port.Port)
+	if match == nil {
+		return
+	}
+
+	reason := fmt.Sprintf("port found in %s", match.File)
+	c.Propose(Contribution{Field: FieldProject, Value: match.ProjectPath, Priority: PriorityConfig, Confidence: match.Confidence, Reason: ProjectSourceConfig})
+	c.Propose(Contribution{Field: FieldName, Value: match.ProjectName, Priority: PriorityProject, Confidence: match.Confidence, Reason: reason})
+	c.Propose(Contribution{
+		Field:      FieldDescription,
+		Value:      fmt.Sprintf("Found in %s: %s", match.File, truncate(match.Context, 60)),
+		Priority:   PriorityConfig,
+		Confidence: match.Confidence,
+		Reason:     reason,
+	})
+}
+
+// httpProbeEnricher connects to likely HTTP ports, reads server details and
+// applies the fingerprint rules that match on them. Ports are probed
+// concurrently, and a port is only probed again once the process that owns
+// it changes.
+type httpProbeEnricher struct {
+	cache *probeCache[HTTPProbeResult]
+	rules *RuleSet
+	icons *iconStore
+}
+
+func (e *httpProbeEnricher) Name() string { return "http-probe" }
+
+func (e *httpProbeEnricher) Prepare(run *Run) error {
+	e.cache.prune(run.Ports)
+	return nil
+}
+
+func (e *httpProbeEnricher) Enrich(run *Run, c *Candidate) {
+	e.EnrichAll(context.Background(), run, []*Candidate{c})
+}
+
+func (e *httpProbeEnricher) EnrichAll(ctx context.Context, run *Run, candidates []*Candidate) {
+	var todo []*Candidate
+	for _, c := range candidates {
+		if e.shouldProbe(c) {
+			todo = append(todo, c)
+		}
+	}
+
+	results := make([]HTTPProbeResult, len(todo))
+	probed := make([]bool, len(todo))
+	forEachConcurrently(ctx, len(todo), probeWorkers, func(i int) {
+		lp := todo[i].Port
+		if cached, ok := e.cache.get(lp); ok {
+			results[i], probed[i] = cached, true
+			return
+		}
+
+		result := ProbeHTTPContext(ctx, DialHost(lp.BindAddresses), lp.Port)
+		icon, hasIcon := FetchIcon(ctx, result)
+		if ctx.Err() != nil {
+			return // Cut short by the deadline; don't cache a false negative
+		}
+		e.storeIcon(ServiceID(todo[i].Service), &result, icon, hasIcon)
+		e.cache.put(lp, result)
+		results[i], probed[i] = result, true
+	})
+
+	for i, c := range todo {
+		if probed[i] {
+			e.applyProbe(c, results[i])
+		}
+	}
+}
+
+// applyProbe records a probe result on a candidate
+func (e *httpProbeEnricher) applyProbe(c *Candidate, probe HTTPProbeResult) {
+	if !probe.IsHTTP {
+		return
+	}
+	port := c.Port.Port
+
+	c.Service.IsHTTP = true
+	scheme := "http"
+	if probe.IsHTTPS {
+		scheme = "https"
+	}
+	c.Propose(Contribution{Field: FieldURL, Value: fmt.Sprintf("%s://localhost:%d", scheme, port), Priority: PriorityProbe, Confidence: 1, Reason: scheme + " probe succeeded"})
+
+	if r := e.rules.match(subjectFor(c, &probe), true); r != nil {
+		applyRule(c, r, PriorityProbe, 0.7)
+	} else if probe.Title != "" && len(probe.Title) < 50 {
+		// No rule knows the app; its page title is the next best name
+		c.Propose(Contribution{Field: FieldName, Value: probe.Title, Priority: PriorityProbe, Confidence: 0.6, Reason: "HTML page title"})
+	}
+
+	if probe.Server != "" {
+		c.Propose(Contribution{Field: FieldDescription, Value: fmt.Sprintf("Server: %s", probe.Server), Priority: PriorityProbeHint, Confidence: 0.5, Reason: "HTTP Server header"})
+	}
+
+	if probe.FaviconHash != "" {
+		c.Propose(Contribution{Field: FieldIcon, Value: iconPath(ServiceID(c.Service), probe.FaviconHash), Priority: PriorityProbe, Confidence: 0.5, Reason: "icon at " + probe.Icon})
+	}
+
+	c.AddTag("http")
+}
+
+// storeIcon caches a freshly fetched icon on disk for the dashboard, or
+// forgets the previous one when the server no longer has any
+func (e *httpProbeEnricher) storeIcon(id string, result *HTTPProbeResult, icon Icon, ok bool) {
+	if !ok {
+		e.icons.remove(id)
+		return
+	}
+	if err := e.icons.save(id, icon); err != nil {
+		log.Printf("  http-probe: could not cache icon of %s: %v", id, err)
+		return
+	}
+	result.Icon, result.FaviconHash = icon.Source, icon.Hash
+}
+
+// shouldProbe limits HTTP probing (TCP only) to ports a rule marks as HTTP,
+// project dev servers and ports nothing else could name. Docker names don't
+// count: a container on an unknown port is still worth probing for a URL.
+func (e *httpProbeEnricher) shouldProbe(c *Candidate) bool {
+	if c.Port.Protocol != "tcp" {
+		return false
+	}
+	if e.rules.wantsHTTP(subjectFor(c, nil)) || c.Has(FieldProject) {
+		return true
+	}
+	for _, claim := range c.Claims(FieldName) {
+		if claim.Priority < PriorityDocker {
+			return false
+		}
+	}
+	return true
+}
+
+// fingerprintEnricher identifies non-HTTP TCP services (databases, SSH, mail,
+// gRPC, ...) by their handshake, so they are named correctly on any port.
+// Results are cached like HTTP probes.
+type fingerprintEnricher struct {
+	cache *probeCache[Fingerprint]
+}
+
+func (e *fingerprintEnricher) Name() string { return "fingerprint" }
+
+func (e *fingerprintEnricher) Prepare(run *Run) error {
+	e.cache.prune(run.Ports)
+	return nil
+}
+
+func (e *fingerprintEnricher) Enrich(run *Run, c *Candidate) {
+	e.EnrichAll(context.Background(), run, []*Candidate{c})
+}
+
+func (e *fingerprintEnricher) EnrichAll(ctx context.Context, run *Run, candidates []*Candidate) {
+	var todo []*Candidate
+	for _, c := range candidates {
+		if c.Port.Protocol == "tcp" && !c.Service.IsHTTP {
+			todo = append(todo, c)
+		}
+	}
+
+	results := make([]Fingerprint, len(todo))
+	forEachConcurrently(ctx, len(todo), probeWorkers, func(i int) {
+		lp := todo[i].Port
+		if cached, ok := e.cache.get(lp); ok {
+			results[i] = cached
+			return
+		}
+
+		fp := FingerprintPort(ctx, DialHost(lp.BindAddresses), lp.Port)
+		if ctx.Err() != nil {
+			return
+		}
+		e.cache.put(lp, fp)
+		results[i] = fp
+	})
+
+	for i, c := range todo {
+		applyFingerprint(c, results[i])
+	}
+}
+
+// applyFingerprint records a detected protocol on a candidate
+func applyFingerprint(c *Candidate, fp Fingerprint) {
+	if fp.Protocol == "" {
+		return
+	}
+
+	c.Service.AppProtocol = fp.Protocol
+	c.Service.Version = fp.Version
+	reason := fp.Product + " handshake"
+	c.Propose(Contribution{Field: FieldName, Value: fp.Product, Priority: PriorityProbe, Confidence: 0.9, Reason: reason})
+	if fp.Version != "" {
+		c.Propose(Contribution{Field: FieldDescription, Value: fmt.Sprintf("%s %s", fp.Product, fp.Version), Priority: PriorityProbeHint, Confidence: 0.6, Reason: reason})
+	}
+	c.AddTag(fp.Protocol)
+}
+
+// processNameEnricher falls back to the process name
+type processNameEnricher struct{}
+
+func (processNameEnricher) Name() string { return "process-name" }
+
+func (processNameEnricher) Prepare(run *Run) error { return nil }
+
+func (processNameEnricher) Enrich(run *Run, c *Candidate) {
+	c.Propose(Contribution{Field: FieldName, Value: c.Port.Process, Priority: PriorityProcName, Confidence: 0.2, Reason: "name of the listening process"})
+}
+
+// defaultEnrichers returns the built-in enrichers in the order they run
+func defaultEnrichers(trackers []*DockerTracker, rules *RuleSet, icons *iconStore) []Enricher {
+	return []Enricher{
+		&dockerEnricher{trackers: trackers},
+		containerForwarderEnricher{},
+		processProjectEnricher{},
+		&systemdEnricher{descriptions: newUnitDescriptions()},
+		&configScanEnricher{},
+		&ruleEnricher{rules: rules},
+		&httpProbeEnricher{cache: newProbeCache(func(r HTTPProbeResult) bool { return !r.IsHTTP }), rules: rules, icons: icons},
+		&fingerprintEnricher{cache: newProbeCache(func(fp Fingerprint) bool { return fp.Protocol == "" })},
+		processNameEnricher{},
+	}
+}
+
+func truncate(s string, maxLen int) string {
+	if len(s) <= maxLen {
+		return s
+	}
+	return s[:maxLen-3] + "..."
+}
+
+// commandLine joins a process's argv for display
+func commandLine(args []string) string {
+	return strings.Join(args, " ")
+}
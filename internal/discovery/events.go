@@ -0,0 +1,135 @@
+package discovery
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Change types reported in a ServiceChange
+const (
+	ChangeAppeared    = "appeared"
+	ChangeDisappeared = "disappeared"
+	ChangeChanged     = "changed"
+)
+
+// subscriberBuffer is how many undelivered events a subscriber may lag
+// behind before further events are dropped for it
+const subscriberBuffer = 16
+
+// ServiceChange describes how one service differs between two discovery runs
+type ServiceChange struct {
+	Type     string   `json:"type"`               // appeared, disappeared, changed
+	Service  Service  `json:"service"`            // Current state (last known state for disappeared)
+	Previous *Service `json:"previous,omitempty"` // State before the change, for changed
+	Fields   []string `json:"fields,omitempty"`   // Which of name, url, project changed
+}
+
+// ChangeEvent is the diff produced by one Discover run
+type ChangeEvent struct {
+	Timestamp time.Time       `json:"timestamp"`
+	Changes   []ServiceChange `json:"changes"`
+}
+
+// broadcaster fans change events out to subscribers without blocking discovery
+type broadcaster struct {
+	mu   sync.Mutex
+	subs map[chan ChangeEvent]struct{}
+}
+
+func newBroadcaster() *broadcaster {
+	return &broadcaster{subs: make(map[chan ChangeEvent]struct{})}
+}
+
+func (b *broadcaster) subscribe() (<-chan ChangeEvent, func()) {
+	ch := make(chan ChangeEvent, subscriberBuffer)
+
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, ch)
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+	return ch, unsubscribe
+}
+
+func (b *broadcaster) publish(event ChangeEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subs {
+		select {
+		case ch <- event:
+		default:
+			// Slow subscriber; it will catch up from the next full refresh
+		}
+	}
+}
+
+// Subscribe returns a channel that receives a ChangeEvent whenever a Discover
+// run finds services appearing, disappearing or changing. Call the returned
+// function to unsubscribe.
+func (d *Discoverer) Subscribe() (<-chan ChangeEvent, func()) {
+	return d.events.subscribe()
+}
+
+// ServiceID identifies a service across runs in a form that fits in a URL
+// path: protocol and port, plus the container for internal ports
+func ServiceID(s Service) string {
+	if s.Exposure == ExposureInternal {
+		return fmt.Sprintf("%s-%d-%s", s.Protocol, s.Port, s.Container)
+	}
+	return fmt.Sprintf("%s-%d", s.Protocol, s.Port)
+}
+
+// DiffServices compares two discovery results
+func DiffServices(prev, curr []Service) []ServiceChange {
+	prevByKey := make(map[string]Service, len(prev))
+	for _, s := range prev {
+		prevByKey[ServiceID(s)] = s
+	}
+
+	var changes []ServiceChange
+	seen := make(map[string]bool, len(curr))
+
+	for _, s := range curr {
+		key := ServiceID(s)
+		seen[key] = true
+
+		old, ok := prevByKey[key]
+		if !ok {
+			changes = append(changes, ServiceChange{Type: ChangeAppeared, Service: s})
+			continue
+		}
+
+		var fields []string
+		if old.Name != s.Name {
+			fields = append(fields, "name")
+		}
+		if old.URL != s.URL {
+			fields = append(fields, "url")
+		}
+		if old.ProjectPath != s.ProjectPath {
+			fields = append(fields, "project")
+		}
+		if len(fields) > 0 {
+			previous := old
+			changes = append(changes, ServiceChange{Type: ChangeChanged, Service: s, Previous: &previous, Fields: fields})
+		}
+	}
+
+	for _, s := range prev {
+		if !seen[ServiceID(s)] {
+			changes = append(changes, ServiceChange{Type: ChangeDisappeared, Service: s})
+		}
+	}
+
+	return changes
+}
@@ -0,0 +1,44 @@
+package discovery
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestDiffServices(t *testing.T) {
+	web := Service{Port: 3000, Protocol: "tcp", Name: "web"}
+	dns := Service{Port: 53, Protocol: "udp", Name: "DNS"}
+	dbA := Service{Port: 5432, Protocol: "tcp", Name: "db", Exposure: ExposureInternal, Container: "a-db-1"}
+	dbB := Service{Port: 5432, Protocol: "tcp", Name: "db", Exposure: ExposureInternal, Container: "b-db-1"}
+	renamed := web
+	renamed.Name, renamed.ProjectPath = "shop", "/home/dev/shop"
+
+	tests := []struct {
+		name       string
+		prev, curr []Service
+		want       []string // Type:ServiceID[:fields]
+	}{
+		{"nothing changed", []Service{web, dns}, []Service{dns, web}, nil},
+		{"appeared", []Service{web}, []Service{web, dns}, []string{"appeared:udp-53"}},
+		{"disappeared", []Service{web, dns}, []Service{web}, []string{"disappeared:udp-53"}},
+		{"changed", []Service{web}, []Service{renamed}, []string{"changed:tcp-3000:[name project]"}},
+		{"internal ports by container", []Service{dbA}, []Service{dbA, dbB}, []string{"appeared:tcp-5432-b-db-1"}},
+		{"same port, other protocol", []Service{web}, []Service{web, {Port: 3000, Protocol: "udp"}}, []string{"appeared:udp-3000"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, c := range DiffServices(tt.prev, tt.curr) {
+				s := c.Type + ":" + ServiceID(c.Service)
+				if c.Fields != nil {
+					s += ":" + fmt.Sprint(c.Fields)
+				}
+				got = append(got, s)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,282 @@
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Wire protocols recognised by FingerprintPort
+const (
+	ProtoSSH      = "ssh"
+	ProtoSMTP     = "smtp"
+	ProtoMySQL    = "mysql"
+	ProtoNATS     = "nats"
+	ProtoPostgres = "postgres"
+	ProtoRedis    = "redis"
+	ProtoGRPC     = "grpc"
+	ProtoHTTP2    = "http2"
+)
+
+// Fingerprint is what a protocol handshake revealed about a server
+type Fingerprint struct {
+	Protocol string // One of the Proto* constants, empty if unrecognised
+	Product  string // Display name, e.g. "PostgreSQL", "MariaDB", "Valkey"
+	Version  string // Server version or software, when the handshake reports it
+}
+
+// bannerWait is how long to wait for servers that speak first (SSH, SMTP,
+// MySQL, NATS) before trying protocols where the client speaks first
+const bannerWait = 500 * time.Millisecond
+
+// handshakeTimeout bounds each client-first handshake
+const handshakeTimeout = time.Second
+
+// FingerprintPort identifies the protocol spoken on host:port using
+// read-only handshakes. It first listens for a greeting, then tries the
+// PostgreSQL SSLRequest, a Redis PING and an HTTP/2 (gRPC) preface, each on a
+// fresh connection. Nothing is written that changes server state.
+func FingerprintPort(ctx context.Context, host string, port int) Fingerprint {
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+
+	banner, err := readBanner(ctx, addr)
+	if err != nil {
+		return Fingerprint{} // Not accepting connections
+	}
+	if len(banner) > 0 {
+		return parseBanner(banner) // The server spoke first; nothing else to try
+	}
+
+	for _, handshake := range []func(context.Context, string) Fingerprint{
+		fingerprintPostgres,
+		fingerprintRedis,
+		fingerprintHTTP2,
+	} {
+		if ctx.Err() != nil {
+			break
+		}
+		if fp := handshake(ctx, addr); fp.Protocol != "" {
+			return fp
+		}
+	}
+	return Fingerprint{}
+}
+
+// dialHandshake connects with a deadline covering the whole exchange
+func dialHandshake(ctx context.Context, addr string, timeout time.Duration) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+	return conn, nil
+}
+
+// readBanner returns whatever the server sends unprompted within bannerWait
+func readBanner(ctx context.Context, addr string) ([]byte, error) {
+	conn, err := dialHandshake(ctx, addr, bannerWait)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	buf := make([]byte, 1024)
+	n, _ := conn.Read(buf) // A timeout just means the client is expected to speak first
+	return buf[:n], nil
+}
+
+// parseBanner recognises SSH, SMTP, MySQL and NATS greetings
+func parseBanner(banner []byte) Fingerprint {
+	line, _, _ := strings.Cut(string(banner), "\n")
+	line = strings.TrimRight(line, "\r")
+
+	switch {
+	case strings.HasPrefix(line, "SSH-"):
+		// SSH-2.0-OpenSSH_9.6p1 Ubuntu-3ubuntu13
+		parts := strings.SplitN(line, "-", 3)
+		fp := Fingerprint{Protocol: ProtoSSH, Product: "SSH"}
+		if len(parts) == 3 {
+			if software := strings.Fields(parts[2]); len(software) > 0 {
+				fp.Version = software[0]
+			}
+		}
+		return fp
+
+	case strings.HasPrefix(line, "220") && strings.Contains(strings.ToUpper(line), "SMTP"):
+		// 220 mail.example.com ESMTP Postfix (Ubuntu)
+		fields := strings.Fields(line)
+		fp := Fingerprint{Protocol: ProtoSMTP, Product: "SMTP"}
+		if len(fields) > 2 {
+			fp.Version = strings.Join(fields[2:], " ")
+		}
+		return fp
+
+	case strings.HasPrefix(line, "INFO {"):
+		var info struct {
+			Version string `json:"version"`
+		}
+		json.Unmarshal([]byte(strings.TrimPrefix(line, "INFO ")), &info)
+		return Fingerprint{Protocol: ProtoNATS, Product: "NATS", Version: info.Version}
+	}
+
+	return parseMySQLGreeting(banner)
+}
+
+// parseMySQLGreeting reads the initial handshake packet of MySQL and MariaDB,
+// or the error packet sent to hosts that aren't allowed to connect
+func parseMySQLGreeting(packet []byte) Fingerprint {
+	if len(packet) < 6 || packet[3] != 0 {
+		return Fingerprint{}
+	}
+	length := int(packet[0]) | int(packet[1])<<8 | int(packet[2])<<16
+	if length < 2 || length+4 != len(packet) { // The greeting is a single packet
+		return Fingerprint{}
+	}
+	body := packet[4:]
+
+	switch body[0] {
+	case 0x0a: // Protocol version 10, followed by the NUL-terminated server version
+		end := bytes.IndexByte(body[1:], 0)
+		if end < 0 {
+			return Fingerprint{}
+		}
+		version := string(body[1 : 1+end])
+		fp := Fingerprint{Protocol: ProtoMySQL, Product: "MySQL", Version: version}
+		if strings.Contains(strings.ToLower(version), "mariadb") {
+			fp.Product = "MariaDB"
+			fp.Version = strings.TrimPrefix(version, "5.5.5-") // Compatibility prefix MariaDB sends
+		}
+		return fp
+
+	case 0xff: // Error packet: 2-byte code, then the message
+		if msg := string(body[3:]); strings.Contains(msg, "MySQL") || strings.Contains(msg, "MariaDB") {
+			return Fingerprint{Protocol: ProtoMySQL, Product: "MySQL"}
+		}
+	}
+	return Fingerprint{}
+}
+
+// fingerprintPostgres sends an SSLRequest, which a PostgreSQL server answers
+// with a single 'S' or 'N' byte before any authentication
+func fingerprintPostgres(ctx context.Context, addr string) Fingerprint {
+	conn, err := dialHandshake(ctx, addr, handshakeTimeout)
+	if err != nil {
+		return Fingerprint{}
+	}
+	defer conn.Close()
+
+	request := make([]byte, 8)
+	binary.BigEndian.PutUint32(request[0:4], 8)
+	binary.BigEndian.PutUint32(request[4:8], 80877103) // SSLRequest code
+	if _, err := conn.Write(request); err != nil {
+		return Fingerprint{}
+	}
+
+	reply := make([]byte, 16)
+	n, _ := conn.Read(reply)
+	if n == 1 && (reply[0] == 'S' || reply[0] == 'N') {
+		return Fingerprint{Protocol: ProtoPostgres, Product: "PostgreSQL"}
+	}
+	return Fingerprint{}
+}
+
+var (
+	redisVersionRe = regexp.MustCompile(`(?m)^redis_version:(\S+)`)
+	valkeyRe       = regexp.MustCompile(`(?m)^valkey_version:(\S+)`)
+)
+
+// fingerprintRedis sends PING, then INFO server for the version when no
+// password is required
+func fingerprintRedis(ctx context.Context, addr string) Fingerprint {
+	conn, err := dialHandshake(ctx, addr, handshakeTimeout)
+	if err != nil {
+		return Fingerprint{}
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("*1\r\n$4\r\nPING\r\n")); err != nil {
+		return Fingerprint{}
+	}
+	reply := make([]byte, 256)
+	n, _ := conn.Read(reply)
+	line := string(reply[:n])
+
+	fp := Fingerprint{Protocol: ProtoRedis, Product: "Redis"}
+	switch {
+	case strings.HasPrefix(line, "+PONG"):
+	case strings.HasPrefix(line, "-NOAUTH"), strings.HasPrefix(line, "-DENIED"), strings.HasPrefix(line, "-WRONGPASS"):
+		return fp // Requires a password; that's as far as a read-only probe goes
+	default:
+		return Fingerprint{}
+	}
+
+	if _, err := conn.Write([]byte("*2\r\n$4\r\nINFO\r\n$6\r\nserver\r\n")); err != nil {
+		return fp
+	}
+	var info []byte
+	buf := make([]byte, 4096)
+	for len(info) < 16*1024 {
+		n, err := conn.Read(buf)
+		info = append(info, buf[:n]...)
+		if err != nil || bytes.HasSuffix(info, []byte("\r\n\r\n")) { // End of the bulk reply
+			break
+		}
+	}
+
+	if m := valkeyRe.FindSubmatch(info); m != nil {
+		fp.Product, fp.Version = "Valkey", string(m[1])
+	} else if m := redisVersionRe.FindSubmatch(info); m != nil {
+		fp.Version = string(m[1])
+	}
+	return fp
+}
+
+// h2cClient speaks cleartext HTTP/2 with prior knowledge, which is how gRPC
+// servers without TLS are reached
+var h2cClient = func() *http.Client {
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	return &http.Client{Transport: &http.Transport{Protocols: &protocols, DisableKeepAlives: true}}
+}()
+
+// fingerprintHTTP2 sends the HTTP/2 connection preface followed by a gRPC
+// health check. gRPC servers answer with an application/grpc response (even
+// when the health service isn't registered); other HTTP/2-only servers answer
+// with plain HTTP/2.
+func fingerprintHTTP2(ctx context.Context, addr string) Fingerprint {
+	ctx, cancel := context.WithTimeout(ctx, handshakeTimeout)
+	defer cancel()
+
+	// An empty HealthCheckRequest: uncompressed flag plus zero length
+	body := bytes.NewReader([]byte{0, 0, 0, 0, 0})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("http://%s/grpc.health.v1.Health/Check", addr), body)
+	if err != nil {
+		return Fingerprint{}
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+
+	resp, err := h2cClient.Do(req)
+	if err != nil {
+		return Fingerprint{}
+	}
+	resp.Body.Close()
+
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/grpc") {
+		return Fingerprint{Protocol: ProtoGRPC, Product: "gRPC", Version: resp.Header.Get("Server")}
+	}
+	return Fingerprint{Protocol: ProtoHTTP2, Product: "HTTP/2", Version: resp.Header.Get("Server")}
+}
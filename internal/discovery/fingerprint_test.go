@@ -0,0 +1,163 @@
+package discovery
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"testing"
+)
+
+// mysqlPacket frames body as the first packet of a MySQL connection
+func mysqlPacket(body string) []byte {
+	n := len(body)
+	return append([]byte{byte(n), byte(n >> 8), byte(n >> 16), 0}, body...)
+}
+
+func TestParseBanner(t *testing.T) {
+	tests := []struct {
+		name   string
+		banner []byte
+		want   Fingerprint
+	}{
+		{"ssh", []byte("SSH-2.0-OpenSSH_9.6p1 Ubuntu-3ubuntu13\r\n"), Fingerprint{ProtoSSH, "SSH", "OpenSSH_9.6p1"}},
+		{"ssh without software", []byte("SSH-2.0\r\n"), Fingerprint{ProtoSSH, "SSH", ""}},
+		{"smtp", []byte("220 mail.example.com ESMTP Postfix (Ubuntu)\r\n"), Fingerprint{ProtoSMTP, "SMTP", "ESMTP Postfix (Ubuntu)"}},
+		{"ftp is not smtp", []byte("220 ProFTPD Server ready.\r\n"), Fingerprint{}},
+		{"nats", []byte(`INFO {"server_id":"N1","version":"2.10.7","proto":1}` + "\r\n"), Fingerprint{ProtoNATS, "NATS", "2.10.7"}},
+		{"mysql", mysqlPacket("\x0a8.0.36\x00\x08\x00\x00\x00abcdefgh\x00"), Fingerprint{ProtoMySQL, "MySQL", "8.0.36"}},
+		{"mariadb", mysqlPacket("\x0a5.5.5-10.11.6-MariaDB-0ubuntu0.24.04.1\x00rest"), Fingerprint{ProtoMySQL, "MariaDB", "10.11.6-MariaDB-0ubuntu0.24.04.1"}},
+		{"mysql host refused", mysqlPacket("\xffj\x04Host '172.17.0.1' is not allowed to connect to this MySQL server"), Fingerprint{ProtoMySQL, "MySQL", ""}},
+		{"other error packet", mysqlPacket("\xffj\x04Go away"), Fingerprint{}},
+		{"unterminated version", mysqlPacket("\x0a8.0.36"), Fingerprint{}},
+		{"length mismatch", append(mysqlPacket("\x0a8.0.36\x00"), "trailing"...), Fingerprint{}},
+		{"short", []byte("\x01\x00\x00"), Fingerprint{}},
+		{"text", []byte("hello\n"), Fingerprint{}},
+	}
+
+	for _, tt := range tests {
+		if got := parseBanner(tt.banner); got != tt.want {
+			t.Errorf("%s: parseBanner() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// serveConns runs handle for every connection to a local listener and
+// returns the listener's address
+func serveConns(t *testing.T, handle func(net.Conn)) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				handle(conn)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestFingerprintPostgres(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply string
+		want  Fingerprint
+	}{
+		{"ssl supported", "S", Fingerprint{ProtoPostgres, "PostgreSQL", ""}},
+		{"ssl not supported", "N", Fingerprint{ProtoPostgres, "PostgreSQL", ""}},
+		{"something else", "HTTP/1.1 400 Bad Request\r\n\r\n", Fingerprint{}},
+		{"closes", "", Fingerprint{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr := serveConns(t, func(conn net.Conn) {
+				request := make([]byte, 8)
+				if _, err := conn.Read(request); err != nil {
+					return
+				}
+				if binary.BigEndian.Uint32(request[0:4]) != 8 || binary.BigEndian.Uint32(request[4:8]) != 80877103 {
+					return // Not an SSLRequest
+				}
+				conn.Write([]byte(tt.reply))
+			})
+			if got := fingerprintPostgres(context.Background(), addr); got != tt.want {
+				t.Errorf("fingerprintPostgres() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// bulk encodes s as a RESP bulk string
+func bulk(s string) string {
+	return "$" + strconv.Itoa(len(s)) + "\r\n" + s + "\r\n"
+}
+
+func TestFingerprintRedis(t *testing.T) {
+	tests := []struct {
+		name       string
+		pong, info string
+		want       Fingerprint
+	}{
+		{"redis", "+PONG\r\n", bulk("# Server\r\nredis_version:7.2.4\r\nredis_mode:standalone\r\n"), Fingerprint{ProtoRedis, "Redis", "7.2.4"}},
+		{"valkey", "+PONG\r\n", bulk("# Server\r\nredis_version:7.2.4\r\nvalkey_version:8.0.1\r\n"), Fingerprint{ProtoRedis, "Valkey", "8.0.1"}},
+		{"info refused", "+PONG\r\n", "-ERR unknown command\r\n", Fingerprint{ProtoRedis, "Redis", ""}},
+		{"password required", "-NOAUTH Authentication required.\r\n", "", Fingerprint{ProtoRedis, "Redis", ""}},
+		{"not redis", "-ERR what?\r\n", "", Fingerprint{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr := serveConns(t, func(conn net.Conn) {
+				buf := make([]byte, 256)
+				for _, reply := range []string{tt.pong, tt.info} {
+					if _, err := conn.Read(buf); err != nil || reply == "" {
+						return
+					}
+					conn.Write([]byte(reply))
+				}
+			})
+			if got := fingerprintRedis(context.Background(), addr); got != tt.want {
+				t.Errorf("fingerprintRedis() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFingerprintPort(t *testing.T) {
+	ssh := serveConns(t, func(conn net.Conn) {
+		fmt.Fprint(conn, "SSH-2.0-OpenSSH_9.6p1\r\n")
+	})
+	postgres := serveConns(t, func(conn net.Conn) {
+		request := make([]byte, 8)
+		if n, _ := conn.Read(request); n == 8 && binary.BigEndian.Uint32(request[4:8]) == 80877103 {
+			conn.Write([]byte("N"))
+		}
+	})
+
+	tests := []struct {
+		addr string
+		want Fingerprint
+	}{
+		{ssh, Fingerprint{ProtoSSH, "SSH", "OpenSSH_9.6p1"}},
+		{postgres, Fingerprint{ProtoPostgres, "PostgreSQL", ""}},
+	}
+
+	for _, tt := range tests {
+		host, port, _ := net.SplitHostPort(tt.addr)
+		portNum, _ := strconv.Atoi(port)
+		if got := FingerprintPort(context.Background(), host, portNum); got != tt.want {
+			t.Errorf("FingerprintPort(%s) = %+v, want %+v", tt.addr, got, tt.want)
+		}
+	}
+}
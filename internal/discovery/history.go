@@ -0,0 +1,271 @@
+package discovery
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sighting is one stretch of time a port was held by the same service: the
+// same container, or the same command line
+type Sighting struct {
+	ServiceID      string    `json:"serviceId"`
+	Port           int       `json:"port"`
+	Protocol       string    `json:"protocol"`
+	Name           string    `json:"name"`
+	Process        string    `json:"process,omitempty"`
+	PID            int       `json:"pid,omitempty"` // Last PID seen; restarts within historyGap keep the sighting
+	Command        string    `json:"command,omitempty"`
+	User           string    `json:"user,omitempty"`
+	ProjectPath    string    `json:"projectPath,omitempty"`
+	Container      string    `json:"container,omitempty"`
+	Runtime        string    `json:"runtime,omitempty"`
+	Image          string    `json:"image,omitempty"`
+	ComposeProject string    `json:"composeProject,omitempty"`
+	ComposeService string    `json:"composeService,omitempty"`
+	Unit           string    `json:"unit,omitempty"` // systemd unit
+	UserUnit       bool      `json:"userUnit,omitempty"`
+	FirstSeen      time.Time `json:"firstSeen"`
+	LastSeen       time.Time `json:"lastSeen"`
+	Running        bool      `json:"running"`           // Whether the service still holds the port
+	Restart        string    `json:"restart,omitempty"` // Command that should start it again
+}
+
+// HistoryQuery selects sightings: those on Port (any port if 0) that overlap
+// Since..Until (unbounded where zero)
+type HistoryQuery struct {
+	Port  int
+	Since time.Time
+	Until time.Time
+}
+
+const (
+	historyGap           = 5 * time.Minute     // Longest a port can go unseen and still be the same sighting
+	historyRetention     = 30 * 24 * time.Hour // Sightings last seen before this are dropped
+	historyMaxSightings  = 5000                // Oldest sightings beyond this are dropped
+	historyFlushInterval = time.Minute         // How often last-seen times are written out
+)
+
+// identity tells sightings of a port apart: a different container or
+// command line on the same port starts a new sighting
+func (s *Sighting) identity() string {
+	if s.Container != "" {
+		return "container:" + s.Container
+	}
+	return "command:" + s.Command
+}
+
+// newSighting records what a service looks like now
+func newSighting(svc *Service, now time.Time) Sighting {
+	s := Sighting{
+		ServiceID:      svc.ID,
+		Port:           svc.Port,
+		Protocol:       svc.Protocol,
+		Name:           svc.Name,
+		Process:        svc.Process,
+		PID:            svc.PID,
+		Command:        svc.Command,
+		User:           svc.User,
+		ProjectPath:    svc.ProjectPath,
+		Container:      svc.Container,
+		Runtime:        svc.Runtime,
+		Image:          svc.Image,
+		ComposeProject: svc.ComposeProject,
+		ComposeService: svc.ComposeService,
+		FirstSeen:      now,
+		LastSeen:       now,
+	}
+	if svc.Unit != nil && svc.Unit.Container == "" {
+		s.Unit, s.UserUnit = svc.Unit.Name, svc.Unit.UserManager
+	}
+	s.Restart = restartHint(&s)
+	return s
+}
+
+// restartHint suggests a command that starts a stopped service again: its
+// compose service, container or systemd unit, or else its command line run
+// from its project
+func restartHint(s *Sighting) string {
+	cli := "docker"
+	if s.Runtime == RuntimePodman {
+		cli = "podman"
+	}
+	switch {
+	case s.ComposeService != "" && s.ProjectPath != "":
+		return "cd " + shellQuote(s.ProjectPath) + " && " + cli + " compose up -d " + shellQuote(s.ComposeService)
+	case s.Container != "":
+		return cli + " start " + shellQuote(s.Container)
+	case strings.HasSuffix(s.Unit, ".service") && !userManagerRe.MatchString(s.Unit):
+		if s.UserUnit {
+			return "systemctl --user start " + shellQuote(s.Unit)
+		}
+		return "sudo systemctl start " + shellQuote(s.Unit)
+	case s.Command != "" && s.ProjectPath != "":
+		return "cd " + shellQuote(s.ProjectPath) + " && " + s.Command
+	}
+	return s.Command
+}
+
+// shellQuote quotes s for a POSIX shell when it has anything but safe
+// characters
+func shellQuote(s string) string {
+	safe := s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("@%+=:,./_-~", r))
+	}) < 0
+	if safe {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// historyStore keeps the sightings of every service as JSON in the config
+// directory. New and ended sightings are written straight away; last-seen
+// times of running ones at most every historyFlushInterval.
+type historyStore struct {
+	path      string
+	mu        sync.Mutex
+	sightings []Sighting     // By first seen, oldest first
+	latest    map[string]int // Service ID -> index of its latest sighting
+	running   map[string]bool
+	savedAt   time.Time
+}
+
+// getHistoryPath returns the path to the port history file
+func getHistoryPath() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		configDir = os.Getenv("HOME")
+	}
+	return filepath.Join(configDir, "dev-machine-proxy", "port-history.json")
+}
+
+func newHistoryStore(path string) *historyStore {
+	s := &historyStore{path: path, running: make(map[string]bool)}
+	if err := s.load(); err != nil {
+		log.Printf("Warning: could not load port history from %s: %v", path, err)
+	}
+	s.indexLocked()
+	return s
+}
+
+func (s *historyStore) load() error {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return json.Unmarshal(data, &s.sightings)
+}
+
+// indexLocked rebuilds the latest-sighting index (caller must hold lock)
+func (s *historyStore) indexLocked() {
+	s.latest = make(map[string]int)
+	for i, sighting := range s.sightings {
+		if j, ok := s.latest[sighting.ServiceID]; !ok || !sighting.LastSeen.Before(s.sightings[j].LastSeen) {
+			s.latest[sighting.ServiceID] = i
+		}
+	}
+}
+
+// pruneLocked applies the retention policy (caller must hold lock)
+func (s *historyStore) pruneLocked(now time.Time) {
+	kept := s.sightings[:0]
+	for _, sighting := range s.sightings {
+		if now.Sub(sighting.LastSeen) <= historyRetention {
+			kept = append(kept, sighting)
+		}
+	}
+	if len(kept) > historyMaxSightings {
+		kept = kept[len(kept)-historyMaxSightings:]
+	}
+	s.sightings = kept
+	s.indexLocked()
+}
+
+func (s *historyStore) saveLocked(now time.Time) error {
+	data, err := json.MarshalIndent(s.sightings, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	s.savedAt = now
+	return os.WriteFile(s.path, data, 0644)
+}
+
+// record notes which services are listening now, extending their sightings
+// or starting new ones
+func (s *historyStore) record(services []Service, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	changed := false
+	running := make(map[string]bool, len(services))
+	for i := range services {
+		svc := &services[i]
+		running[svc.ID] = true
+		next := newSighting(svc, now)
+
+		if j, ok := s.latest[svc.ID]; ok {
+			last := &s.sightings[j]
+			if last.identity() == next.identity() && now.Sub(last.LastSeen) <= historyGap {
+				next.FirstSeen = last.FirstSeen
+				*last = next
+				continue
+			}
+		}
+		s.sightings = append(s.sightings, next)
+		s.latest[svc.ID] = len(s.sightings) - 1
+		changed = true
+	}
+	for id := range s.running {
+		if !running[id] {
+			changed = true // Stopped
+		}
+	}
+	s.running = running
+
+	if changed || now.Sub(s.savedAt) >= historyFlushInterval {
+		s.pruneLocked(now)
+		if err := s.saveLocked(now); err != nil {
+			log.Printf("Warning: could not save port history: %v", err)
+		}
+	}
+}
+
+// list returns the sightings matching q, most recently seen first
+func (s *historyStore) list(q HistoryQuery) []Sighting {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := []Sighting{}
+	for i, sighting := range s.sightings {
+		if q.Port != 0 && sighting.Port != q.Port {
+			continue
+		}
+		if !q.Since.IsZero() && sighting.LastSeen.Before(q.Since) {
+			continue
+		}
+		if !q.Until.IsZero() && sighting.FirstSeen.After(q.Until) {
+			continue
+		}
+		sighting.Running = s.running[sighting.ServiceID] && s.latest[sighting.ServiceID] == i
+		result = append(result, sighting)
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].LastSeen.After(result[j].LastSeen) })
+	return result
+}
+
+// History returns the recorded sightings of services matching q, most
+// recently seen first
+func (d *Discoverer) History(q HistoryQuery) []Sighting {
+	return d.history.list(q)
+}
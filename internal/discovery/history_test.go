@@ -0,0 +1,144 @@
+package discovery
+
+import (
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"web", "web"},
+		{"/home/dev/my-app_2", "/home/dev/my-app_2"},
+		{"user@1000.service", "user@1000.service"},
+		{"", "''"},
+		{"/home/dev/My App", "'/home/dev/My App'"},
+		{"it's", `'it'\''s'`},
+		{"$(rm -rf ~)", "'$(rm -rf ~)'"},
+		{"a;b", "'a;b'"},
+	}
+
+	for _, tt := range tests {
+		if got := shellQuote(tt.in); got != tt.want {
+			t.Errorf("shellQuote(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRestartHint(t *testing.T) {
+	tests := []struct {
+		name     string
+		sighting Sighting
+		want     string
+	}{
+		{"compose service", Sighting{ComposeService: "db", ProjectPath: "/home/dev/My Shop", Container: "shop-db-1"},
+			"cd '/home/dev/My Shop' && docker compose up -d db"},
+		{"podman compose", Sighting{ComposeService: "db", ProjectPath: "/src/shop", Runtime: RuntimePodman},
+			"cd /src/shop && podman compose up -d db"},
+		{"compose without a project", Sighting{ComposeService: "db", Container: "shop-db-1"}, "docker start shop-db-1"},
+		{"container", Sighting{Container: "redis", Runtime: RuntimePodman}, "podman start redis"},
+		{"system unit", Sighting{Unit: "postgresql.service", Command: "/usr/lib/postgresql/16/bin/postgres"}, "sudo systemctl start postgresql.service"},
+		{"user unit", Sighting{Unit: "api.service", UserUnit: true}, "systemctl --user start api.service"},
+		{"user manager", Sighting{Unit: "user@1000.service", Command: "node server.js", ProjectPath: "/src/api"}, "cd /src/api && node server.js"},
+		{"scope", Sighting{Unit: "session-2.scope", Command: "vite"}, "vite"},
+		{"command in a project", Sighting{Command: "npm run dev", ProjectPath: "/src/web"}, "cd /src/web && npm run dev"},
+		{"command", Sighting{Command: "python -m http.server"}, "python -m http.server"},
+		{"nothing known", Sighting{}, ""},
+	}
+
+	for _, tt := range tests {
+		if got := restartHint(&tt.sighting); got != tt.want {
+			t.Errorf("%s: restartHint() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHistoryRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "port-history.json")
+	s := newHistoryStore(path)
+	start := time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) time.Time { return start.Add(d) }
+	web := func(pid int, command string) Service {
+		return Service{ID: "tcp-3000", Port: 3000, Protocol: "tcp", Name: "web", PID: pid, Command: command}
+	}
+
+	type span struct {
+		first, last time.Duration
+		pid         int
+		running     bool
+	}
+	steps := []struct {
+		name     string
+		at       time.Duration
+		services []Service
+		want     []span // Most recently seen first
+	}{
+		{"first seen", 0, []Service{web(10, "npm run dev")}, []span{{0, 0, 10, true}}},
+		{"restart keeps the sighting", time.Minute, []Service{web(11, "npm run dev")}, []span{{0, time.Minute, 11, true}}},
+		{"stopped", 2 * time.Minute, nil, []span{{0, time.Minute, 11, false}}},
+		{"back within the gap", time.Minute + historyGap, []Service{web(12, "npm run dev")}, []span{{0, time.Minute + historyGap, 12, true}}},
+		{"back after the gap", 2*time.Minute + 2*historyGap, []Service{web(13, "npm run dev")}, []span{
+			{2*time.Minute + 2*historyGap, 2*time.Minute + 2*historyGap, 13, true},
+			{0, time.Minute + historyGap, 12, false},
+		}},
+		{"another command", 3*time.Minute + 2*historyGap, []Service{web(14, "vite")}, []span{
+			{3*time.Minute + 2*historyGap, 3*time.Minute + 2*historyGap, 14, true},
+			{2*time.Minute + 2*historyGap, 2*time.Minute + 2*historyGap, 13, false},
+			{0, time.Minute + historyGap, 12, false},
+		}},
+	}
+
+	for _, step := range steps {
+		s.record(step.services, at(step.at))
+		var got []span
+		for _, sighting := range s.list(HistoryQuery{}) {
+			got = append(got, span{sighting.FirstSeen.Sub(start), sighting.LastSeen.Sub(start), sighting.PID, sighting.Running})
+		}
+		if !reflect.DeepEqual(got, step.want) {
+			t.Fatalf("%s: sightings = %+v, want %+v", step.name, got, step.want)
+		}
+	}
+
+	if got := s.list(HistoryQuery{Port: 8080}); len(got) != 0 {
+		t.Errorf("list(port 8080) = %d sightings, want none", len(got))
+	}
+	if got := s.list(HistoryQuery{Until: at(time.Minute)}); len(got) != 1 || got[0].PID != 12 {
+		t.Errorf("list(until +1m) = %+v, want the first sighting", got)
+	}
+	if got := s.list(HistoryQuery{Since: at(2*time.Minute + 2*historyGap)}); len(got) != 2 {
+		t.Errorf("list(since the second sighting) = %d sightings, want 2", len(got))
+	}
+
+	// Changes are saved straight away
+	if got := newHistoryStore(path).list(HistoryQuery{}); len(got) != 3 || got[0].Command != "vite" {
+		t.Errorf("reloaded sightings = %+v", got)
+	}
+}
+
+func TestHistoryPrune(t *testing.T) {
+	now := time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC)
+	s := newHistoryStore(filepath.Join(t.TempDir(), "port-history.json"))
+	for i := range historyMaxSightings + 3 {
+		seen := now.Add(-time.Duration(historyMaxSightings+3-i) * time.Minute)
+		if i == 0 {
+			seen = now.Add(-historyRetention - time.Second)
+		}
+		s.sightings = append(s.sightings, Sighting{ServiceID: "tcp-" + strconv.Itoa(i), FirstSeen: seen, LastSeen: seen})
+	}
+
+	s.pruneLocked(now)
+	if len(s.sightings) != historyMaxSightings {
+		t.Fatalf("kept %d sightings, want %d", len(s.sightings), historyMaxSightings)
+	}
+	// One expired, and the two oldest of the rest over the cap
+	if first := s.sightings[0].ServiceID; first != "tcp-3" {
+		t.Errorf("oldest kept sighting = %s, want tcp-3", first)
+	}
+	if i, ok := s.latest["tcp-3"]; !ok || i != 0 {
+		t.Errorf("latest index not rebuilt: %v, %v", i, ok)
+	}
+}
@@ -0,0 +1,354 @@
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Icon is an image fetched from a service to show on its card
+type Icon struct {
+	Data        []byte `json:"-"`
+	ContentType string `json:"contentType"`
+	Source      string `json:"source"` // URL it was fetched from
+	Hash        string `json:"hash"`   // Short SHA-256 digest, matched by favicon rules
+}
+
+// ErrNoIcon is returned for services without a cached icon
+var ErrNoIcon = errors.New("no icon")
+
+// maxIconSize bounds how much of an icon is downloaded
+const maxIconSize = 512 * 1024
+
+// maxIconAttempts bounds how many candidate icons are fetched per service
+const maxIconAttempts = 4
+
+// iconRef is a candidate icon declared by a page or manifest
+type iconRef struct {
+	url  string
+	size int // Larger is better; SVGs count as large
+}
+
+var (
+	linkTagRe  = regexp.MustCompile(`(?is)<link\b[^>]*>`)
+	linkAttrRe = regexp.MustCompile(`(?is)\b(rel|href|sizes|type)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+)
+
+// FetchIcon finds the best icon for a probed HTTP server: the largest of the
+// <link rel="icon"> tags on its front page and the icons in its web app
+// manifest, falling back to /favicon.ico. Only responses that are images are
+// accepted, so single-page apps answering every path with HTML don't count.
+// Icons and manifests elsewhere than the server's own host:port are skipped,
+// so a page can't make discovery fetch arbitrary URLs.
+func FetchIcon(ctx context.Context, probe HTTPProbeResult) (Icon, bool) {
+	if !probe.IsHTTP || probe.BaseURL == "" {
+		return Icon{}, false
+	}
+	base, err := url.Parse(probe.BaseURL + "/")
+	if err != nil {
+		return Icon{}, false
+	}
+
+	refs, manifest := pageIcons(base, probe.Body)
+	if manifest == "" || !onHost(base, manifest) {
+		manifest = base.ResolveReference(&url.URL{Path: "/manifest.json"}).String()
+	}
+	refs = append(refs, manifestIcons(ctx, manifest)...)
+	sort.SliceStable(refs, func(i, j int) bool { return refs[i].size > refs[j].size })
+	refs = append(refs, iconRef{url: base.ResolveReference(&url.URL{Path: "/favicon.ico"}).String(), size: 16})
+
+	seen := make(map[string]bool)
+	attempts := 0
+	for _, ref := range refs {
+		if attempts == maxIconAttempts || ctx.Err() != nil {
+			break
+		}
+		if seen[ref.url] || !onHost(base, ref.url) {
+			continue
+		}
+		seen[ref.url] = true
+		attempts++
+		if icon, ok := fetchIconURL(ctx, ref.url); ok {
+			return icon, true
+		}
+	}
+	return Icon{}, false
+}
+
+// onHost reports whether target is an http(s) URL on base's host and port
+func onHost(base *url.URL, target string) bool {
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.User != nil {
+		return false
+	}
+	return strings.EqualFold(u.Hostname(), base.Hostname()) && effectivePort(u) == effectivePort(base)
+}
+
+// effectivePort is a URL's port, or its scheme's default port
+func effectivePort(u *url.URL) string {
+	if port := u.Port(); port != "" {
+		return port
+	}
+	if u.Scheme == "https" {
+		return "443"
+	}
+	return "80"
+}
+
+// pageIcons returns the icons linked from an HTML page, and its manifest URL
+func pageIcons(base *url.URL, body string) ([]iconRef, string) {
+	var refs []iconRef
+	var manifest string
+	for _, tag := range linkTagRe.FindAllString(body, -1) {
+		attrs := make(map[string]string)
+		for _, m := range linkAttrRe.FindAllStringSubmatch(tag, -1) {
+			attrs[strings.ToLower(m[1])] = m[2] + m[3] + m[4]
+		}
+		href := strings.TrimSpace(attrs["href"])
+		if href == "" || strings.HasPrefix(href, "data:") {
+			continue
+		}
+		u, err := base.Parse(href)
+		if err != nil {
+			continue
+		}
+
+		rels := strings.Fields(strings.ToLower(attrs["rel"]))
+		for _, rel := range rels {
+			switch rel {
+			case "manifest":
+				manifest = u.String()
+			case "icon", "apple-touch-icon":
+				refs = append(refs, iconRef{url: u.String(), size: iconSize(attrs["sizes"], attrs["type"], u.Path, 32)})
+			default:
+				continue
+			}
+			break
+		}
+	}
+	return refs, manifest
+}
+
+// manifestIcons reads the icons listed in a web app manifest
+func manifestIcons(ctx context.Context, manifestURL string) []iconRef {
+	data, _, ok := fetchLimited(ctx, manifestURL)
+	if !ok {
+		return nil
+	}
+	var manifest struct {
+		Icons []struct {
+			Src   string `json:"src"`
+			Sizes string `json:"sizes"`
+			Type  string `json:"type"`
+		} `json:"icons"`
+	}
+	if json.Unmarshal(data, &manifest) != nil {
+		return nil
+	}
+
+	base, err := url.Parse(manifestURL) // Icon paths are relative to the manifest
+	if err != nil {
+		return nil
+	}
+	var refs []iconRef
+	for _, icon := range manifest.Icons {
+		if icon.Src == "" || strings.HasPrefix(icon.Src, "data:") {
+			continue
+		}
+		u, err := base.Parse(icon.Src)
+		if err != nil {
+			continue
+		}
+		refs = append(refs, iconRef{url: u.String(), size: iconSize(icon.Sizes, icon.Type, u.Path, 48)})
+	}
+	return refs
+}
+
+// iconSize reads the largest of a sizes attribute such as "16x16 32x32".
+// SVGs and "any" rank as large; undeclared sizes get fallback.
+func iconSize(sizes, mimeType, path string, fallback int) int {
+	if strings.Contains(mimeType, "svg") || strings.HasSuffix(strings.ToLower(path), ".svg") {
+		return 1024
+	}
+	best := 0
+	for _, s := range strings.Fields(strings.ToLower(sizes)) {
+		if s == "any" {
+			return 1024
+		}
+		w, _, _ := strings.Cut(s, "x")
+		if n, err := strconv.Atoi(w); err == nil && n > best {
+			best = n
+		}
+	}
+	if best == 0 {
+		return fallback
+	}
+	return best
+}
+
+// fetchIconURL downloads an icon, accepting only images
+func fetchIconURL(ctx context.Context, iconURL string) (Icon, bool) {
+	data, header, ok := fetchLimited(ctx, iconURL)
+	if !ok || len(data) == 0 {
+		return Icon{}, false
+	}
+
+	contentType := imageType(data, header.Get("Content-Type"))
+	if contentType == "" {
+		return Icon{}, false
+	}
+	return Icon{Data: data, ContentType: contentType, Source: iconURL, Hash: iconHash(data)}, true
+}
+
+// fetchLimited GETs a URL with the probe client, returning the body of a 200
+// response no larger than maxIconSize
+func fetchLimited(ctx context.Context, target string) ([]byte, http.Header, bool) {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, nil, false
+	}
+	resp, err := probeClient.Do(req)
+	if err != nil {
+		return nil, nil, false
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, false
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxIconSize+1))
+	if err != nil || len(data) > maxIconSize {
+		return nil, nil, false
+	}
+	return data, resp.Header, true
+}
+
+// imageType returns the image content type of data, trusting the server's
+// header only when it names an image. SVGs aren't recognised by sniffing.
+func imageType(data []byte, declared string) string {
+	declared, _, _ = strings.Cut(declared, ";")
+	declared = strings.TrimSpace(strings.ToLower(declared))
+	sniffed := http.DetectContentType(data)
+
+	switch {
+	case strings.HasPrefix(sniffed, "image/"):
+		return sniffed
+	case bytes.Contains(data[:min(len(data), 1024)], []byte("<svg")):
+		return "image/svg+xml"
+	case strings.HasPrefix(declared, "image/") && declared != "image/svg+xml" && !strings.HasPrefix(sniffed, "text/"):
+		return declared // Formats DetectContentType doesn't know, e.g. AVIF
+	}
+	return ""
+}
+
+// iconHash is a short SHA-256 digest of an icon, as used by favicon rules
+func iconHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// iconPath returns the URL the dashboard serves a service's icon from. The
+// hash changes the URL when the icon does, so browsers can cache it.
+func iconPath(serviceID, hash string) string {
+	return fmt.Sprintf("/api/services/%s/icon?v=%s", url.PathEscape(serviceID), hash)
+}
+
+// iconStore caches icons on disk in the config directory, one image plus a
+// JSON description per service ID
+type iconStore struct {
+	dir string
+}
+
+// getIconsDir returns the directory service icons are cached in
+func getIconsDir() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		configDir = os.Getenv("HOME")
+	}
+	return filepath.Join(configDir, "dev-machine-proxy", "icons")
+}
+
+func newIconStore(dir string) *iconStore {
+	return &iconStore{dir: dir}
+}
+
+// paths returns the image and description files for a service ID. IDs are
+// made of the protocol, port and container name, which are safe file names.
+func (s *iconStore) paths(id string) (string, string, bool) {
+	if id == "" || strings.ContainsAny(id, `/\`) || strings.HasPrefix(id, ".") {
+		return "", "", false
+	}
+	base := filepath.Join(s.dir, id)
+	return base + ".img", base + ".json", true
+}
+
+func (s *iconStore) save(id string, icon Icon) error {
+	imgPath, metaPath, ok := s.paths(id)
+	if !ok {
+		return fmt.Errorf("invalid service ID %q", id)
+	}
+	meta, err := json.MarshalIndent(icon, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(imgPath, icon.Data, 0644); err != nil {
+		return err
+	}
+	return os.WriteFile(metaPath, meta, 0644)
+}
+
+func (s *iconStore) remove(id string) {
+	if imgPath, metaPath, ok := s.paths(id); ok {
+		os.Remove(imgPath)
+		os.Remove(metaPath)
+	}
+}
+
+func (s *iconStore) get(id string) (Icon, error) {
+	imgPath, metaPath, ok := s.paths(id)
+	if !ok {
+		return Icon{}, ErrNoIcon
+	}
+	var icon Icon
+	meta, err := os.ReadFile(metaPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return Icon{}, ErrNoIcon
+		}
+		return Icon{}, err
+	}
+	if err := json.Unmarshal(meta, &icon); err != nil {
+		return Icon{}, err
+	}
+	if icon.Data, err = os.ReadFile(imgPath); err != nil {
+		if os.IsNotExist(err) {
+			return Icon{}, ErrNoIcon
+		}
+		return Icon{}, err
+	}
+	return icon, nil
+}
+
+// ServiceIcon returns the cached icon of a service
+func (d *Discoverer) ServiceIcon(id string) (Icon, error) {
+	return d.icons.get(id)
+}
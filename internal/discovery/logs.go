@@ -0,0 +1,168 @@
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// LogLine is one line of container output
+type LogLine struct {
+	Container string    `json:"container"`
+	Stream    string    `json:"stream"` // stdout, stderr
+	Time      time.Time `json:"time"`
+	Text      string    `json:"line"`
+}
+
+// LogOptions selects which part of the logs to stream
+type LogOptions struct {
+	Since string // Unix timestamp, RFC 3339 time or Go duration such as "10m"
+	Tail  string // Number of lines from the end, or "all"
+}
+
+// StreamLogs follows the stdout and stderr of one or more known containers,
+// sending timestamped lines to out until ctx is cancelled or every container's
+// log stream ends
+func (d *Discoverer) StreamLogs(ctx context.Context, containers []string, opts LogOptions, out chan<- LogLine) error {
+	known := d.knownContainers(ctx)
+	trackers := make([]*DockerTracker, len(containers))
+	ids := make([]string, len(containers))
+	for i, name := range containers {
+		if trackers[i], ids[i] = known.lookup(name); trackers[i] == nil {
+			return fmt.Errorf("%w: %s", ErrUnknownContainer, name)
+		}
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(containers))
+	for i, name := range containers {
+		wg.Add(1)
+		go func(t *DockerTracker, id, name string) {
+			defer wg.Done()
+			if err := t.streamLogs(ctx, id, name, opts, out); err != nil && ctx.Err() == nil {
+				errs <- fmt.Errorf("%s: %w", name, err)
+			}
+		}(trackers[i], ids[i], name)
+	}
+	wg.Wait()
+	close(errs)
+
+	return <-errs // First error, or nil
+}
+
+// StackContainers returns the names of a compose project's containers. host
+// selects the runtime as for ComposeAction.
+func (d *Discoverer) StackContainers(ctx context.Context, host, project string) ([]string, error) {
+	stack, err := d.findStack(ctx, host, project)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(stack.Containers))
+	for i, c := range stack.Containers {
+		names[i] = c.Name
+	}
+	return names, nil
+}
+
+// streamLogs follows the logs of the container with the given ID, labelling
+// lines with name
+func (t *DockerTracker) streamLogs(ctx context.Context, id, name string, opts LogOptions, out chan<- LogLine) error {
+	cli, err := t.newClient()
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	info, err := cli.ContainerInspect(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	rc, err := cli.ContainerLogs(ctx, id, container.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Timestamps: true,
+		Follow:     true,
+		Since:      opts.Since,
+		Tail:       opts.Tail,
+	})
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	stdout := &logLineWriter{ctx: ctx, container: name, stream: "stdout", out: out}
+	stderr := &logLineWriter{ctx: ctx, container: name, stream: "stderr", out: out}
+
+	// TTY containers send a single raw stream; the rest are multiplexed
+	if info.Config != nil && info.Config.Tty {
+		_, err = io.Copy(stdout, rc)
+	} else {
+		_, err = stdcopy.StdCopy(stdout, stderr, rc)
+	}
+	stdout.flush()
+	stderr.flush()
+
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+// logLineWriter splits a log stream into LogLines, parsing the timestamp
+// Docker prefixes to each line
+type logLineWriter struct {
+	ctx       context.Context
+	container string
+	stream    string
+	out       chan<- LogLine
+	partial   []byte
+}
+
+func (w *logLineWriter) Write(p []byte) (int, error) {
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		line := string(w.partial[:i])
+		w.partial = w.partial[i+1:]
+		if err := w.send(line); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (w *logLineWriter) flush() {
+	if len(w.partial) > 0 {
+		w.send(string(w.partial))
+		w.partial = nil
+	}
+}
+
+func (w *logLineWriter) send(raw string) error {
+	line := LogLine{Container: w.container, Stream: w.stream}
+	ts, text, ok := strings.Cut(strings.TrimRight(raw, "\r"), " ")
+	if parsed, err := time.Parse(time.RFC3339Nano, ts); ok && err == nil {
+		line.Time = parsed
+		line.Text = text
+	} else {
+		line.Text = raw
+	}
+
+	select {
+	case w.out <- line:
+		return nil
+	case <-w.ctx.Done():
+		return w.ctx.Err()
+	}
+}
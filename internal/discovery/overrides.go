@@ -0,0 +1,403 @@
+package discovery
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Override is a user's correction to discovered services. Port, Container
+// and Project select the services it applies to: at least one must be set,
+// and every one that is set must match. A port on its own only selects host
+// ports, not internal container ports.
+type Override struct {
+	ID          string `json:"id"`
+	Port        int    `json:"port,omitempty"`      // Host port, or the container port of an internal service
+	Container   string `json:"container,omitempty"` // Container name
+	Project     string `json:"project,omitempty"`   // Project path
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+	Icon        string `json:"icon,omitempty"`    // Emoji or image URL
+	Hidden      bool   `json:"hidden,omitempty"`  // Hide noise such as language servers
+	Pinned      bool   `json:"pinned,omitempty"`  // Show at the top of the list
+	URLPath     string `json:"urlPath,omitempty"` // Launch path, e.g. /admin
+	Scheme      string `json:"scheme,omitempty"`  // http or https
+}
+
+// ErrUnknownOverride is returned when updating or deleting a missing override
+var ErrUnknownOverride = errors.New("unknown override")
+
+// ErrInvalidOverride is returned for overrides that select nothing or set an
+// unsupported scheme, icon or URL path
+var ErrInvalidOverride = errors.New("invalid override")
+
+// maxIconText is the longest text icon, in runes: enough for emoji joined
+// into one glyph, such as a family or a flag
+const maxIconText = 16
+
+// validate checks that an override selects something and sets a valid
+// scheme, and normalizes its icon and URL path
+func (o *Override) validate() error {
+	if o.Port == 0 && o.Container == "" && o.Project == "" {
+		return fmt.Errorf("%w: needs a port, container or project", ErrInvalidOverride)
+	}
+	if o.Scheme != "" && o.Scheme != "http" && o.Scheme != "https" {
+		return fmt.Errorf("%w: scheme must be http or https, not %q", ErrInvalidOverride, o.Scheme)
+	}
+	icon, err := normalizeIcon(o.Icon)
+	if err != nil {
+		return fmt.Errorf("%w: icon: %v", ErrInvalidOverride, err)
+	}
+	path, err := normalizeURLPath(o.URLPath)
+	if err != nil {
+		return fmt.Errorf("%w: urlPath: %v", ErrInvalidOverride, err)
+	}
+	o.Icon, o.URLPath = icon, path
+	return nil
+}
+
+// normalizeIcon accepts an emoji or other short text, or an http(s) or
+// root-relative image URL, which is returned re-encoded
+func normalizeIcon(icon string) (string, error) {
+	icon = strings.TrimSpace(icon)
+	if icon == "" {
+		return "", nil
+	}
+	if !strings.ContainsAny(icon, "/:") {
+		if utf8.RuneCountInString(icon) > maxIconText || strings.IndexFunc(icon, unicode.IsControl) >= 0 {
+			return "", fmt.Errorf("must be an emoji, short text or image URL")
+		}
+		return icon, nil
+	}
+
+	u, err := url.Parse(icon)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case (u.Scheme == "http" || u.Scheme == "https") && u.Host != "":
+	case u.Scheme == "" && u.Host == "" && strings.HasPrefix(u.Path, "/"):
+	default:
+		return "", fmt.Errorf("image URL must be http(s) or start with /")
+	}
+	return u.String(), nil
+}
+
+// normalizeURLPath accepts a path with an optional query and fragment, and
+// returns it re-encoded with a leading slash
+func normalizeURLPath(path string) (string, error) {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return "", nil
+	}
+	u, err := url.Parse("/" + strings.TrimLeft(path, "/"))
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "" || u.Host != "" || u.Opaque != "" {
+		return "", fmt.Errorf("must be a path such as /admin")
+	}
+	query, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		return "", err
+	}
+	u.RawPath = ""
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// matches reports whether the override selects svc
+func (o *Override) matches(svc *Service) bool {
+	if o.Port != 0 && (svc.Port != o.Port || (o.Container == "" && svc.Exposure == ExposureInternal)) {
+		return false
+	}
+	if o.Container != "" && svc.Container != o.Container {
+		return false
+	}
+	if o.Project != "" && svc.ProjectPath != o.Project {
+		return false
+	}
+	return true
+}
+
+// specificity orders overrides so narrower ones are applied last and win:
+// more keys beats fewer, then container beats port beats project
+func (o *Override) specificity() int {
+	s := 0
+	if o.Project != "" {
+		s += 1
+	}
+	if o.Port != 0 {
+		s += 2
+	}
+	if o.Container != "" {
+		s += 4
+	}
+	return s
+}
+
+// describe names what the override is keyed by, for provenance
+func (o *Override) describe() string {
+	var keys []string
+	if o.Container != "" {
+		keys = append(keys, "container "+o.Container)
+	}
+	if o.Port != 0 {
+		keys = append(keys, fmt.Sprintf("port %d", o.Port))
+	}
+	if o.Project != "" {
+		keys = append(keys, "project "+o.Project)
+	}
+	return "your override for " + strings.Join(keys, ", ")
+}
+
+// apply writes the override's settings onto svc
+func (o *Override) apply(svc *Service) {
+	prov := Provenance{Source: "override", Priority: PriorityOverride, Confidence: 1, Reason: o.describe()}
+	if svc.Provenance == nil {
+		svc.Provenance = make(map[Field]Provenance)
+	}
+
+	if o.Name != "" {
+		svc.Name = o.Name
+		svc.Provenance[FieldName] = prov
+	}
+	if o.Description != "" {
+		svc.Description = o.Description
+		svc.Provenance[FieldDescription] = prov
+	}
+	if o.Icon != "" {
+		svc.Icon = o.Icon
+		svc.Provenance[FieldIcon] = prov
+	}
+	if o.Scheme != "" || o.URLPath != "" {
+		if u := overrideURL(svc, o.Scheme, o.URLPath); u != "" {
+			svc.URL = u
+			svc.Provenance[FieldURL] = prov
+			if o.Scheme != "" {
+				svc.IsHTTP = true // The user says it speaks HTTP, so the proxy may forward to it
+			}
+		}
+	}
+	svc.Hidden = svc.Hidden || o.Hidden
+	svc.Pinned = svc.Pinned || o.Pinned
+	svc.Override = o.ID
+}
+
+// overrideURL replaces the scheme and/or path of a service's URL. Services
+// without a URL only get one when a scheme is given.
+func overrideURL(svc *Service, scheme, path string) string {
+	base := svc.URL
+	if base == "" {
+		if scheme == "" {
+			return ""
+		}
+		base = "http://" + net.JoinHostPort(DialHost(svc.BindAddresses), strconv.Itoa(svc.Port))
+	}
+
+	u, err := url.Parse(base)
+	if err != nil {
+		return ""
+	}
+	if scheme != "" {
+		u.Scheme = scheme
+	}
+	if path != "" {
+		ref, err := url.Parse(path) // Normalized by validate
+		if err != nil {
+			return ""
+		}
+		u.Path, u.RawPath, u.RawQuery, u.Fragment = ref.Path, "", ref.Query().Encode(), ref.Fragment
+	}
+	return u.String()
+}
+
+// overrideStore persists overrides as JSON in the config directory
+type overrideStore struct {
+	path      string
+	mu        sync.RWMutex
+	overrides []Override
+}
+
+// getOverridesPath returns the path to the service overrides file
+func getOverridesPath() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		configDir = os.Getenv("HOME")
+	}
+	return filepath.Join(configDir, "dev-machine-proxy", "service-overrides.json")
+}
+
+func newOverrideStore(path string) *overrideStore {
+	s := &overrideStore{path: path}
+	if err := s.load(); err != nil {
+		log.Printf("Warning: could not load service overrides from %s: %v", path, err)
+	}
+	return s
+}
+
+func (s *overrideStore) load() error {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	var overrides []Override
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return err
+	}
+
+	// Overrides saved before icons and paths were checked are held to the
+	// same rules as new ones
+	for _, o := range overrides {
+		if err := o.validate(); err != nil {
+			log.Printf("Warning: skipping service override %s: %v", o.ID, err)
+			continue
+		}
+		s.overrides = append(s.overrides, o)
+	}
+	return nil
+}
+
+func (s *overrideStore) saveLocked() error {
+	data, err := json.MarshalIndent(s.overrides, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, data, 0644)
+}
+
+func (s *overrideStore) list() []Override {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Override{}, s.overrides...)
+}
+
+func (s *overrideStore) add(o Override) (Override, error) {
+	if err := o.validate(); err != nil {
+		return Override{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o.ID = time.Now().Format("20060102150405.000000000")
+	s.overrides = append(s.overrides, o)
+	if err := s.saveLocked(); err != nil {
+		return Override{}, err
+	}
+	return o, nil
+}
+
+func (s *overrideStore) update(o Override) error {
+	if err := o.validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.overrides {
+		if s.overrides[i].ID == o.ID {
+			s.overrides[i] = o
+			return s.saveLocked()
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrUnknownOverride, o.ID)
+}
+
+func (s *overrideStore) remove(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.overrides {
+		if s.overrides[i].ID == id {
+			s.overrides = append(s.overrides[:i], s.overrides[i+1:]...)
+			return s.saveLocked()
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrUnknownOverride, id)
+}
+
+// apply returns a copy of services with the overrides applied, broadest
+// first so the most specific override has the last word
+func (s *overrideStore) apply(services []Service) []Service {
+	overrides := s.list()
+	sort.SliceStable(overrides, func(i, j int) bool {
+		return overrides[i].specificity() < overrides[j].specificity()
+	})
+
+	result := make([]Service, len(services))
+	copy(result, services)
+	if len(overrides) == 0 {
+		return result
+	}
+
+	for i := range result {
+		svc := &result[i]
+		svc.Provenance = copyProvenance(svc.Provenance)
+		for j := range overrides {
+			if overrides[j].matches(svc) {
+				overrides[j].apply(svc)
+			}
+		}
+	}
+	return result
+}
+
+// copyProvenance keeps overrides from writing into the map shared with the
+// discovered services
+func copyProvenance(p map[Field]Provenance) map[Field]Provenance {
+	c := make(map[Field]Provenance, len(p))
+	for k, v := range p {
+		c[k] = v
+	}
+	return c
+}
+
+// Overrides returns the saved per-service overrides
+func (d *Discoverer) Overrides() []Override {
+	return d.overrides.list()
+}
+
+// AddOverride saves a new override and applies it to the current services
+func (d *Discoverer) AddOverride(o Override) (Override, error) {
+	saved, err := d.overrides.add(o)
+	if err != nil {
+		return Override{}, err
+	}
+	d.reapplyOverrides()
+	return saved, nil
+}
+
+// UpdateOverride replaces the override with the same ID
+func (d *Discoverer) UpdateOverride(o Override) error {
+	if err := d.overrides.update(o); err != nil {
+		return err
+	}
+	d.reapplyOverrides()
+	return nil
+}
+
+// DeleteOverride removes an override
+func (d *Discoverer) DeleteOverride(id string) error {
+	if err := d.overrides.remove(id); err != nil {
+		return err
+	}
+	d.reapplyOverrides()
+	return nil
+}
@@ -0,0 +1,106 @@
+package discovery
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalizeIcon(t *testing.T) {
+	tests := []struct {
+		icon, want string
+		ok         bool
+	}{
+		{"", "", true},
+		{"💳", "💳", true},
+		{" 🇳🇱 ", "🇳🇱", true},
+		{"👨‍👩‍👧‍👦", "👨‍👩‍👧‍👦", true},
+		{"DB", "DB", true},
+		{"https://example.com/logo.png", "https://example.com/logo.png", true},
+		{"/static/logo.svg", "/static/logo.svg", true},
+		{"/icons/my logo.png", "/icons/my%20logo.png", true},
+		{`/x" onerror=alert(1) x="`, "/x%22%20onerror=alert%281%29%20x=%22", true},
+		{"/x'><script>", "/x%27%3E%3Cscript%3E", true},
+		{"javascript:alert(1)", "", false},
+		{"data:image/svg+xml,<svg onload=alert(1)>", "", false},
+		{"ftp://example.com/logo.png", "", false},
+		{"logo.png", "logo.png", true}, // No slash or colon: taken as text
+		{"this is not an emoji at all", "", false},
+		{"a\nb", "", false},
+	}
+	for _, tt := range tests {
+		got, err := normalizeIcon(tt.icon)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("normalizeIcon(%q) = %q, %v; want %q, ok %v", tt.icon, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestNormalizeURLPath(t *testing.T) {
+	tests := []struct {
+		path, want string
+		ok         bool
+	}{
+		{"", "", true},
+		{"admin", "/admin", true},
+		{"/admin/", "/admin/", true},
+		{"/search?q=a b&x=1#top", "/search?q=a+b&x=1#top", true},
+		{"/x?a=')+alert(1)//", "/x?a=%27%29+alert%281%29%2F%2F", true},
+		{"/x?a=1;b=2", "", false},
+		{`/x#'"`, "/x#%27%22", true},
+		{"//evil.example/x", "/evil.example/x", true}, // Never a different host
+		{"/%zz", "", false},
+	}
+	for _, tt := range tests {
+		got, err := normalizeURLPath(tt.path)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("normalizeURLPath(%q) = %q, %v; want %q, ok %v", tt.path, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestOverrideURL(t *testing.T) {
+	web := &Service{Port: 3000, URL: "http://localhost:3000"}
+	db := &Service{Port: 5432}
+	internal := &Service{Port: 8080, Exposure: ExposureInternal, BindAddresses: []string{"172.18.0.3"}}
+	loopback := &Service{Port: 5000, BindAddresses: []string{"127.0.0.2"}}
+
+	tests := []struct {
+		name         string
+		svc          *Service
+		scheme, path string
+		want         string
+	}{
+		{"path", web, "", "/admin", "http://localhost:3000/admin"},
+		{"scheme", web, "https", "", "https://localhost:3000"},
+		{"no URL without a scheme", db, "", "/admin", ""},
+		{"scheme gives a URL", db, "http", "", "http://127.0.0.1:5432"},
+		{"bound address", loopback, "http", "", "http://127.0.0.2:5000"},
+		{"container address", internal, "http", "/health", "http://172.18.0.3:8080/health"},
+		{"quotes stay encoded", web, "", "/x?a=%27%29", "http://localhost:3000/x?a=%27%29"},
+	}
+	for _, tt := range tests {
+		if got := overrideURL(tt.svc, tt.scheme, tt.path); got != tt.want {
+			t.Errorf("%s: overrideURL = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestOverrideValidate(t *testing.T) {
+	o := Override{Port: 3000, Icon: `/x" onerror="alert(1)`, URLPath: "admin"}
+	if err := o.validate(); err != nil {
+		t.Fatal(err)
+	}
+	if o.Icon != "/x%22%20onerror=%22alert%281%29" || o.URLPath != "/admin" {
+		t.Errorf("normalized to icon %q, urlPath %q", o.Icon, o.URLPath)
+	}
+
+	for _, bad := range []Override{
+		{Icon: "💳"},
+		{Port: 3000, Scheme: "ftp"},
+		{Port: 3000, Icon: "javascript:alert(1)"},
+	} {
+		if err := bad.validate(); !errors.Is(err, ErrInvalidOverride) {
+			t.Errorf("validate(%+v) = %v, want ErrInvalidOverride", bad, err)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"dev-machine-proxy/internal/projects"
+)
+
+// Field names a Service attribute that several enrichers may compete to set
+type Field string
+
+const (
+	FieldName        Field = "name"
+	FieldURL         Field = "url"
+	FieldProject     Field = "project"
+	FieldDescription Field = "description"
+	FieldIcon        Field = "icon"
+	FieldCategory    Field = "category"
+	FieldURLPath     Field = "urlPath" // Appended to the resolved URL
+)
+
+// Priorities used by the built-in enrichers. A higher priority wins; custom
+// enrichers slot in between these.
+const (
+	PriorityOverride  = 1000 // Per-service overrides set by the user, applied after resolving
+	PriorityRule      = 110  // User rules matching the port, process, command line or image
+	PriorityDocker    = 100  // Container labels and image names
+	PriorityProcess   = 90   // Process working directory / command line
+	PrioritySystemd   = 85   // Description of the systemd unit running the process
+	PriorityProbe     = 80   // HTTP probe results
+	PriorityProject   = 60   // Project the port was matched to
+	PriorityConfig    = 40   // Port number found in a config file
+	PriorityKnownPort = 30   // Built-in rules matching only the port number
+	PriorityProbeHint = 25   // Weak hints from a probe (e.g. Server header as description)
+	PriorityProcName  = 10   // Bare process name
+	PriorityFallback  = 0    // "Port N"
+)
+
+// Contribution is one enricher's proposed value for a field
+type Contribution struct {
+	Field      Field
+	Value      string
+	Priority   int     // Higher wins across enrichers
+	Confidence float64 // 0-1, breaks ties between equal priorities
+	Reason     string  // Human-readable explanation; for FieldProject, the ProjectSource* method
+}
+
+// Provenance explains which enricher set a Service field and why
+type Provenance struct {
+	Source     string  `json:"source"`
+	Priority   int     `json:"priority"`
+	Confidence float64 `json:"confidence"`
+	Reason     string  `json:"reason,omitempty"`
+}
+
+// Run holds state shared by sources and enrichers during one Discover call
+type Run struct {
+	Projects []projects.Location // Found under the project roots at the start of the run
+	Ports    []ListeningPort
+}
+
+// Source produces the listening ports a discovery run considers
+type Source interface {
+	Name() string
+	Ports(run *Run) ([]ListeningPort, error)
+}
+
+// Enricher contributes information about each discovered port. Prepare is
+// called once per run, before Enrich is called for each candidate in
+// registration order. Prepare errors are logged and don't stop the run.
+type Enricher interface {
+	Name() string
+	Prepare(run *Run) error
+	Enrich(run *Run, c *Candidate)
+}
+
+// BatchEnricher is an Enricher that handles all of a run's candidates in one
+// call, so slow work such as network probes can run concurrently. EnrichAll is
+// called instead of Enrich and must not touch candidates from other
+// goroutines; ctx carries the run's deadline.
+type BatchEnricher interface {
+	Enricher
+	EnrichAll(ctx context.Context, run *Run, candidates []*Candidate)
+}
+
+// Candidate is a service being assembled by the enrichers. Uncontested facts
+// (container, image, tags, ...) are set on Service directly; contested fields
+// go through Propose and are resolved by priority.
+type Candidate struct {
+	Port    ListeningPort
+	Service Service
+
+	source string // Enricher currently running, recorded in contributions
+	claims map[Field][]claimed
+}
+
+type claimed struct {
+	Contribution
+	source string
+}
+
+func newCandidate(lp ListeningPort) *Candidate {
+	return &Candidate{
+		Port:   lp,
+		claims: make(map[Field][]claimed),
+	}
+}
+
+// Propose offers a value for a contested field
+func (c *Candidate) Propose(contrib Contribution) {
+	if contrib.Value == "" {
+		return
+	}
+	c.claims[contrib.Field] = append(c.claims[contrib.Field], claimed{
+		Contribution: contrib,
+		source:       c.source,
+	})
+}
+
+// Claims returns the contributions made so far for a field
+func (c *Candidate) Claims(field Field) []Contribution {
+	result := make([]Contribution, len(c.claims[field]))
+	for i, cl := range c.claims[field] {
+		result[i] = cl.Contribution
+	}
+	return result
+}
+
+// Has reports whether any enricher has proposed a value for field
+func (c *Candidate) Has(field Field) bool {
+	return len(c.claims[field]) > 0
+}
+
+// AddTag adds a tag once
+func (c *Candidate) AddTag(tag string) {
+	if !contains(c.Service.Tags, tag) {
+		c.Service.Tags = append(c.Service.Tags, tag)
+	}
+}
+
+// best returns the winning contribution for a field: highest priority, then
+// highest confidence, then earliest proposed
+func (c *Candidate) best(field Field) (claimed, bool) {
+	var winner claimed
+	found := false
+	for _, cl := range c.claims[field] {
+		if !found ||
+			cl.Priority > winner.Priority ||
+			(cl.Priority == winner.Priority && cl.Confidence > winner.Confidence) {
+			winner = cl
+			found = true
+		}
+	}
+	return winner, found
+}
+
+// resolve merges the contributions into the final Service
+func (c *Candidate) resolve() Service {
+	if c.Has(FieldProject) {
+		c.AddTag("project")
+	}
+	svc := c.Service
+	svc.Provenance = make(map[Field]Provenance)
+
+	var urlPath string
+	for _, field := range []Field{FieldName, FieldURL, FieldProject, FieldDescription, FieldIcon, FieldCategory, FieldURLPath} {
+		winner, ok := c.best(field)
+		if !ok {
+			continue
+		}
+		svc.Provenance[field] = Provenance{
+			Source:     winner.source,
+			Priority:   winner.Priority,
+			Confidence: winner.Confidence,
+			Reason:     winner.Reason,
+		}
+
+		switch field {
+		case FieldName:
+			svc.Name = winner.Value
+		case FieldURL:
+			svc.URL = winner.Value
+		case FieldProject:
+			svc.ProjectPath = winner.Value
+			svc.ProjectSource = winner.Reason
+		case FieldDescription:
+			svc.Description = winner.Value
+		case FieldIcon:
+			svc.Icon = winner.Value
+		case FieldCategory:
+			svc.Category = winner.Value
+		case FieldURLPath:
+			urlPath = winner.Value
+		}
+	}
+
+	if svc.URL != "" && urlPath != "" {
+		svc.URL = strings.TrimSuffix(svc.URL, "/") + "/" + strings.TrimPrefix(urlPath, "/")
+	}
+
+	// Last resort: just use the port
+	if svc.Name == "" {
+		svc.Name = fmt.Sprintf("Port %d", svc.Port)
+		svc.Provenance[FieldName] = Provenance{Source: "fallback", Priority: PriorityFallback, Reason: "no other source named this port"}
+	}
+
+	return svc
+}
+
+// RegisterSource adds a port source. Ports reported by several sources are
+// merged by protocol and port, first source wins.
+func (d *Discoverer) RegisterSource(s Source) {
+	d.runMu.Lock()
+	defer d.runMu.Unlock()
+	d.sources = append(d.sources, s)
+}
+
+// RegisterEnricher adds an enricher after the ones already registered
+func (d *Discoverer) RegisterEnricher(e Enricher) {
+	d.runMu.Lock()
+	defer d.runMu.Unlock()
+	d.enrichers = append(d.enrichers, e)
+}
@@ -0,0 +1,104 @@
+package discovery
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCandidateResolve(t *testing.T) {
+	type proposal struct {
+		source string
+		Contribution
+	}
+
+	tests := []struct {
+		name      string
+		tags      []string // Set by sources before enriching
+		proposals []proposal
+		want      Service
+	}{
+		{
+			name: "higher priority wins",
+			proposals: []proposal{
+				{"process", Contribution{Field: FieldName, Value: "node", Priority: PriorityProcess, Confidence: 1}},
+				{"rules", Contribution{Field: FieldName, Value: "API", Priority: PriorityRule, Confidence: 0.5, Reason: "rule api"}},
+				{"docker", Contribution{Field: FieldName, Value: "api-1", Priority: PriorityDocker, Confidence: 1}},
+			},
+			want: Service{Name: "API", Provenance: map[Field]Provenance{
+				FieldName: {Source: "rules", Priority: PriorityRule, Confidence: 0.5, Reason: "rule api"},
+			}},
+		},
+		{
+			name: "confidence breaks ties",
+			proposals: []proposal{
+				{"process", Contribution{Field: FieldDescription, Value: "guess", Priority: PriorityProcess, Confidence: 0.4}},
+				{"process", Contribution{Field: FieldDescription, Value: "sure", Priority: PriorityProcess, Confidence: 0.9}},
+			},
+			want: Service{Name: "Port 3000", Description: "sure", Provenance: map[Field]Provenance{
+				FieldName:        {Source: "fallback", Priority: PriorityFallback, Reason: "no other source named this port"},
+				FieldDescription: {Source: "process", Priority: PriorityProcess, Confidence: 0.9},
+			}},
+		},
+		{
+			name: "first proposal wins a full tie",
+			proposals: []proposal{
+				{"first", Contribution{Field: FieldCategory, Value: "web", Priority: PriorityKnownPort, Confidence: 1}},
+				{"second", Contribution{Field: FieldCategory, Value: "dev", Priority: PriorityKnownPort, Confidence: 1}},
+				{"empty", Contribution{Field: FieldCategory, Value: "", Priority: PriorityRule, Confidence: 1}}, // Ignored
+			},
+			want: Service{Name: "Port 3000", Category: "web", Provenance: map[Field]Provenance{
+				FieldName:     {Source: "fallback", Priority: PriorityFallback, Reason: "no other source named this port"},
+				FieldCategory: {Source: "first", Priority: PriorityKnownPort, Confidence: 1},
+			}},
+		},
+		{
+			name: "project and url path",
+			tags: []string{"docker", "project"},
+			proposals: []proposal{
+				{"docker", Contribution{Field: FieldProject, Value: "/src/shop", Priority: PriorityDocker, Confidence: 1, Reason: ProjectSourceCompose}},
+				{"project-config", Contribution{Field: FieldProject, Value: "/src/other", Priority: PriorityConfig, Confidence: 1}},
+				{"http-probe", Contribution{Field: FieldURL, Value: "http://localhost:3000/", Priority: PriorityProbe, Confidence: 1}},
+				{"overrides", Contribution{Field: FieldURLPath, Value: "/admin", Priority: PriorityOverride, Confidence: 1}},
+				{"docker", Contribution{Field: FieldName, Value: "shop-web", Priority: PriorityDocker, Confidence: 1}},
+			},
+			want: Service{
+				Name: "shop-web", URL: "http://localhost:3000/admin", ProjectPath: "/src/shop", ProjectSource: ProjectSourceCompose,
+				Tags: []string{"docker", "project"}, // Not tagged twice
+				Provenance: map[Field]Provenance{
+					FieldName:    {Source: "docker", Priority: PriorityDocker, Confidence: 1},
+					FieldProject: {Source: "docker", Priority: PriorityDocker, Confidence: 1, Reason: ProjectSourceCompose},
+					FieldURL:     {Source: "http-probe", Priority: PriorityProbe, Confidence: 1},
+					FieldURLPath: {Source: "overrides", Priority: PriorityOverride, Confidence: 1},
+				},
+			},
+		},
+		{
+			name: "project tag",
+			proposals: []proposal{
+				{"projects", Contribution{Field: FieldProject, Value: "/src/blog", Priority: PriorityProject, Confidence: 0.8, Reason: ProjectSourceCwd}},
+			},
+			want: Service{Name: "Port 3000", ProjectPath: "/src/blog", ProjectSource: ProjectSourceCwd, Tags: []string{"project"},
+				Provenance: map[Field]Provenance{
+					FieldName:    {Source: "fallback", Priority: PriorityFallback, Reason: "no other source named this port"},
+					FieldProject: {Source: "projects", Priority: PriorityProject, Confidence: 0.8, Reason: ProjectSourceCwd},
+				}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newCandidate(ListeningPort{Port: 3000, Protocol: "tcp"})
+			c.Service.Port = 3000
+			c.Service.Tags = tt.tags
+			for _, p := range tt.proposals {
+				c.source = p.source
+				c.Propose(p.Contribution)
+			}
+
+			tt.want.Port = 3000
+			if got := c.resolve(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("resolve() =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
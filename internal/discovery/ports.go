@@ -2,58 +2,103 @@ package discovery
 
 import (
 	"bufio"
+	"encoding/binary"
+	"encoding/hex"
 	"fmt"
+	"net"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // ListeningPort represents a port that's currently listening
 type ListeningPort struct {
-	Port    int
-	PID     int
-	Process string
+	Port          int
+	Protocol      string   // tcp, udp
+	BindAddresses []string // Local addresses the socket(s) are bound to, e.g. 127.0.0.1, 0.0.0.0, ::
+	PID           int
+	Process       string   // Short process name (comm)
+	Cmdline       []string // Full command line
+	Cwd           string   // Working directory of the owning process
+	UID           int      // Owner UID, -1 if unknown
+	User          string   // Owner username if resolvable
+	PPID          int      // Parent PID
+	Cgroup        string   // systemd cgroup path of the owning process
+	StartTime     time.Time
+
+	inode string
+}
+
+// procNetSource describes one /proc/net socket table
+type procNetSource struct {
+	path        string // Relative to procRoot
+	protocol    string
+	listenState string // Socket state that means "accepting traffic"
+}
+
+// procNetSources lists the socket tables scanned for listeners. UDP has no
+// LISTEN state: a bound, unconnected socket reports 07 (TCP_CLOSE). So do
+// clients that send with sendto() from a port the kernel picked, which is
+// why parseProcNet also drops UDP sockets on ephemeral ports.
+var procNetSources = []procNetSource{
+	{path: "net/tcp", protocol: "tcp", listenState: "0A"},
+	{path: "net/tcp6", protocol: "tcp", listenState: "0A"},
+	{path: "net/udp", protocol: "udp", listenState: "07"},
+	{path: "net/udp6", protocol: "udp", listenState: "07"},
 }
 
-// GetListeningPorts reads /proc/net/tcp to find all listening TCP ports
+// GetListeningPorts reads /proc/net/{tcp,udp}{,6} to find all listening ports
 func GetListeningPorts() ([]ListeningPort, error) {
 	ports := []ListeningPort{}
-	seen := make(map[int]bool)
+	seen := make(map[string]int) // protocol/port -> index in ports
 
-	// Read TCP ports (IPv4)
-	tcpPorts, err := parseProcNet("/proc/net/tcp")
-	if err != nil {
-		return nil, fmt.Errorf("reading /proc/net/tcp: %w", err)
-	}
-	for _, p := range tcpPorts {
-		if !seen[p.Port] {
-			ports = append(ports, p)
-			seen[p.Port] = true
+	// One /proc/*/fd walk per discovery cycle, shared by all four tables
+	procIndex.Invalidate()
+	ephemeral := readEphemeralPorts()
+
+	for i, src := range procNetSources {
+		found, err := parseProcNet(src, ephemeral)
+		if err != nil {
+			// The IPv4 TCP table is always present; the others depend on
+			// kernel config (IPv6 may be disabled), so they're not fatal
+			if i == 0 {
+				return nil, fmt.Errorf("reading %s: %w", filepath.Join(procRoot, src.path), err)
+			}
+			continue
 		}
-	}
 
-	// Read TCP6 ports (IPv6)
-	tcp6Ports, err := parseProcNet("/proc/net/tcp6")
-	if err != nil {
-		// IPv6 might not be available, not fatal
-		return ports, nil
-	}
-	for _, p := range tcp6Ports {
-		if !seen[p.Port] {
-			ports = append(ports, p)
-			seen[p.Port] = true
+		for _, p := range found {
+			key := fmt.Sprintf("%s/%d", p.Protocol, p.Port)
+			idx, ok := seen[key]
+			if !ok {
+				seen[key] = len(ports)
+				ports = append(ports, p)
+				continue
+			}
+
+			// Same port bound on several addresses (e.g. 127.0.0.1 and ::1)
+			for _, addr := range p.BindAddresses {
+				if !contains(ports[idx].BindAddresses, addr) {
+					ports[idx].BindAddresses = append(ports[idx].BindAddresses, addr)
+				}
+			}
+			if ports[idx].inode == "" {
+				ports[idx].inode = p.inode
+			}
 		}
 	}
 
-	// Enrich with process names
-	enrichWithProcessNames(ports)
+	// Resolve owning processes
+	enrichWithProcessInfo(ports)
 
 	return ports, nil
 }
 
-// parseProcNet parses /proc/net/tcp or /proc/net/tcp6 format
-func parseProcNet(path string) ([]ListeningPort, error) {
-	file, err := os.Open(path)
+// parseProcNet parses a /proc/net/{tcp,udp}{,6} table
+func parseProcNet(src procNetSource, ephemeral ephemeralPorts) ([]ListeningPort, error) {
+	file, err := os.Open(filepath.Join(procRoot, src.path))
 	if err != nil {
 		return nil, err
 	}
@@ -73,12 +118,13 @@ func parseProcNet(path string) ([]ListeningPort, error) {
 		}
 
 		// Field 1 is local_address (hex IP:port)
-		// Field 3 is state (0A = LISTEN)
+		// Field 2 is rem_address (hex IP:port)
+		// Field 3 is state (0A = TCP LISTEN, 07 = unconnected UDP)
 		// Field 7 is uid
 		// Field 9 is inode
 
 		state := fields[3]
-		if state != "0A" { // 0A = TCP_LISTEN
+		if state != src.listenState {
 			continue
 		}
 
@@ -91,76 +137,161 @@ func parseProcNet(path string) ([]ListeningPort, error) {
 
 		portHex := parts[1]
 		port64, err := strconv.ParseInt(portHex, 16, 32)
-		if err != nil {
+		if err != nil || port64 == 0 {
 			continue
 		}
 
-		inode := fields[9]
-		pid := findPIDByInode(inode)
+		if src.protocol == "udp" {
+			if strings.Trim(fields[2], "0:") != "" {
+				continue // Has a peer, so it's a client
+			}
+			// A port the kernel picked for a client. Sockets in the kernel
+			// itself (inode 0, e.g. WireGuard or VXLAN) always bind on purpose.
+			if ephemeral.contains(int(port64)) && fields[9] != "0" {
+				continue
+			}
+		}
+
+		var bindAddrs []string
+		if ip := parseHexIP(parts[0]); ip != nil {
+			bindAddrs = []string{ip.String()}
+		}
 
 		ports = append(ports, ListeningPort{
-			Port: int(port64),
-			PID:  pid,
+			Port:          int(port64),
+			Protocol:      src.protocol,
+			BindAddresses: bindAddrs,
+			UID:           parseUID(fields[7]),
+			inode:         fields[9],
 		})
 	}
 
 	return ports, scanner.Err()
 }
 
-// findPIDByInode looks through /proc/*/fd/* to find the process owning a socket inode
-func findPIDByInode(inode string) int {
-	procDirs, err := os.ReadDir("/proc")
-	if err != nil {
-		return 0
-	}
-
-	socketLink := fmt.Sprintf("socket:[%s]", inode)
-
-	for _, dir := range procDirs {
-		if !dir.IsDir() {
-			continue
-		}
+// ephemeralPorts is the range the kernel picks local ports from for sockets
+// that don't bind one, less the ports reserved for services
+type ephemeralPorts struct {
+	lo, hi   int
+	reserved [][2]int
+}
 
-		pid, err := strconv.Atoi(dir.Name())
-		if err != nil {
-			continue // Not a PID directory
+// readEphemeralPorts reads net.ipv4.ip_local_port_range and
+// ip_local_reserved_ports (which also apply to IPv6), falling back to the
+// kernel's default range
+func readEphemeralPorts() ephemeralPorts {
+	e := ephemeralPorts{lo: 32768, hi: 60999}
+	if data, err := os.ReadFile(filepath.Join(procRoot, "sys/net/ipv4/ip_local_port_range")); err == nil {
+		if fields := strings.Fields(string(data)); len(fields) == 2 {
+			lo, err1 := strconv.Atoi(fields[0])
+			hi, err2 := strconv.Atoi(fields[1])
+			if err1 == nil && err2 == nil && lo <= hi {
+				e.lo, e.hi = lo, hi
+			}
 		}
+	}
 
-		fdPath := fmt.Sprintf("/proc/%d/fd", pid)
-		fds, err := os.ReadDir(fdPath)
+	// e.g. "8080,51820-51830"
+	data, _ := os.ReadFile(filepath.Join(procRoot, "sys/net/ipv4/ip_local_reserved_ports"))
+	for _, part := range strings.Split(strings.TrimSpace(string(data)), ",") {
+		from, to, isRange := strings.Cut(part, "-")
+		lo, err := strconv.Atoi(from)
 		if err != nil {
-			continue // Can't read this process's fds
+			continue
 		}
-
-		for _, fd := range fds {
-			linkPath := fmt.Sprintf("%s/%s", fdPath, fd.Name())
-			link, err := os.Readlink(linkPath)
-			if err != nil {
+		hi := lo
+		if isRange {
+			if hi, err = strconv.Atoi(to); err != nil {
 				continue
 			}
+		}
+		e.reserved = append(e.reserved, [2]int{lo, hi})
+	}
+	return e
+}
 
-			if link == socketLink {
-				return pid
-			}
+// contains reports whether port is handed out to clients
+func (e ephemeralPorts) contains(port int) bool {
+	if port < e.lo || port > e.hi {
+		return false
+	}
+	for _, r := range e.reserved {
+		if port >= r[0] && port <= r[1] {
+			return false
 		}
 	}
+	return true
+}
+
+// parseHexIP decodes the address half of a /proc/net local_address. The
+// kernel prints the raw in_addr/in6_addr as 32-bit words read in host byte
+// order, so each word is turned back into bytes in that order (reversing
+// each 4-byte group on little-endian machines).
+func parseHexIP(s string) net.IP {
+	raw, err := hex.DecodeString(s)
+	if err != nil || (len(raw) != net.IPv4len && len(raw) != net.IPv6len) {
+		return nil
+	}
 
-	return 0
+	ip := make(net.IP, len(raw))
+	for word := 0; word < len(raw); word += 4 {
+		binary.NativeEndian.PutUint32(ip[word:], binary.BigEndian.Uint32(raw[word:]))
+	}
+	return ip
 }
 
-// enrichWithProcessNames adds process names to listening ports
-func enrichWithProcessNames(ports []ListeningPort) {
+// enrichWithProcessInfo resolves the owning process of each listening port
+// through the shared socket index
+func enrichWithProcessInfo(ports []ListeningPort) {
+	live := make(map[int]bool)
+
 	for i := range ports {
-		if ports[i].PID == 0 {
+		if ports[i].inode == "" || ports[i].inode == "0" {
 			continue
 		}
 
-		commPath := fmt.Sprintf("/proc/%d/comm", ports[i].PID)
-		data, err := os.ReadFile(commPath)
-		if err != nil {
+		pid := procIndex.Lookup(ports[i].inode)
+		if pid == 0 {
+			// Owned by a process we can't inspect; the socket table still says whose
+			if ports[i].UID >= 0 {
+				ports[i].User = procIndex.Username(ports[i].UID)
+			}
 			continue
 		}
+		live[pid] = true
+
+		ports[i].PID = pid
+		info, ok := procIndex.Process(pid)
+		if !ok {
+			continue
+		}
+		ports[i].Process = info.Comm
+		ports[i].Cmdline = info.Cmdline
+		ports[i].Cwd = info.Cwd
+		ports[i].UID = info.UID
+		ports[i].User = info.User
+		ports[i].PPID = info.PPID
+		ports[i].Cgroup = info.Cgroup
+		ports[i].StartTime = info.StartTime
+	}
 
-		ports[i].Process = strings.TrimSpace(string(data))
+	procIndex.Prune(live)
+}
+
+// parseUID parses the uid column of a /proc/net table, returning -1 if invalid
+func parseUID(s string) int {
+	uid, err := strconv.Atoi(s)
+	if err != nil {
+		return -1
+	}
+	return uid
+}
+
+func contains(slice []string, item string) bool {
+	for _, s := range slice {
+		if s == item {
+			return true
+		}
 	}
+	return false
 }
@@ -0,0 +1,37 @@
+package discovery
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestParseHexIP(t *testing.T) {
+	if binary.NativeEndian.Uint16([]byte{1, 0}) != 1 {
+		t.Skip("fixtures are /proc/net output from a little-endian machine")
+	}
+
+	tests := []struct {
+		hex  string
+		want string
+	}{
+		{"0100007F", "127.0.0.1"},
+		{"00000000", "0.0.0.0"},
+		{"0101A8C0", "192.168.1.1"},
+		{"00000000000000000000000001000000", "::1"},
+		{"00000000000000000000000000000000", "::"},
+		{"0000000000000000FFFF00000100007F", "127.0.0.1"}, // IPv4-mapped
+		{"B80D0120000000000000000001000000", "2001:db8::1"},
+		{"000080FE000000000000000001000000", "fe80::1"},
+	}
+	for _, tt := range tests {
+		if got := parseHexIP(tt.hex); got.String() != tt.want {
+			t.Errorf("parseHexIP(%q) = %v, want %s", tt.hex, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"", "0100007", "ZZ00007F", "0100007F00"} {
+		if got := parseHexIP(bad); got != nil {
+			t.Errorf("parseHexIP(%q) = %v, want nil", bad, got)
+		}
+	}
+}
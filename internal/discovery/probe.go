@@ -1,11 +1,14 @@
 package discovery
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -19,53 +22,82 @@ type HTTPProbeResult struct {
 	PoweredBy   string
 	ContentType string
 	IsHTTPS     bool
+	BaseURL     string      // scheme://host:port that answered
+	Header      http.Header // All response headers, for fingerprint rules
+	Body        string      // Up to the first 64KB of the response body
+	Icon        string      // URL of the icon chosen for the service (see FetchIcon)
+	FaviconHash string      // Hash of that icon, matched by favicon rules
 }
 
-// ProbeHTTP attempts to connect to a port via HTTP and gather information
-func ProbeHTTP(port int) HTTPProbeResult {
-	result := HTTPProbeResult{}
+// probeTimeout bounds each HTTPS or HTTP attempt of a probe
+const probeTimeout = 2 * time.Second
+
+// probeClient is shared by all probes so the transport is built once.
+// Keep-alives are off: a probed port isn't asked again until its owner changes.
+var probeClient = &http.Client{
+	Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+		DisableKeepAlives: true,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse // Don't follow redirects
+	},
+}
 
-	// Try HTTPS first, then HTTP
+// ProbeHTTPContext probes host:port, trying HTTPS first, then HTTP. Each
+// attempt is limited to probeTimeout; cancelling ctx cuts the probe short.
+func ProbeHTTPContext(ctx context.Context, host string, port int) HTTPProbeResult {
 	for _, scheme := range []string{"https", "http"} {
-		url := fmt.Sprintf("%s://localhost:%d/", scheme, port)
-
-		client := &http.Client{
-			Timeout: 2 * time.Second,
-			Transport: &http.Transport{
-				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-			},
-			CheckRedirect: func(req *http.Request, via []*http.Request) error {
-				return http.ErrUseLastResponse // Don't follow redirects
-			},
+		if result, ok := probeScheme(ctx, scheme, host, port); ok {
+			return result
 		}
-
-		resp, err := client.Get(url)
-		if err != nil {
-			continue
+		if ctx.Err() != nil {
+			break
 		}
-		defer resp.Body.Close()
+	}
+	return HTTPProbeResult{}
+}
+
+func probeScheme(ctx context.Context, scheme, host string, port int) (HTTPProbeResult, bool) {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
 
-		result.IsHTTP = true
-		result.StatusCode = resp.StatusCode
-		result.IsHTTPS = scheme == "https"
+	url := fmt.Sprintf("%s://%s/", scheme, net.JoinHostPort(host, strconv.Itoa(port)))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return HTTPProbeResult{}, false
+	}
+
+	resp, err := probeClient.Do(req)
+	if err != nil {
+		return HTTPProbeResult{}, false
+	}
+	defer resp.Body.Close()
+
+	result := HTTPProbeResult{
+		IsHTTP:     true,
+		StatusCode: resp.StatusCode,
+		IsHTTPS:    scheme == "https",
+		BaseURL:    strings.TrimSuffix(url, "/"),
+		Header:     resp.Header,
 
 		// Extract headers
-		result.Server = resp.Header.Get("Server")
-		result.PoweredBy = resp.Header.Get("X-Powered-By")
-		result.ContentType = resp.Header.Get("Content-Type")
+		Server:      resp.Header.Get("Server"),
+		PoweredBy:   resp.Header.Get("X-Powered-By"),
+		ContentType: resp.Header.Get("Content-Type"),
+	}
 
-		// Try to extract title from HTML
-		if strings.Contains(result.ContentType, "text/html") {
-			body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024)) // Read up to 64KB
-			if err == nil {
-				result.Title = extractTitle(string(body))
-			}
-		}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024)) // Read up to 64KB
+	if err == nil {
+		result.Body = string(body)
+	}
 
-		return result
+	// Try to extract title from HTML
+	if strings.Contains(result.ContentType, "text/html") {
+		result.Title = extractTitle(result.Body)
 	}
 
-	return result
+	return result, true
 }
 
 // extractTitle pulls the <title> tag content from HTML
@@ -77,66 +109,3 @@ func extractTitle(html string) string {
 	}
 	return ""
 }
-
-// GuessServiceFromProbe attempts to identify a service based on HTTP probe results
-func GuessServiceFromProbe(probe HTTPProbeResult, port int) string {
-	// Check server header
-	serverLower := strings.ToLower(probe.Server)
-	poweredByLower := strings.ToLower(probe.PoweredBy)
-
-	serverHints := map[string]string{
-		"nginx":      "Nginx",
-		"apache":     "Apache",
-		"express":    "Express.js",
-		"kestrel":    "ASP.NET",
-		"gunicorn":   "Python (Gunicorn)",
-		"uvicorn":    "Python (Uvicorn)",
-		"werkzeug":   "Flask",
-		"jetty":      "Jetty",
-		"tomcat":     "Tomcat",
-		"openresty":  "OpenResty",
-		"caddy":      "Caddy",
-		"traefik":    "Traefik",
-	}
-
-	for hint, name := range serverHints {
-		if strings.Contains(serverLower, hint) || strings.Contains(poweredByLower, hint) {
-			return name
-		}
-	}
-
-	// Check title for common apps
-	titleLower := strings.ToLower(probe.Title)
-	titleHints := map[string]string{
-		"grafana":    "Grafana",
-		"prometheus": "Prometheus",
-		"portainer":  "Portainer",
-		"jenkins":    "Jenkins",
-		"gitlab":     "GitLab",
-		"gitea":      "Gitea",
-		"nextcloud":  "Nextcloud",
-		"home assistant": "Home Assistant",
-		"jupyter":    "Jupyter",
-		"pgadmin":    "pgAdmin",
-		"adminer":    "Adminer",
-		"phpMyAdmin": "phpMyAdmin",
-		"mailhog":    "MailHog",
-		"rabbitmq":   "RabbitMQ",
-		"kibana":     "Kibana",
-		"swagger":    "Swagger UI",
-		"redoc":      "ReDoc",
-	}
-
-	for hint, name := range titleHints {
-		if strings.Contains(titleLower, strings.ToLower(hint)) {
-			return name
-		}
-	}
-
-	// If we got a title, use it as a fallback
-	if probe.Title != "" && len(probe.Title) < 50 {
-		return probe.Title
-	}
-
-	return ""
-}
@@ -0,0 +1,142 @@
+package discovery
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// probeWorkers bounds how many ports are probed at once
+const probeWorkers = 8
+
+// unownedProbeTTL is how long a probe result is trusted for a port whose
+// owning process is unknown (e.g. owned by another user), since there is no
+// process restart to notice
+const unownedProbeTTL = 5 * time.Minute
+
+// negativeProbeTTL is how long a probe that found nothing is trusted. A dev
+// server can be too slow to answer its first request (e.g. while compiling),
+// so it is asked again instead of staying unrecognised until it restarts.
+const negativeProbeTTL = time.Minute
+
+// probeCache remembers probe results per port for as long as the same
+// process (PID plus start time) owns the port, so only new or restarted
+// servers are probed. Internal container ports have no process to go by, so
+// they are trusted for unownedProbeTTL, and results that found nothing only
+// for negativeProbeTTL.
+type probeCache[T any] struct {
+	mu       sync.Mutex
+	entries  map[probeKey]probeEntry[T]
+	negative func(T) bool // Whether a result found nothing
+}
+
+// probeKey addresses a probed port: a host port, or an internal port of a
+// container
+type probeKey struct {
+	port      int
+	container string // Container ID, for internal ports
+}
+
+type probeEntry[T any] struct {
+	pid       int
+	startTime time.Time
+	probedAt  time.Time
+	result    T
+}
+
+func newProbeCache[T any](negative func(T) bool) *probeCache[T] {
+	return &probeCache[T]{entries: make(map[probeKey]probeEntry[T]), negative: negative}
+}
+
+// get returns the cached result for a host port if its owner hasn't changed
+func (c *probeCache[T]) get(lp ListeningPort) (T, bool) {
+	return c.lookup(probeKey{port: lp.Port}, lp.PID, lp.StartTime)
+}
+
+func (c *probeCache[T]) put(lp ListeningPort, result T) {
+	c.store(probeKey{port: lp.Port}, lp.PID, lp.StartTime, result)
+}
+
+// getInternal returns the cached result for an internal container port
+func (c *probeCache[T]) getInternal(containerID string, port int) (T, bool) {
+	return c.lookup(probeKey{port: port, container: containerID}, 0, time.Time{})
+}
+
+func (c *probeCache[T]) putInternal(containerID string, port int, result T) {
+	c.store(probeKey{port: port, container: containerID}, 0, time.Time{}, result)
+}
+
+func (c *probeCache[T]) lookup(key probeKey, pid int, startTime time.Time) (T, bool) {
+	var zero T
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || entry.pid != pid || !entry.startTime.Equal(startTime) {
+		return zero, false
+	}
+	age := time.Since(entry.probedAt)
+	if (pid == 0 && age > unownedProbeTTL) || (c.negative(entry.result) && age > negativeProbeTTL) {
+		return zero, false
+	}
+	return entry.result, true
+}
+
+func (c *probeCache[T]) store(key probeKey, pid int, startTime time.Time, result T) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = probeEntry[T]{pid: pid, startTime: startTime, probedAt: time.Now(), result: result}
+}
+
+// prune drops host ports that are no longer listening
+func (c *probeCache[T]) prune(ports []ListeningPort) {
+	listening := make(map[probeKey]bool, len(ports))
+	for _, lp := range ports {
+		if lp.Protocol == "tcp" {
+			listening[probeKey{port: lp.Port}] = true
+		}
+	}
+	c.pruneWhere(func(key probeKey) bool { return key.container == "" && !listening[key] })
+}
+
+// pruneInternal drops internal container ports that aren't in live
+func (c *probeCache[T]) pruneInternal(live map[probeKey]bool) {
+	c.pruneWhere(func(key probeKey) bool { return key.container != "" && !live[key] })
+}
+
+func (c *probeCache[T]) pruneWhere(drop func(probeKey) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.entries {
+		if drop(key) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// forEachConcurrently calls fn(i) for i in [0, n) on at most workers
+// goroutines. Once ctx is done, remaining indexes are skipped.
+func forEachConcurrently(ctx context.Context, n, workers int, fn func(i int)) {
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(workers, n); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				fn(i)
+			}
+		}()
+	}
+
+feed:
+	for i := 0; i < n; i++ {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
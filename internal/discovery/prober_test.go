@@ -0,0 +1,86 @@
+package discovery
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProbeCacheOwners(t *testing.T) {
+	c := newProbeCache(func(s string) bool { return s == "" })
+	started := time.Unix(1760000000, 0)
+	lp := ListeningPort{Port: 3000, Protocol: "tcp", PID: 42, StartTime: started}
+	c.put(lp, "next.js")
+
+	tests := []struct {
+		name string
+		lp   ListeningPort
+		hit  bool
+	}{
+		{"same process", lp, true},
+		{"restarted", ListeningPort{Port: 3000, Protocol: "tcp", PID: 42, StartTime: started.Add(time.Second)}, false},
+		{"other process", ListeningPort{Port: 3000, Protocol: "tcp", PID: 43, StartTime: started}, false},
+		{"other port", ListeningPort{Port: 3001, Protocol: "tcp", PID: 42, StartTime: started}, false},
+	}
+	for _, tt := range tests {
+		if _, hit := c.get(tt.lp); hit != tt.hit {
+			t.Errorf("%s: hit = %v, want %v", tt.name, hit, tt.hit)
+		}
+	}
+}
+
+func TestProbeCacheInternalPorts(t *testing.T) {
+	c := newProbeCache(func(s string) bool { return s == "" })
+	c.put(ListeningPort{Port: 5432, Protocol: "tcp"}, "host postgres")
+	c.putInternal("aaaaaaaaaaaa", 5432, "shop postgres")
+	c.putInternal("bbbbbbbbbbbb", 5432, "blog postgres")
+
+	if got, _ := c.getInternal("aaaaaaaaaaaa", 5432); got != "shop postgres" {
+		t.Errorf("getInternal(a) = %q", got)
+	}
+	if got, _ := c.get(ListeningPort{Port: 5432, Protocol: "tcp"}); got != "host postgres" {
+		t.Errorf("get(5432) = %q; internal ports must not shadow host ports", got)
+	}
+
+	// Each kind is pruned on its own
+	c.pruneInternal(map[probeKey]bool{{port: 5432, container: "bbbbbbbbbbbb"}: true})
+	if _, ok := c.getInternal("aaaaaaaaaaaa", 5432); ok {
+		t.Error("removed container still cached")
+	}
+	if _, ok := c.getInternal("bbbbbbbbbbbb", 5432); !ok {
+		t.Error("live container dropped")
+	}
+	if _, ok := c.get(ListeningPort{Port: 5432, Protocol: "tcp"}); !ok {
+		t.Error("pruneInternal dropped a host port")
+	}
+	c.prune(nil)
+	if _, ok := c.get(ListeningPort{Port: 5432, Protocol: "tcp"}); ok {
+		t.Error("closed host port still cached")
+	}
+	if _, ok := c.getInternal("bbbbbbbbbbbb", 5432); !ok {
+		t.Error("prune dropped an internal port")
+	}
+}
+
+func TestProbeCacheNegativeTTL(t *testing.T) {
+	c := newProbeCache(func(s string) bool { return s == "" })
+	slow := ListeningPort{Port: 3000, Protocol: "tcp", PID: 42, StartTime: time.Unix(1760000000, 0)}
+	fast := ListeningPort{Port: 8080, Protocol: "tcp", PID: 43, StartTime: time.Unix(1760000000, 0)}
+	c.put(slow, "") // Still compiling, didn't answer in time
+	c.put(fast, "grafana")
+
+	if _, ok := c.get(slow); !ok {
+		t.Fatal("fresh negative result not cached")
+	}
+
+	// Age both entries past the negative TTL
+	for key, entry := range c.entries {
+		entry.probedAt = entry.probedAt.Add(-negativeProbeTTL - time.Second)
+		c.entries[key] = entry
+	}
+	if _, ok := c.get(slow); ok {
+		t.Error("negative result still trusted after negativeProbeTTL")
+	}
+	if _, ok := c.get(fast); !ok {
+		t.Error("positive result expired with the negative TTL")
+	}
+}
@@ -0,0 +1,287 @@
+package discovery
+
+import (
+	"bufio"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// procRoot is where procfs is mounted. It's a variable so a synthetic tree
+// can stand in for /proc in tests and BenchmarkGetListeningPorts.
+var procRoot = "/proc"
+
+// clockTicks is USER_HZ, the unit of /proc/<pid>/stat times (100 on every
+// mainstream Linux build)
+const clockTicks = 100
+
+// ProcessInfo holds details about the process owning a listening socket
+type ProcessInfo struct {
+	PID       int
+	PPID      int
+	Comm      string
+	Cmdline   []string
+	Cwd       string
+	UID       int
+	User      string
+	Cgroup    string // systemd cgroup path (see ParseCgroup)
+	StartTime time.Time
+}
+
+// socketIndex maps socket inodes to the PIDs holding them. It is built with a
+// single walk over /proc/*/fd instead of one walk per socket, and is shared by
+// the tcp/tcp6/udp/udp6 passes of a discovery cycle until invalidated.
+type socketIndex struct {
+	mu          sync.Mutex
+	pids        map[string]int // socket inode -> PID
+	missRebuilt bool           // Whether a lookup miss already forced a rebuild of this index
+
+	procs     map[int]ProcessInfo // PID -> info, validated against start time
+	usernames map[int]string
+}
+
+// procIndex is the shared index used by GetListeningPorts
+var procIndex = newSocketIndex()
+
+func newSocketIndex() *socketIndex {
+	return &socketIndex{
+		procs:     make(map[int]ProcessInfo),
+		usernames: make(map[int]string),
+	}
+}
+
+// Invalidate drops the inode index so the next lookup rebuilds it
+func (x *socketIndex) Invalidate() {
+	x.mu.Lock()
+	x.pids = nil
+	x.mu.Unlock()
+}
+
+// Lookup returns the PID owning a socket inode, or 0 if it can't be found
+// (typically because the owner belongs to another user).
+func (x *socketIndex) Lookup(inode string) int {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if x.pids == nil {
+		// Built just now, so a miss is a socket we can't see rather than
+		// one newer than the index
+		x.rebuildLocked()
+		x.missRebuilt = true
+	}
+
+	if pid, ok := x.pids[inode]; ok {
+		return pid
+	}
+
+	// A socket newer than the index. Rebuild once; further misses are
+	// sockets we can't see, and rebuilding for each would bring back the
+	// per-port walk this index exists to avoid.
+	if !x.missRebuilt {
+		x.rebuildLocked()
+		x.missRebuilt = true
+		return x.pids[inode]
+	}
+	return 0
+}
+
+// rebuildLocked walks every /proc/<pid>/fd once (caller must hold lock)
+func (x *socketIndex) rebuildLocked() {
+	x.pids = make(map[string]int)
+	x.missRebuilt = false
+
+	entries, err := os.ReadDir(procRoot)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue // Not a PID directory
+		}
+
+		fdPath := filepath.Join(procRoot, entry.Name(), "fd")
+		fds, err := os.ReadDir(fdPath)
+		if err != nil {
+			continue // Can't read this process's fds
+		}
+
+		for _, fd := range fds {
+			link, err := os.Readlink(filepath.Join(fdPath, fd.Name()))
+			if err != nil || !strings.HasPrefix(link, "socket:[") {
+				continue
+			}
+			inode := link[len("socket:[") : len(link)-1]
+			if _, ok := x.pids[inode]; !ok {
+				x.pids[inode] = pid
+			}
+		}
+	}
+}
+
+// Process returns details for a PID. Results are cached and reused until the
+// process start time changes, which catches PID reuse.
+func (x *socketIndex) Process(pid int) (ProcessInfo, bool) {
+	ppid, startTicks, ok := readProcStat(pid)
+	if !ok {
+		return ProcessInfo{}, false
+	}
+	startTime := bootTime().Add(time.Duration(startTicks) * time.Second / clockTicks)
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if info, ok := x.procs[pid]; ok && info.StartTime.Equal(startTime) {
+		return info, true
+	}
+
+	info := ProcessInfo{
+		PID:       pid,
+		PPID:      ppid,
+		StartTime: startTime,
+		UID:       -1,
+	}
+	dir := filepath.Join(procRoot, strconv.Itoa(pid))
+
+	if data, err := os.ReadFile(filepath.Join(dir, "comm")); err == nil {
+		info.Comm = strings.TrimSpace(string(data))
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "cmdline")); err == nil {
+		info.Cmdline = splitCmdline(data)
+	}
+	if cwd, err := os.Readlink(filepath.Join(dir, "cwd")); err == nil {
+		info.Cwd = cwd
+	}
+	info.Cgroup = readCgroup(dir)
+	if uid, ok := readProcUID(dir); ok {
+		info.UID = uid
+		info.User = x.usernameLocked(uid)
+	}
+
+	x.procs[pid] = info
+	return info, true
+}
+
+// Prune drops cached process info for PIDs that are no longer in use
+func (x *socketIndex) Prune(live map[int]bool) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	for pid := range x.procs {
+		if !live[pid] {
+			delete(x.procs, pid)
+		}
+	}
+}
+
+// Username resolves a UID to a login name, caching the result
+func (x *socketIndex) Username(uid int) string {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return x.usernameLocked(uid)
+}
+
+// usernameLocked resolves a UID to a login name (caller must hold lock)
+func (x *socketIndex) usernameLocked(uid int) string {
+	if name, ok := x.usernames[uid]; ok {
+		return name
+	}
+
+	name := ""
+	if u, err := user.LookupId(strconv.Itoa(uid)); err == nil {
+		name = u.Username
+	}
+	x.usernames[uid] = name
+	return name
+}
+
+// readProcStat returns the parent PID and start time (in clock ticks since
+// boot) from /proc/<pid>/stat
+func readProcStat(pid int) (ppid int, startTicks uint64, ok bool) {
+	data, err := os.ReadFile(filepath.Join(procRoot, strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return 0, 0, false
+	}
+
+	// comm (field 2) is parenthesised and may contain spaces, so split after it
+	stat := string(data)
+	end := strings.LastIndexByte(stat, ')')
+	if end == -1 {
+		return 0, 0, false
+	}
+	fields := strings.Fields(stat[end+1:])
+	// fields[0] is state (field 3), so field N is fields[N-3]
+	if len(fields) < 20 {
+		return 0, 0, false
+	}
+
+	ppid, _ = strconv.Atoi(fields[1])
+	startTicks, _ = strconv.ParseUint(fields[19], 10, 64)
+	return ppid, startTicks, true
+}
+
+// readProcUID returns the real UID from /proc/<pid>/status
+func readProcUID(dir string) (int, bool) {
+	file, err := os.Open(filepath.Join(dir, "status"))
+	if err != nil {
+		return 0, false
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "Uid:") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return 0, false
+		}
+		uid, err := strconv.Atoi(fields[1])
+		return uid, err == nil
+	}
+	return 0, false
+}
+
+// splitCmdline splits the NUL-separated /proc/<pid>/cmdline contents
+func splitCmdline(data []byte) []string {
+	trimmed := strings.TrimRight(string(data), "\x00")
+	if trimmed == "" {
+		return nil
+	}
+	return strings.Split(trimmed, "\x00")
+}
+
+var (
+	bootTimeOnce  sync.Once
+	bootTimeValue time.Time
+)
+
+// bootTime reads the system boot time (btime) from /proc/stat
+func bootTime() time.Time {
+	bootTimeOnce.Do(func() {
+		file, err := os.Open(filepath.Join(procRoot, "stat"))
+		if err != nil {
+			return
+		}
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) == 2 && fields[0] == "btime" {
+				if secs, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+					bootTimeValue = time.Unix(secs, 0)
+				}
+				return
+			}
+		}
+	})
+	return bootTimeValue
+}
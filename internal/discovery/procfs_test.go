@@ -0,0 +1,227 @@
+package discovery
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fakeProc is one process of a synthetic /proc tree
+type fakeProc struct {
+	pid, ppid int
+	comm      string
+	cmdline   []string
+	cwd       string
+	uid       int
+	cgroup    string   // Contents of /proc/<pid>/cgroup
+	sockets   []string // Inodes of the sockets it holds open
+	otherFDs  int      // Regular files it holds open
+}
+
+// listener is one LISTEN row of the synthetic /proc/net/tcp, or an
+// unconnected UDP socket
+type listener struct {
+	table  string // net/tcp when empty, or net/tcp6, net/udp, net/udp6
+	addr   string // Hex local address, e.g. 0100007F
+	port   int
+	remote string // Hex remote address and port of a UDP socket, 00000000:0000 when empty
+	uid    int
+	inode  string
+}
+
+// useProcTree writes procs and listeners as a /proc tree under a temporary
+// directory and points procRoot and procIndex at it for the rest of the test
+func useProcTree(tb testing.TB, procs []fakeProc, listeners []listener) {
+	tb.Helper()
+	root := tb.TempDir()
+	write := func(path, content string) {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			tb.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			tb.Fatal(err)
+		}
+	}
+
+	write(filepath.Join(root, "stat"), "cpu  1 2 3 4\nbtime 1760000000\n")
+	write(filepath.Join(root, "sys", "net", "ipv4", "ip_local_port_range"), "32768\t60999\n")
+	write(filepath.Join(root, "sys", "net", "ipv4", "ip_local_reserved_ports"), "51820\n")
+
+	tables := make(map[string]*strings.Builder)
+	for _, table := range []string{"net/tcp", "net/tcp6", "net/udp", "net/udp6"} {
+		tables[table] = &strings.Builder{}
+		tables[table].WriteString("  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n")
+	}
+	for i, l := range listeners {
+		table, state, remote := l.table, "0A", "00000000:0000"
+		if table == "" {
+			table = "net/tcp"
+		}
+		if strings.HasPrefix(table, "net/udp") {
+			state = "07"
+			if l.remote != "" {
+				remote = l.remote
+			}
+		}
+		fmt.Fprintf(tables[table], "%4d: %s:%04X %s %s 00000000:00000000 00:00000000 00000000 %5d        0 %s 1 0000000000000000 100 0 0 10 0\n",
+			i, l.addr, l.port, remote, state, l.uid, l.inode)
+	}
+	for table, rows := range tables {
+		write(filepath.Join(root, table), rows.String())
+	}
+
+	for _, p := range procs {
+		dir := filepath.Join(root, strconv.Itoa(p.pid))
+		write(filepath.Join(dir, "stat"), fmt.Sprintf("%d (%s) S %d %d 0 0 -1 4194560 0 0 0 0 0 0 0 0 20 0 1 0 %d 0 0\n", p.pid, p.comm, p.ppid, p.pid, 1000+p.pid))
+		write(filepath.Join(dir, "comm"), p.comm+"\n")
+		write(filepath.Join(dir, "cmdline"), strings.Join(p.cmdline, "\x00")+"\x00")
+		write(filepath.Join(dir, "status"), fmt.Sprintf("Name:\t%s\nUid:\t%d\t%d\t%d\t%d\n", p.comm, p.uid, p.uid, p.uid, p.uid))
+		write(filepath.Join(dir, "cgroup"), p.cgroup)
+		if err := os.Symlink(p.cwd, filepath.Join(dir, "cwd")); err != nil {
+			tb.Fatal(err)
+		}
+
+		fdDir := filepath.Join(dir, "fd")
+		if err := os.MkdirAll(fdDir, 0755); err != nil {
+			tb.Fatal(err)
+		}
+		fd := 0
+		for ; fd < p.otherFDs; fd++ {
+			os.Symlink("/dev/null", filepath.Join(fdDir, strconv.Itoa(fd)))
+		}
+		for _, inode := range p.sockets {
+			os.Symlink("socket:["+inode+"]", filepath.Join(fdDir, strconv.Itoa(fd)))
+			fd++
+		}
+	}
+
+	oldRoot, oldIndex := procRoot, procIndex
+	procRoot, procIndex = root, newSocketIndex()
+	tb.Cleanup(func() { procRoot, procIndex = oldRoot, oldIndex })
+}
+
+func TestGetListeningPortsSyntheticProc(t *testing.T) {
+	useProcTree(t, []fakeProc{
+		{pid: 100, ppid: 1, comm: "node", cmdline: []string{"node", "server.js"}, cwd: "/home/dev/api", uid: 0,
+			cgroup: "0::/user.slice/user-1000.slice/user@1000.service/app.slice/api.service\n", sockets: []string{"5001"}, otherFDs: 3},
+		{pid: 200, ppid: 100, comm: "vite", cmdline: []string{"vite", "--port", "5173"}, cwd: "/home/dev/web", uid: 0,
+			sockets: []string{"5002", "5003"}},
+		{pid: 300, ppid: 1, comm: "dnsmasq", cmdline: []string{"dnsmasq", "-k"}, cwd: "/", uid: 0,
+			sockets: []string{"6001", "6002", "6003", "6004", "6005"}},
+	}, []listener{
+		{addr: "0100007F", port: 3000, inode: "5001"},
+		{addr: "00000000", port: 5173, inode: "5002"},
+		{addr: "0100007F", port: 9229, inode: "9999"}, // Owner not visible
+		{table: "net/udp", addr: "0100007F", port: 53, inode: "6001"},
+		{table: "net/udp6", addr: "00000000000000000000000000000000", port: 5353, inode: "6002"},
+		{table: "net/udp", addr: "00000000", port: 41234, inode: "6003"},                         // Client on an ephemeral port
+		{table: "net/udp", addr: "00000000", port: 5060, remote: "0101A8C0:13C4", inode: "6004"}, // Connected client
+		{table: "net/udp", addr: "00000000", port: 51820, inode: "6005"},                         // Reserved for a service
+		{table: "net/udp", addr: "00000000", port: 40000, inode: "0"},                            // In-kernel, e.g. VXLAN
+	})
+
+	ports, err := GetListeningPorts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	byPort := make(map[int]ListeningPort)
+	for _, p := range ports {
+		byPort[p.Port] = p
+	}
+	if len(byPort) != 7 {
+		t.Fatalf("got %d ports, want 7: %+v", len(byPort), ports)
+	}
+
+	api := byPort[3000]
+	if api.PID != 100 || api.Process != "node" || api.Cwd != "/home/dev/api" || strings.Join(api.Cmdline, " ") != "node server.js" {
+		t.Errorf("port 3000 = %+v", api)
+	}
+	if api.Cgroup != "/user.slice/user-1000.slice/user@1000.service/app.slice/api.service" {
+		t.Errorf("port 3000 cgroup = %q", api.Cgroup)
+	}
+	if got := byPort[5173]; got.PID != 200 || got.PPID != 100 || got.BindAddresses[0] != "0.0.0.0" {
+		t.Errorf("port 5173 = %+v", got)
+	}
+	if got := byPort[9229]; got.PID != 0 {
+		t.Errorf("port 9229 resolved to PID %d, want none", got.PID)
+	}
+
+	for _, port := range []int{53, 5353, 51820, 40000} {
+		if got := byPort[port]; got.Protocol != "udp" {
+			t.Errorf("port %d protocol = %q, want udp", port, got.Protocol)
+		}
+	}
+	if got := byPort[53]; got.PID != 300 || got.Process != "dnsmasq" || got.BindAddresses[0] != "127.0.0.1" {
+		t.Errorf("port 53 = %+v", got)
+	}
+	if got := byPort[5353]; got.PID != 300 || got.BindAddresses[0] != "::" {
+		t.Errorf("port 5353 = %+v", got)
+	}
+}
+
+func TestSocketIndexWalksOncePerCycle(t *testing.T) {
+	useProcTree(t, []fakeProc{
+		{pid: 100, ppid: 1, comm: "node", cwd: "/home/dev/api", sockets: []string{"5001"}},
+	}, nil)
+
+	x := newSocketIndex()
+	if pid := x.Lookup("5001"); pid != 100 {
+		t.Fatalf("Lookup(5001) = %d, want 100", pid)
+	}
+
+	// A socket opened after the walk only shows up if a miss walks /proc again
+	if err := os.Symlink("socket:[5002]", filepath.Join(procRoot, "100", "fd", "1")); err != nil {
+		t.Fatal(err)
+	}
+	if pid := x.Lookup("5002"); pid != 0 {
+		t.Errorf("Lookup(5002) on a fresh index = %d, want a miss without a second walk", pid)
+	}
+
+	x.Invalidate()
+	if pid := x.Lookup("5002"); pid != 100 {
+		t.Errorf("Lookup(5002) after Invalidate = %d, want 100", pid)
+	}
+}
+
+// syntheticMachine is a busy developer machine: many processes with many
+// open files, a few of them listening
+func syntheticMachine(procs, fdsPerProc, listeners int) ([]fakeProc, []listener) {
+	ps := make([]fakeProc, procs)
+	var ls []listener
+	for i := range ps {
+		pid := 1000 + i
+		ps[i] = fakeProc{pid: pid, ppid: 1, comm: "proc" + strconv.Itoa(i), cmdline: []string{"/usr/bin/proc", strconv.Itoa(i)},
+			cwd: "/home/dev/p" + strconv.Itoa(i), otherFDs: fdsPerProc}
+		for s := 0; s < 4; s++ {
+			ps[i].sockets = append(ps[i].sockets, strconv.Itoa(pid*10+s))
+		}
+		if i < listeners {
+			ls = append(ls, listener{addr: "0100007F", port: 3000 + i, inode: ps[i].sockets[0]})
+		}
+	}
+	// A listener owned by another user, whose fds we can't read
+	ls = append(ls, listener{addr: "00000000", port: 9229, inode: "1"})
+	return ps, ls
+}
+
+func BenchmarkGetListeningPorts(b *testing.B) {
+	for _, size := range []struct{ procs, fds, listeners int }{
+		{100, 16, 10},
+		{500, 64, 40},
+	} {
+		b.Run(fmt.Sprintf("procs=%d/fds=%d/listeners=%d", size.procs, size.fds, size.listeners), func(b *testing.B) {
+			procs, listeners := syntheticMachine(size.procs, size.fds, size.listeners)
+			useProcTree(b, procs, listeners)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				ports, err := GetListeningPorts()
+				if err != nil || len(ports) != size.listeners+1 {
+					b.Fatalf("got %d ports, err %v", len(ports), err)
+				}
+			}
+		})
+	}
+}
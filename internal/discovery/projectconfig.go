@@ -0,0 +1,366 @@
+package discovery
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Confidence of each kind of project config match. Declarations that
+// publish or bind a port rank above values that merely look like a port.
+const (
+	confidenceCompose        = 0.9  // ports: of a compose service that always starts
+	confidenceComposeProfile = 0.7  // ports: of a service that only starts with a profile
+	confidenceViteConfig     = 0.85 // server.port / preview.port in vite.config.*
+	confidenceScript         = 0.75 // --port, -p or PORT= in a package.json script or Procfile
+	confidenceEnvPort        = 0.7  // PORT=... in a .env file
+	confidenceEnvNamedPort   = 0.6  // <NAME>_PORT=... in a .env file
+	confidenceConfigLine     = 0.4  // port-like text in any other config file
+)
+
+// Compose file names, in the order docker compose looks for them, then the
+// override files it merges into them by default
+var composeFiles = []string{
+	"compose.yaml", "compose.yml", "docker-compose.yml", "docker-compose.yaml",
+	"compose.override.yaml", "compose.override.yml", "docker-compose.override.yml", "docker-compose.override.yaml",
+}
+
+// envFiles are read for PORT keys; .env also supplies compose interpolation
+var envFiles = []string{".env", ".env.local", ".env.development"}
+
+// scanProjectConfig parses the files whose structure is known: compose
+// files, .env files, package.json scripts, vite configs and Procfiles
+func scanProjectConfig(projectPath, projectName string, ports map[int]bool) []ProjectMatch {
+	env := readDotEnv(filepath.Join(projectPath, ".env"))
+
+	var matches []ProjectMatch
+	add := func(file string, port int, confidence float64, context string) {
+		if ports[port] {
+			matches = append(matches, ProjectMatch{
+				ProjectPath: projectPath,
+				ProjectName: projectName,
+				Port:        port,
+				File:        file,
+				Context:     context,
+				Confidence:  confidence,
+			})
+		}
+	}
+
+	for _, name := range composeFiles {
+		scanComposeFile(filepath.Join(projectPath, name), env, func(port int, confidence float64, context string) {
+			add(name, port, confidence, context)
+		})
+	}
+	for _, name := range envFiles {
+		scanEnvFile(filepath.Join(projectPath, name), func(port int, confidence float64, context string) {
+			add(name, port, confidence, context)
+		})
+	}
+	scanPackageScripts(filepath.Join(projectPath, "package.json"), func(port int, context string) {
+		add("package.json", port, confidenceScript, context)
+	})
+	for _, ext := range []string{"js", "ts", "mjs", "mts", "cjs", "cts"} {
+		name := "vite.config." + ext
+		scanViteConfig(filepath.Join(projectPath, name), func(port int, context string) {
+			add(name, port, confidenceViteConfig, context)
+		})
+	}
+	scanProcfile(filepath.Join(projectPath, "Procfile"), func(port int, context string) {
+		add("Procfile", port, confidenceScript, context)
+	})
+
+	return matches
+}
+
+// readDotEnv reads KEY=value lines, ignoring comments, an "export" prefix
+// and surrounding quotes
+func readDotEnv(path string) map[string]string {
+	env := make(map[string]string)
+	file, err := os.Open(path)
+	if err != nil {
+		return env
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		} else if i := strings.Index(value, " #"); i >= 0 {
+			value = strings.TrimSpace(value[:i]) // Inline comment
+		}
+		env[strings.TrimSpace(key)] = value
+	}
+	return env
+}
+
+var interpolationRe = regexp.MustCompile(`\$\$|\$\{([A-Za-z_][A-Za-z0-9_]*)(?:(:?[-?])([^}]*))?\}|\$([A-Za-z_][A-Za-z0-9_]*)`)
+
+// interpolate expands ${VAR}, $VAR, ${VAR:-default} and ${VAR-default} the
+// way docker compose does, from the project's .env only: the dashboard's own
+// environment says nothing about how the project is started
+func interpolate(s string, env map[string]string) string {
+	return interpolationRe.ReplaceAllStringFunc(s, func(m string) string {
+		if m == "$$" {
+			return "$"
+		}
+		sub := interpolationRe.FindStringSubmatch(m)
+		name, op, fallback := sub[1], sub[2], sub[3]
+		if name == "" {
+			name = sub[4]
+		}
+		value, set := env[name]
+		switch op {
+		case ":-":
+			if value == "" {
+				return fallback
+			}
+		case "-":
+			if !set {
+				return fallback
+			}
+		}
+		return value // ${VAR:?err} and ${VAR?err} just use the value
+	})
+}
+
+// composeFile is the part of a compose file that matters for ports
+type composeFile struct {
+	Services map[string]struct {
+		Ports    []yaml.Node `yaml:"ports"`
+		Profiles []string    `yaml:"profiles"`
+	} `yaml:"services"`
+}
+
+// scanComposeFile reports the host ports published by each service, in short
+// ("127.0.0.1:8080:80/tcp", "3000-3005:3000-3005") or long syntax
+func scanComposeFile(path string, env map[string]string, report func(port int, confidence float64, context string)) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	var compose composeFile
+	if err := yaml.Unmarshal(data, &compose); err != nil {
+		return
+	}
+
+	names := make([]string, 0, len(compose.Services))
+	for name := range compose.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		svc := compose.Services[name]
+		confidence := confidenceCompose
+		suffix := ""
+		if len(svc.Profiles) > 0 {
+			confidence = confidenceComposeProfile
+			suffix = fmt.Sprintf(" (profile %s)", strings.Join(svc.Profiles, ", "))
+		}
+
+		for _, node := range svc.Ports {
+			var published, spec string
+			switch node.Kind {
+			case yaml.ScalarNode:
+				spec = interpolate(node.Value, env)
+				published = shortSyntaxPublished(spec)
+			case yaml.MappingNode:
+				var long struct {
+					Target    string `yaml:"target"`
+					Published string `yaml:"published"`
+				}
+				if node.Decode(&long) != nil {
+					continue
+				}
+				published = interpolate(long.Published, env)
+				spec = fmt.Sprintf("%s:%s", published, interpolate(long.Target, env))
+			}
+			for _, port := range portRange(published) {
+				report(port, confidence, fmt.Sprintf("service %s publishes %s%s", name, spec, suffix))
+			}
+		}
+	}
+}
+
+// shortSyntaxPublished returns the host part of a short syntax port mapping,
+// or "" when only a container port is given (published on a random port)
+func shortSyntaxPublished(spec string) string {
+	spec, _, _ = strings.Cut(spec, "/") // Protocol
+	parts := strings.Split(spec, ":")
+	switch {
+	case len(parts) == 2:
+		return parts[0] // HOST:CONTAINER
+	case len(parts) >= 3:
+		return parts[len(parts)-2] // IP:HOST:CONTAINER, IPv6 addresses included
+	}
+	return ""
+}
+
+// maxPortRange bounds how many ports a published range expands to
+const maxPortRange = 100
+
+// portRange parses "8080" or "8000-8010"
+func portRange(s string) []int {
+	s = strings.TrimSpace(s)
+	lo, hi, isRange := strings.Cut(s, "-")
+	first, err := strconv.Atoi(lo)
+	if err != nil || first < 1 || first > 65535 {
+		return nil
+	}
+	if !isRange {
+		return []int{first}
+	}
+	last, err := strconv.Atoi(hi)
+	if err != nil || last < first || last > 65535 || last-first >= maxPortRange {
+		return nil
+	}
+	ports := make([]int, 0, last-first+1)
+	for p := first; p <= last; p++ {
+		ports = append(ports, p)
+	}
+	return ports
+}
+
+// scanEnvFile reports PORT and <NAME>_PORT keys with numeric values
+func scanEnvFile(path string, report func(port int, confidence float64, context string)) {
+	env := readDotEnv(path)
+	keys := make([]string, 0, len(env))
+	for key := range env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		upper := strings.ToUpper(key)
+		confidence := confidenceEnvNamedPort
+		switch {
+		case upper == "PORT":
+			confidence = confidenceEnvPort
+		case strings.HasSuffix(upper, "_PORT"):
+		default:
+			continue
+		}
+		if port, err := strconv.Atoi(env[key]); err == nil && port > 0 && port <= 65535 {
+			report(port, confidence, key+"="+env[key])
+		}
+	}
+}
+
+// commandPortRe finds ports set on a command line: --port 3000, --port=3000,
+// -p 3000, PORT=3000, and bind addresses such as -b 0.0.0.0:3000 or --bind :3000
+var commandPortRe = regexp.MustCompile(`(?:--port[= ]|(?:^|\s)-p\s*|\bPORT=|(?:--bind|-b)[= ](?:[\w.\[\]:-]*):)(\d{2,5})\b`)
+
+// commandPorts returns the ports a command line sets
+func commandPorts(command string) []int {
+	var ports []int
+	for _, m := range commandPortRe.FindAllStringSubmatch(command, -1) {
+		if port, err := strconv.Atoi(m[1]); err == nil && port <= 65535 {
+			ports = append(ports, port)
+		}
+	}
+	return ports
+}
+
+// scanPackageScripts reports ports set by the scripts of a package.json
+func scanPackageScripts(path string, report func(port int, context string)) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	var pkg struct {
+		Scripts map[string]string `json:"scripts"`
+	}
+	if json.Unmarshal(data, &pkg) != nil {
+		return
+	}
+
+	names := make([]string, 0, len(pkg.Scripts))
+	for name := range pkg.Scripts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, port := range commandPorts(pkg.Scripts[name]) {
+			report(port, fmt.Sprintf("scripts.%s: %s", name, pkg.Scripts[name]))
+		}
+	}
+}
+
+var (
+	viteBlockRe = regexp.MustCompile(`\b(server|preview)\s*:\s*\{`)
+	vitePortRe  = regexp.MustCompile(`\bport\s*:\s*(\d{2,5})\b`)
+)
+
+// scanViteConfig reports the port: of the server and preview blocks of a
+// vite config. It doesn't evaluate the file; ports computed at runtime
+// aren't found.
+func scanViteConfig(path string, report func(port int, context string)) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	source := string(data)
+
+	for _, loc := range viteBlockRe.FindAllStringSubmatchIndex(source, -1) {
+		block := source[loc[1]:]
+		// Only look inside this block's braces, not at nested or later ones
+		depth := 1
+		for i, r := range block {
+			if r == '{' {
+				depth++
+			} else if r == '}' {
+				if depth--; depth == 0 {
+					block = block[:i]
+					break
+				}
+			}
+		}
+		if m := vitePortRe.FindStringSubmatch(block); m != nil {
+			if port, err := strconv.Atoi(m[1]); err == nil {
+				report(port, fmt.Sprintf("%s.port: %d", source[loc[2]:loc[3]], port))
+			}
+		}
+	}
+}
+
+// scanProcfile reports ports set by the commands of a Procfile
+func scanProcfile(path string, report func(port int, context string)) {
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		process, command, ok := strings.Cut(line, ":")
+		if !ok || strings.HasPrefix(line, "#") {
+			continue
+		}
+		for _, port := range commandPorts(command) {
+			report(port, fmt.Sprintf("%s: %s", process, strings.TrimSpace(command)))
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package discovery
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestInterpolate(t *testing.T) {
+	env := map[string]string{"PORT": "8080", "EMPTY": "", "HOST": "127.0.0.1"}
+
+	tests := []struct {
+		in, want string
+	}{
+		{"${PORT}:80", "8080:80"},
+		{"$PORT:80", "8080:80"},
+		{"${HOST}:${PORT}:80", "127.0.0.1:8080:80"},
+		{"${MISSING:-3000}:3000", "3000:3000"},
+		{"${MISSING-3000}:3000", "3000:3000"},
+		{"${EMPTY:-3000}:3000", "3000:3000"},
+		{"${EMPTY-3000}:3000", ":3000"}, // Set but empty keeps the empty value
+		{"${PORT:-3000}", "8080"},
+		{"${PORT:?PORT is required}", "8080"},
+		{"${MISSING}", ""},
+		{"$$PORT", "$PORT"},
+		{"80", "80"},
+	}
+
+	for _, tt := range tests {
+		if got := interpolate(tt.in, env); got != tt.want {
+			t.Errorf("interpolate(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestShortSyntaxPublished(t *testing.T) {
+	tests := []struct {
+		spec, want string
+	}{
+		{"80", ""},
+		{"80/udp", ""},
+		{"8080:80", "8080"},
+		{"8080:80/tcp", "8080"},
+		{"3000-3005:3000-3005", "3000-3005"},
+		{"127.0.0.1:8080:80", "8080"},
+		{"127.0.0.1::80", ""},
+		{"[::1]:5432:5432", "5432"},
+		{"::1:6379:6379", "6379"},
+	}
+
+	for _, tt := range tests {
+		if got := shortSyntaxPublished(tt.spec); got != tt.want {
+			t.Errorf("shortSyntaxPublished(%q) = %q, want %q", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestScanProjectConfigComposeOverride(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"compose.yaml":          "services:\n  web:\n    ports: [\"${WEB_PORT:-8080}:80\"]\n",
+		"compose.override.yaml": "services:\n  web:\n    ports:\n      - published: 9229\n        target: 9229\n",
+		".env":                  "WEB_PORT=8081\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	matches := scanProjectConfig(dir, "shop", map[int]bool{8081: true, 9229: true})
+	var got []string
+	for _, m := range matches {
+		got = append(got, m.File+": "+m.Context)
+	}
+	want := []string{
+		"compose.yaml: service web publishes 8081:80",
+		"compose.override.yaml: service web publishes 9229:9229",
+		".env: WEB_PORT=8081",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("matches = %q, want %q", got, want)
+	}
+}
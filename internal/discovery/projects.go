@@ -2,12 +2,13 @@ package discovery
 
 import (
 	"bufio"
-	"fmt"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+
+	"dev-machine-proxy/internal/projects"
 )
 
 // ProjectMatch represents a port reference found in a project
@@ -16,15 +17,12 @@ type ProjectMatch struct {
 	ProjectName string
 	Port        int
 	File        string
-	Context     string // The line or context where we found the port
+	Context     string  // The line or context where we found the port
+	Confidence  float64 // How sure the match is, from 0 to 1 (see the confidence* constants)
 }
 
-// ScanProjectsForPorts scans a directory of projects for port references
-func ScanProjectsForPorts(projectsDir string, ports []int) ([]ProjectMatch, error) {
-	if projectsDir == "" {
-		return nil, nil
-	}
-
+// ScanProjectsForPorts scans the given projects for port references
+func ScanProjectsForPorts(locations []projects.Location, ports []int) []ProjectMatch {
 	// Convert ports to a set for quick lookup
 	portSet := make(map[int]bool)
 	for _, p := range ports {
@@ -32,40 +30,21 @@ func ScanProjectsForPorts(projectsDir string, ports []int) ([]ProjectMatch, erro
 	}
 
 	var matches []ProjectMatch
-
-	// List top-level directories (each is a project)
-	entries, err := os.ReadDir(projectsDir)
-	if err != nil {
-		return nil, fmt.Errorf("reading projects directory: %w", err)
+	for _, loc := range locations {
+		matches = append(matches, scanProject(loc.Path, filepath.Base(loc.Path), portSet)...)
 	}
 
-	for _, entry := range entries {
-		if !entry.IsDir() {
-			continue
-		}
-
-		projectPath := filepath.Join(projectsDir, entry.Name())
-		projectMatches := scanProject(projectPath, entry.Name(), portSet)
-		matches = append(matches, projectMatches...)
-	}
-
-	return matches, nil
+	return matches
 }
 
 // scanProject searches a single project directory for port references
 func scanProject(projectPath, projectName string, ports map[int]bool) []ProjectMatch {
-	var matches []ProjectMatch
+	// Compose, .env, package.json, vite and Procfile are parsed for what
+	// they declare
+	matches := scanProjectConfig(projectPath, projectName, ports)
 
-	// Files likely to contain port configurations
+	// Other files likely to contain port configurations
 	configFiles := []string{
-		"docker-compose.yml",
-		"docker-compose.yaml",
-		"compose.yml",
-		"compose.yaml",
-		".env",
-		".env.local",
-		".env.development",
-		"package.json",
 		"Makefile",
 		"Dockerfile",
 		"config.json",
@@ -129,14 +108,13 @@ func scanFileForPorts(filePath, projectPath, projectName string, ports map[int]b
 	}
 	defer file.Close()
 
-	// Regex patterns for port references
+	// Regex patterns for port references. A bare number isn't enough: that
+	// would match timeouts and versions.
 	portPatterns := []*regexp.Regexp{
-		regexp.MustCompile(`[Pp]ort["\s:=]+(\d{2,5})`),            // port: 3000, PORT=3000, "port": 3000
-		regexp.MustCompile(`(\d{2,5}):(\d{2,5})`),                 // 8080:80 (docker port mapping)
-		regexp.MustCompile(`localhost:(\d{2,5})`),                 // localhost:3000
-		regexp.MustCompile(`127\.0\.0\.1:(\d{2,5})`),              // 127.0.0.1:3000
-		regexp.MustCompile(`0\.0\.0\.0:(\d{2,5})`),                // 0.0.0.0:3000
-		regexp.MustCompile(`["\s:=](\d{4,5})["\s,\n\r]`),          // Generic 4-5 digit numbers that might be ports
+		regexp.MustCompile(`[Pp]ort["\s:=]+(\d{2,5})`), // port: 3000, PORT=3000, "port": 3000
+		regexp.MustCompile(`localhost:(\d{2,5})`),      // localhost:3000
+		regexp.MustCompile(`127\.0\.0\.1:(\d{2,5})`),   // 127.0.0.1:3000
+		regexp.MustCompile(`0\.0\.0\.0:(\d{2,5})`),     // 0.0.0.0:3000
 	}
 
 	relPath, _ := filepath.Rel(projectPath, filePath)
@@ -179,6 +157,7 @@ func scanFileForPorts(filePath, projectPath, projectName string, ports map[int]b
 						Port:        port,
 						File:        relPath,
 						Context:     strings.TrimSpace(line),
+						Confidence:  confidenceConfigLine,
 					})
 				}
 			}
@@ -188,12 +167,108 @@ func scanFileForPorts(filePath, projectPath, projectName string, ports map[int]b
 	return matches
 }
 
-// FindProjectForPort finds the best project match for a given port
+// Project match methods, recorded on Service.ProjectSource. Listed from most
+// to least trustworthy.
+const (
+	ProjectSourceCompose = "compose-label"   // com.docker.compose.project.working_dir label
+	ProjectSourceCwd     = "process-cwd"     // Working directory of the listening process
+	ProjectSourceCmdline = "process-cmdline" // A path argument of the listening process
+	ProjectSourceParent  = "parent-process"  // Working directory or path argument of an ancestor
+	ProjectSourceConfig  = "config-scan"     // Port number found in a project config file
+)
+
+// maxAncestorDepth bounds how far up the process tree we look for a project
+// (e.g. node <- npm <- sh <- make)
+const maxAncestorDepth = 5
+
+// FindProjectForProcess maps a listening process to the project that
+// contains its working directory or a path on its command line, checking its
+// ancestors when the process itself gives no hint. It returns the project
+// path and the ProjectSource* method that matched.
+func FindProjectForProcess(locations []projects.Location, lp ListeningPort) (string, string) {
+	if len(locations) == 0 || lp.PID == 0 {
+		return "", ""
+	}
+
+	if project := projectContaining(locations, lp.Cwd); project != "" {
+		return project, ProjectSourceCwd
+	}
+	if project := projectFromCmdline(locations, lp.Cmdline, lp.Cwd); project != "" {
+		return project, ProjectSourceCmdline
+	}
+
+	ppid := lp.PPID
+	for depth := 0; depth < maxAncestorDepth && ppid > 1; depth++ {
+		info, ok := procIndex.Process(ppid)
+		if !ok {
+			break
+		}
+		if project := projectContaining(locations, info.Cwd); project != "" {
+			return project, ProjectSourceParent
+		}
+		if project := projectFromCmdline(locations, info.Cmdline, info.Cwd); project != "" {
+			return project, ProjectSourceParent
+		}
+		ppid = info.PPID
+	}
+
+	return "", ""
+}
+
+// projectFromCmdline checks the path-like arguments of a command line
+func projectFromCmdline(locations []projects.Location, cmdline []string, cwd string) string {
+	// Skip argv[0]: interpreters and tools live outside project trees, and a
+	// project-local binary (node_modules/.bin/vite) is also caught via its args
+	for _, arg := range cmdline[min(1, len(cmdline)):] {
+		// --config=/path/to/file style flags
+		if _, value, ok := strings.Cut(arg, "="); ok && strings.HasPrefix(arg, "-") {
+			arg = value
+		}
+		if !strings.Contains(arg, "/") {
+			continue
+		}
+		if !filepath.IsAbs(arg) {
+			if cwd == "" {
+				continue
+			}
+			arg = filepath.Join(cwd, arg)
+		}
+		if project := projectContaining(locations, arg); project != "" {
+			return project
+		}
+	}
+	return ""
+}
+
+// projectContaining returns the innermost project that contains path, so a
+// package of a monorepo wins over the monorepo itself, or "" if none does
+func projectContaining(locations []projects.Location, path string) string {
+	if path == "" {
+		return ""
+	}
+	path = filepath.Clean(path)
+
+	best := ""
+	for _, loc := range locations {
+		rel, err := filepath.Rel(loc.Path, path)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if len(loc.Path) > len(best) {
+			best = loc.Path
+		}
+	}
+	return best
+}
+
+// FindProjectForPort finds the most confident project match for a given
+// port; the first one found wins ties
 func FindProjectForPort(matches []ProjectMatch, port int) *ProjectMatch {
+	var best *ProjectMatch
 	for i, m := range matches {
-		if m.Port == port {
-			return &matches[i]
+		if m.Port == port && (best == nil || m.Confidence > best.Confidence) {
+			best = &matches[i]
 		}
 	}
-	return nil
+	return best
 }
@@ -0,0 +1,71 @@
+package discovery
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	refreshDelay    = 500 * time.Millisecond // Quiet time after a container event before its ports are refreshed
+	refreshMaxDelay = 3 * time.Second        // Longest a steady stream of events can put a refresh off
+)
+
+// refreshBatcher coalesces the ports of container events into one targeted
+// refresh. A `compose up` of several containers then refreshes once, on the
+// batcher's own goroutine, instead of once per event on the event loop.
+type refreshBatcher struct {
+	refresh         func(ports []int)
+	delay, maxDelay time.Duration
+
+	mu    sync.Mutex
+	ports map[int]bool // Pending ports; nil when nothing is pending
+	first time.Time    // When the pending batch started
+	timer *time.Timer
+}
+
+func newRefreshBatcher(refresh func(ports []int), delay, maxDelay time.Duration) *refreshBatcher {
+	return &refreshBatcher{refresh: refresh, delay: delay, maxDelay: maxDelay}
+}
+
+// add queues ports for the next refresh. An empty list still queues one,
+// since internal container ports are rebuilt on every refresh.
+func (b *refreshBatcher) add(ports []int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	if b.ports == nil {
+		b.ports = make(map[int]bool)
+		b.first = now
+	}
+	for _, p := range ports {
+		b.ports[p] = true
+	}
+
+	wait := min(b.delay, max(b.maxDelay-now.Sub(b.first), 0))
+	if b.timer == nil {
+		b.timer = time.AfterFunc(wait, b.flush)
+	} else {
+		b.timer.Reset(wait)
+	}
+}
+
+// flush runs the refresh for everything queued so far
+func (b *refreshBatcher) flush() {
+	b.mu.Lock()
+	if b.ports == nil {
+		b.mu.Unlock()
+		return // Already flushed by an earlier firing of the timer
+	}
+	ports := make([]int, 0, len(b.ports))
+	for p := range b.ports {
+		ports = append(ports, p)
+	}
+	b.ports = nil
+	b.timer = nil
+	b.mu.Unlock()
+
+	sort.Ints(ports)
+	b.refresh(ports)
+}
@@ -0,0 +1,63 @@
+package discovery
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRefreshBatcherCoalesces(t *testing.T) {
+	var mu sync.Mutex
+	var calls [][]int
+	b := newRefreshBatcher(func(ports []int) {
+		mu.Lock()
+		calls = append(calls, ports)
+		mu.Unlock()
+	}, 50*time.Millisecond, time.Second)
+
+	// A compose up: one event per container in quick succession
+	for _, ports := range [][]int{{5432}, {6379}, {8080, 8443}, {}, {5432}} {
+		b.add(ports)
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := [][]int{{5432, 6379, 8080, 8443}}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("refreshes = %v, want %v", calls, want)
+	}
+}
+
+func TestRefreshBatcherMaxDelay(t *testing.T) {
+	refreshed := make(chan []int, 4)
+	b := newRefreshBatcher(func(ports []int) { refreshed <- ports }, 40*time.Millisecond, 100*time.Millisecond)
+
+	// Events keep coming more often than the delay; the max delay still flushes
+	deadline := time.Now().Add(300 * time.Millisecond)
+	for port := 1; time.Now().Before(deadline); port++ {
+		b.add([]int{port})
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case <-refreshed:
+	default:
+		t.Fatal("no refresh while events kept arriving")
+	}
+}
+
+func TestRefreshBatcherEmptyQueuesRefresh(t *testing.T) {
+	refreshed := make(chan []int, 1)
+	b := newRefreshBatcher(func(ports []int) { refreshed <- ports }, time.Millisecond, time.Second)
+	b.add(nil)
+	select {
+	case ports := <-refreshed:
+		if len(ports) != 0 {
+			t.Errorf("ports = %v, want none", ports)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("an event with no host ports didn't refresh")
+	}
+}
@@ -0,0 +1,497 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rule identifies a service from what discovery learned about its port.
+// Every condition set in Match must hold. Rules without HTTP conditions are
+// checked before probing and rules with them after; within each group the
+// first matching rule wins.
+type Rule struct {
+	Match    RuleMatch `json:"match"`
+	Name     string    `json:"name,omitempty"`
+	Icon     string    `json:"icon,omitempty"`     // Emoji or image URL shown on the card
+	Category string    `json:"category,omitempty"` // Free-form grouping, e.g. database, monitoring
+	URLPath  string    `json:"urlPath,omitempty"`  // Appended to the service URL, e.g. /admin
+	HTTP     bool      `json:"http,omitempty"`     // Probe the port for HTTP even if nothing else suggests it
+}
+
+// RuleMatch holds a rule's conditions. Text comparisons are case-insensitive
+// substring matches unless noted otherwise.
+type RuleMatch struct {
+	Port     int    `json:"port,omitempty"`
+	Protocol string `json:"protocol,omitempty"` // tcp (default) or udp
+	Process  string `json:"process,omitempty"`  // Exact process name as shown on the card
+	Cmdline  string `json:"cmdline,omitempty"`  // Regular expression over the full command line
+	Image    string `json:"image,omitempty"`    // Container image
+	Header   string `json:"header,omitempty"`   // "Name: value", or just "Name" for presence
+	Title    string `json:"title,omitempty"`    // HTML <title>
+	Body     string `json:"body,omitempty"`     // First 64KB of the response to GET /
+	Favicon  string `json:"favicon,omitempty"`  // Exact hash of the service icon (see FetchIcon)
+}
+
+// Rule condition names, as reported by TestRule
+const (
+	CondPort     = "port"
+	CondProtocol = "protocol"
+	CondProcess  = "process"
+	CondCmdline  = "cmdline"
+	CondImage    = "image"
+	CondHeader   = "header"
+	CondTitle    = "title"
+	CondBody     = "body"
+	CondFavicon  = "favicon"
+)
+
+// compiledRule is a validated Rule ready for matching
+type compiledRule struct {
+	Rule
+	builtin     bool
+	cmdline     *regexp.Regexp
+	headerName  string
+	headerValue string
+}
+
+// ruleSubject is what a rule is matched against
+type ruleSubject struct {
+	Port     int
+	Protocol string
+	Process  string
+	Cmdline  string
+	Image    string
+	Probe    *HTTPProbeResult // nil before probing or for non-HTTP ports
+}
+
+func compileRule(r Rule) (*compiledRule, error) {
+	m := r.Match
+	if m.Port == 0 && m.Process == "" && m.Cmdline == "" && m.Image == "" &&
+		m.Header == "" && m.Title == "" && m.Body == "" && m.Favicon == "" {
+		return nil, errors.New("rule has no match conditions")
+	}
+	if m.Protocol != "" && m.Protocol != "tcp" && m.Protocol != "udp" {
+		return nil, fmt.Errorf("protocol must be tcp or udp, not %q", m.Protocol)
+	}
+
+	cr := &compiledRule{Rule: r}
+	if m.Cmdline != "" {
+		re, err := regexp.Compile(m.Cmdline)
+		if err != nil {
+			return nil, fmt.Errorf("cmdline: %w", err)
+		}
+		cr.cmdline = re
+	}
+	if m.Header != "" {
+		name, value, _ := strings.Cut(m.Header, ":")
+		cr.headerName = strings.TrimSpace(name)
+		cr.headerValue = strings.ToLower(strings.TrimSpace(value))
+	}
+	return cr, nil
+}
+
+// needsProbe reports whether the rule can only be checked against an HTTP
+// probe result
+func (r *compiledRule) needsProbe() bool {
+	m := r.Match
+	return m.Header != "" || m.Title != "" || m.Body != "" || m.Favicon != ""
+}
+
+// portOnly reports whether the rule only looks at the port number, which
+// makes it a weak, conventional guess
+func (r *compiledRule) portOnly() bool {
+	m := r.Match
+	return m.Port != 0 && m.Process == "" && m.Cmdline == "" && m.Image == "" && !r.needsProbe()
+}
+
+// conditions evaluates each condition the rule sets
+func (r *compiledRule) conditions(s ruleSubject) map[string]bool {
+	m := r.Match
+	result := make(map[string]bool)
+	containsFold := func(haystack, needle string) bool {
+		return strings.Contains(strings.ToLower(haystack), strings.ToLower(needle))
+	}
+
+	protocol := m.Protocol
+	if protocol == "" {
+		protocol = "tcp"
+	}
+	result[CondProtocol] = s.Protocol == protocol
+
+	if m.Port != 0 {
+		result[CondPort] = s.Port == m.Port
+	}
+	if m.Process != "" {
+		result[CondProcess] = s.Process == m.Process
+	}
+	if r.cmdline != nil {
+		result[CondCmdline] = s.Cmdline != "" && r.cmdline.MatchString(s.Cmdline)
+	}
+	if m.Image != "" {
+		result[CondImage] = s.Image != "" && containsFold(s.Image, m.Image)
+	}
+
+	probe := s.Probe
+	if probe == nil {
+		probe = &HTTPProbeResult{}
+	}
+	if m.Header != "" {
+		values := probe.Header.Values(r.headerName)
+		result[CondHeader] = false
+		for _, v := range values {
+			if strings.Contains(strings.ToLower(v), r.headerValue) {
+				result[CondHeader] = true
+			}
+		}
+	}
+	if m.Title != "" {
+		result[CondTitle] = probe.Title != "" && containsFold(probe.Title, m.Title)
+	}
+	if m.Body != "" {
+		result[CondBody] = containsFold(probe.Body, m.Body)
+	}
+	if m.Favicon != "" {
+		result[CondFavicon] = probe.FaviconHash != "" && probe.FaviconHash == m.Favicon
+	}
+	return result
+}
+
+func (r *compiledRule) matches(s ruleSubject) bool {
+	for _, ok := range r.conditions(s) {
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// describe summarises the rule for provenance
+func (r *compiledRule) describe() string {
+	m := r.Match
+	var parts []string
+	if m.Port != 0 {
+		parts = append(parts, fmt.Sprintf("port %d", m.Port))
+	}
+	if m.Process != "" {
+		parts = append(parts, "process "+m.Process)
+	}
+	if m.Cmdline != "" {
+		parts = append(parts, "command line /"+m.Cmdline+"/")
+	}
+	if m.Image != "" {
+		parts = append(parts, "image "+m.Image)
+	}
+	if m.Header != "" {
+		parts = append(parts, "header "+m.Header)
+	}
+	if m.Title != "" {
+		parts = append(parts, fmt.Sprintf("title %q", m.Title))
+	}
+	if m.Body != "" {
+		parts = append(parts, fmt.Sprintf("body %q", m.Body))
+	}
+	if m.Favicon != "" {
+		parts = append(parts, "favicon "+m.Favicon)
+	}
+
+	origin := "rule"
+	if r.builtin {
+		origin = "built-in rule"
+	}
+	return fmt.Sprintf("%s: %s", origin, strings.Join(parts, ", "))
+}
+
+// RuleSet is the ordered list of fingerprint rules: the user's rules from
+// the rules file, followed by the built-in defaults. The file is re-read
+// whenever it changes.
+type RuleSet struct {
+	path string
+
+	mu      sync.RWMutex
+	modTime time.Time
+	user    []Rule
+	rules   []*compiledRule
+	loadErr error
+}
+
+// getRulesPath returns the path to the user's fingerprint rules file
+func getRulesPath() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		configDir = os.Getenv("HOME")
+	}
+	return filepath.Join(configDir, "dev-machine-proxy", "fingerprint-rules.json")
+}
+
+// NewRuleSet creates a rule set backed by the JSON file at path, which holds
+// an array of rules. A missing file means only the defaults apply. The file
+// is read by the first Reload.
+func NewRuleSet(path string) *RuleSet {
+	return &RuleSet{path: path, rules: compileRules(nil)}
+}
+
+// Path returns the rules file location
+func (s *RuleSet) Path() string {
+	return s.path
+}
+
+// Reload re-reads the rules file if it changed since the last load. Invalid
+// rules are skipped and reported in the returned error; the valid ones still
+// apply. An unchanged file returns nil; UserRules keeps reporting the error.
+func (s *RuleSet) Reload() error {
+	var modTime time.Time
+	info, err := os.Stat(s.path)
+	if err == nil {
+		modTime = info.ModTime()
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if modTime.Equal(s.modTime) {
+		return nil
+	}
+	s.modTime = modTime
+
+	var user []Rule
+	s.loadErr = nil
+	if !modTime.IsZero() {
+		data, err := os.ReadFile(s.path)
+		if err == nil {
+			err = json.Unmarshal(data, &user)
+		}
+		if err != nil {
+			s.loadErr = fmt.Errorf("reading %s: %w", s.path, err)
+			return s.loadErr // Keep the previous rules
+		}
+	}
+
+	var errs []error
+	valid := make([]Rule, 0, len(user))
+	for i, r := range user {
+		if _, err := compileRule(r); err != nil {
+			errs = append(errs, fmt.Errorf("rule %d: %w", i+1, err))
+			continue
+		}
+		valid = append(valid, r)
+	}
+	s.user = user
+	s.rules = compileRules(valid)
+	if len(errs) > 0 {
+		s.loadErr = fmt.Errorf("%s: %v", s.path, errs)
+	}
+	return s.loadErr
+}
+
+// compileRules puts the user's rules ahead of the defaults
+func compileRules(user []Rule) []*compiledRule {
+	rules := make([]*compiledRule, 0, len(user)+len(defaultRules))
+	for _, r := range user {
+		if cr, err := compileRule(r); err == nil {
+			rules = append(rules, cr)
+		}
+	}
+	for _, r := range defaultRules {
+		cr, err := compileRule(r)
+		if err != nil {
+			panic(fmt.Sprintf("invalid built-in rule %+v: %v", r, err))
+		}
+		cr.builtin = true
+		rules = append(rules, cr)
+	}
+	return rules
+}
+
+// UserRules returns the rules from the rules file and the error from loading
+// it, if any
+func (s *RuleSet) UserRules() ([]Rule, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Rule{}, s.user...), s.loadErr
+}
+
+// DefaultRules returns the built-in rules, which apply after the user's
+func DefaultRules() []Rule {
+	return append([]Rule{}, defaultRules...)
+}
+
+// match returns the first rule that matches the subject. With probed set,
+// only rules that need an HTTP probe are considered, otherwise only rules
+// that don't.
+func (s *RuleSet) match(subject ruleSubject, probed bool) *compiledRule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, r := range s.rules {
+		if r.needsProbe() == probed && r.matches(subject) {
+			return r
+		}
+	}
+	return nil
+}
+
+// wantsHTTP reports whether any matching rule marks the port as HTTP
+func (s *RuleSet) wantsHTTP(subject ruleSubject) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, r := range s.rules {
+		if r.HTTP && !r.needsProbe() && r.matches(subject) {
+			return true
+		}
+	}
+	return false
+}
+
+// subjectFor collects what rules match against from a candidate
+func subjectFor(c *Candidate, probe *HTTPProbeResult) ruleSubject {
+	return ruleSubject{
+		Port:     c.Port.Port,
+		Protocol: c.Port.Protocol,
+		Process:  c.Port.Process,
+		Cmdline:  commandLine(c.Port.Cmdline),
+		Image:    c.Service.Image,
+		Probe:    probe,
+	}
+}
+
+// applyRule proposes a matched rule's name, icon, category and URL path
+func applyRule(c *Candidate, r *compiledRule, priority int, confidence float64) {
+	reason := r.describe()
+	for field, value := range map[Field]string{
+		FieldName:     r.Name,
+		FieldIcon:     r.Icon,
+		FieldCategory: r.Category,
+		FieldURLPath:  r.URLPath,
+	} {
+		c.Propose(Contribution{Field: field, Value: value, Priority: priority, Confidence: confidence, Reason: reason})
+	}
+}
+
+// ruleEnricher applies the rules that don't need an HTTP probe: ports,
+// processes, command lines and container images. Rules on headers, titles,
+// bodies and favicons are applied by the HTTP probe.
+type ruleEnricher struct {
+	rules *RuleSet
+}
+
+func (e *ruleEnricher) Name() string { return "rules" }
+
+func (e *ruleEnricher) Prepare(run *Run) error {
+	return e.rules.Reload()
+}
+
+func (e *ruleEnricher) Enrich(run *Run, c *Candidate) {
+	r := e.rules.match(subjectFor(c, nil), false)
+	if r == nil {
+		return
+	}
+
+	// A built-in rule on the port alone is only a convention; one of yours
+	// says what runs there, so it outranks titles and project names
+	if r.portOnly() && r.builtin {
+		applyRule(c, r, PriorityKnownPort, 0.3)
+		c.AddTag("known-port")
+		return
+	}
+	applyRule(c, r, PriorityRule, 1)
+}
+
+// RuleTestResult reports how a rule fares against a live port
+type RuleTestResult struct {
+	Port       int             `json:"port"`
+	Protocol   string          `json:"protocol"`
+	Matched    bool            `json:"matched"`
+	Conditions map[string]bool `json:"conditions"` // Per condition the rule sets
+	Process    string          `json:"process"`
+	Command    string          `json:"command"`
+	Image      string          `json:"image,omitempty"`
+	IsHTTP     bool            `json:"isHttp"`
+	StatusCode int             `json:"statusCode,omitempty"`
+	Title      string          `json:"title,omitempty"`
+	Headers    http.Header     `json:"headers,omitempty"`
+	Favicon    string          `json:"favicon,omitempty"` // Hash of the icon at IconURL
+	IconURL    string          `json:"iconUrl,omitempty"`
+}
+
+// ErrInvalidRule is returned by TestRule for rules that can't be compiled
+var ErrInvalidRule = errors.New("invalid rule")
+
+// ErrNotListening is returned when testing a rule against a port nothing
+// listens on
+var ErrNotListening = errors.New("nothing is listening on that port")
+
+// TestRule checks a rule against what is listening on port right now,
+// probing it fresh rather than using cached results. It returns an error for
+// an invalid rule or a port nothing listens on.
+func (d *Discoverer) TestRule(ctx context.Context, rule Rule, port int) (RuleTestResult, error) {
+	cr, err := compileRule(rule)
+	if err != nil {
+		return RuleTestResult{}, fmt.Errorf("%w: %v", ErrInvalidRule, err)
+	}
+
+	protocol := rule.Match.Protocol
+	if protocol == "" {
+		protocol = "tcp"
+	}
+	ports, err := GetListeningPorts()
+	if err != nil {
+		return RuleTestResult{}, err
+	}
+	var lp *ListeningPort
+	for i := range ports {
+		if ports[i].Port == port && ports[i].Protocol == protocol {
+			lp = &ports[i]
+			break
+		}
+	}
+	if lp == nil {
+		return RuleTestResult{}, fmt.Errorf("%w: %d/%s", ErrNotListening, port, protocol)
+	}
+
+	subject := ruleSubject{
+		Port:     lp.Port,
+		Protocol: lp.Protocol,
+		Process:  lp.Process,
+		Cmdline:  commandLine(lp.Cmdline),
+	}
+	for _, t := range d.docker {
+		if c := t.ContainerByPort(lp.Port, lp.Protocol); c != nil {
+			subject.Image = c.Image
+			break
+		}
+	}
+
+	result := RuleTestResult{
+		Port:     lp.Port,
+		Protocol: lp.Protocol,
+		Process:  subject.Process,
+		Command:  subject.Cmdline,
+		Image:    subject.Image,
+	}
+	if lp.Protocol == "tcp" {
+		probe := ProbeHTTPContext(ctx, DialHost(lp.BindAddresses), lp.Port)
+		if icon, ok := FetchIcon(ctx, probe); ok {
+			probe.Icon, probe.FaviconHash = icon.Source, icon.Hash
+		}
+		subject.Probe = &probe
+		result.IsHTTP = probe.IsHTTP
+		result.StatusCode = probe.StatusCode
+		result.Title = probe.Title
+		result.Headers = probe.Header
+		result.Favicon = probe.FaviconHash
+		result.IconURL = probe.Icon
+	}
+
+	result.Conditions = cr.conditions(subject)
+	result.Matched = cr.matches(subject)
+	return result, nil
+}
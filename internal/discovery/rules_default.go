@@ -0,0 +1,125 @@
+package discovery
+
+// Rule categories used by the built-in rules
+const (
+	CategoryDatabase   = "database"
+	CategoryCache      = "cache"
+	CategoryQueue      = "queue"
+	CategoryDevServer  = "dev-server"
+	CategoryWeb        = "web"
+	CategoryMonitoring = "monitoring"
+	CategoryTools      = "tools"
+	CategoryNetwork    = "network"
+)
+
+// defaultRules are the built-in fingerprint rules, applied after the user's.
+// Header and title rules come first within their group; port rules are only
+// conventions and lose to anything more specific.
+var defaultRules = concatRules(
+	// Server software, from the Server or X-Powered-By header
+	headerRules([][2]string{
+		{"nginx", "Nginx"},
+		{"apache", "Apache"},
+		{"express", "Express.js"},
+		{"kestrel", "ASP.NET"},
+		{"gunicorn", "Python (Gunicorn)"},
+		{"uvicorn", "Python (Uvicorn)"},
+		{"werkzeug", "Flask"},
+		{"jetty", "Jetty"},
+		{"tomcat", "Tomcat"},
+		{"openresty", "OpenResty"},
+		{"caddy", "Caddy"},
+		{"traefik", "Traefik"},
+	}),
+
+	// Web apps, from the page title
+	[]Rule{
+		{Match: RuleMatch{Title: "grafana"}, Name: "Grafana", Category: CategoryMonitoring},
+		{Match: RuleMatch{Title: "prometheus"}, Name: "Prometheus", Category: CategoryMonitoring},
+		{Match: RuleMatch{Title: "portainer"}, Name: "Portainer", Category: CategoryTools},
+		{Match: RuleMatch{Title: "jenkins"}, Name: "Jenkins", Category: CategoryTools},
+		{Match: RuleMatch{Title: "gitlab"}, Name: "GitLab", Category: CategoryTools},
+		{Match: RuleMatch{Title: "gitea"}, Name: "Gitea", Category: CategoryTools},
+		{Match: RuleMatch{Title: "nextcloud"}, Name: "Nextcloud", Category: CategoryTools},
+		{Match: RuleMatch{Title: "home assistant"}, Name: "Home Assistant", Category: CategoryTools},
+		{Match: RuleMatch{Title: "jupyter"}, Name: "Jupyter", Category: CategoryDevServer},
+		{Match: RuleMatch{Title: "pgadmin"}, Name: "pgAdmin", Category: CategoryDatabase},
+		{Match: RuleMatch{Title: "adminer"}, Name: "Adminer", Category: CategoryDatabase},
+		{Match: RuleMatch{Title: "phpmyadmin"}, Name: "phpMyAdmin", Category: CategoryDatabase},
+		{Match: RuleMatch{Title: "mailhog"}, Name: "MailHog", Category: CategoryTools},
+		{Match: RuleMatch{Title: "rabbitmq"}, Name: "RabbitMQ", Category: CategoryQueue},
+		{Match: RuleMatch{Title: "kibana"}, Name: "Kibana", Category: CategoryMonitoring},
+		{Match: RuleMatch{Title: "swagger"}, Name: "Swagger UI", Category: CategoryTools},
+		{Match: RuleMatch{Title: "redoc"}, Name: "ReDoc", Category: CategoryTools},
+	},
+
+	// Conventional TCP ports; http marks ports worth probing for HTTP
+	[]Rule{
+		{Match: RuleMatch{Port: 22}, Name: "SSH", Category: CategoryNetwork},
+		{Match: RuleMatch{Port: 80}, Name: "HTTP", Category: CategoryWeb, HTTP: true},
+		{Match: RuleMatch{Port: 443}, Name: "HTTPS", Category: CategoryWeb, HTTP: true},
+		{Match: RuleMatch{Port: 1433}, Name: "MSSQL", Category: CategoryDatabase},
+		{Match: RuleMatch{Port: 1521}, Name: "Oracle DB", Category: CategoryDatabase},
+		{Match: RuleMatch{Port: 2375}, Name: "Docker (unencrypted)", Category: CategoryTools},
+		{Match: RuleMatch{Port: 2376}, Name: "Docker (TLS)", Category: CategoryTools},
+		{Match: RuleMatch{Port: 3000}, Name: "Dev Server (Node/Rails/etc)", Category: CategoryDevServer, HTTP: true},
+		{Match: RuleMatch{Port: 3306}, Name: "MySQL", Category: CategoryDatabase},
+		{Match: RuleMatch{Port: 4200}, Name: "Angular Dev Server", Category: CategoryDevServer, HTTP: true},
+		{Match: RuleMatch{Port: 5000}, Name: "Flask/ASP.NET Dev Server", Category: CategoryDevServer, HTTP: true},
+		{Match: RuleMatch{Port: 5173}, Name: "Vite Dev Server", Category: CategoryDevServer, HTTP: true},
+		{Match: RuleMatch{Port: 5432}, Name: "PostgreSQL", Category: CategoryDatabase},
+		{Match: RuleMatch{Port: 5672}, Name: "RabbitMQ", Category: CategoryQueue},
+		{Match: RuleMatch{Port: 6379}, Name: "Redis", Category: CategoryCache},
+		{Match: RuleMatch{Port: 8000}, Name: "Python Dev Server", Category: CategoryDevServer, HTTP: true},
+		{Match: RuleMatch{Port: 8080}, Name: "HTTP Alt / Tomcat", Category: CategoryWeb, HTTP: true},
+		{Match: RuleMatch{Port: 8081}, Name: "HTTP Alt", Category: CategoryWeb, HTTP: true},
+		{Match: RuleMatch{Port: 8443}, Name: "HTTPS Alt", Category: CategoryWeb, HTTP: true},
+		{Match: RuleMatch{Port: 8888}, Name: "Jupyter Notebook", Category: CategoryDevServer, HTTP: true},
+		{Match: RuleMatch{Port: 9000}, Name: "PHP-FPM / Portainer", Category: CategoryWeb, HTTP: true},
+		{Match: RuleMatch{Port: 9090}, Name: "Prometheus", Category: CategoryMonitoring, HTTP: true},
+		{Match: RuleMatch{Port: 9200}, Name: "Elasticsearch", Category: CategoryDatabase},
+		{Match: RuleMatch{Port: 9999}, Name: "Dev Machine Proxy", Category: CategoryTools},
+		{Match: RuleMatch{Port: 15672}, Name: "RabbitMQ Management", Category: CategoryQueue, HTTP: true},
+		{Match: RuleMatch{Port: 27017}, Name: "MongoDB", Category: CategoryDatabase},
+	},
+
+	// Conventional UDP ports
+	[]Rule{
+		{Match: RuleMatch{Port: 53, Protocol: "udp"}, Name: "DNS", Category: CategoryNetwork},
+		{Match: RuleMatch{Port: 67, Protocol: "udp"}, Name: "DHCP", Category: CategoryNetwork},
+		{Match: RuleMatch{Port: 69, Protocol: "udp"}, Name: "TFTP", Category: CategoryNetwork},
+		{Match: RuleMatch{Port: 123, Protocol: "udp"}, Name: "NTP", Category: CategoryNetwork},
+		{Match: RuleMatch{Port: 161, Protocol: "udp"}, Name: "SNMP", Category: CategoryNetwork},
+		{Match: RuleMatch{Port: 443, Protocol: "udp"}, Name: "QUIC / HTTP/3", Category: CategoryWeb},
+		{Match: RuleMatch{Port: 500, Protocol: "udp"}, Name: "IPsec IKE", Category: CategoryNetwork},
+		{Match: RuleMatch{Port: 514, Protocol: "udp"}, Name: "Syslog", Category: CategoryMonitoring},
+		{Match: RuleMatch{Port: 1194, Protocol: "udp"}, Name: "OpenVPN", Category: CategoryNetwork},
+		{Match: RuleMatch{Port: 1900, Protocol: "udp"}, Name: "SSDP", Category: CategoryNetwork},
+		{Match: RuleMatch{Port: 4433, Protocol: "udp"}, Name: "QUIC Dev Server", Category: CategoryDevServer},
+		{Match: RuleMatch{Port: 4500, Protocol: "udp"}, Name: "IPsec NAT-T", Category: CategoryNetwork},
+		{Match: RuleMatch{Port: 5353, Protocol: "udp"}, Name: "mDNS", Category: CategoryNetwork},
+		{Match: RuleMatch{Port: 8125, Protocol: "udp"}, Name: "StatsD", Category: CategoryMonitoring},
+		{Match: RuleMatch{Port: 8443, Protocol: "udp"}, Name: "QUIC / HTTP/3 Alt", Category: CategoryWeb},
+		{Match: RuleMatch{Port: 51820, Protocol: "udp"}, Name: "WireGuard", Category: CategoryNetwork},
+	},
+)
+
+// headerRules matches each hint against the Server header, then the
+// X-Powered-By header
+func headerRules(hints [][2]string) []Rule {
+	var rules []Rule
+	for _, header := range []string{"Server", "X-Powered-By"} {
+		for _, hint := range hints {
+			rules = append(rules, Rule{Match: RuleMatch{Header: header + ": " + hint[0]}, Name: hint[1], Category: CategoryWeb})
+		}
+	}
+	return rules
+}
+
+func concatRules(groups ...[]Rule) []Rule {
+	var rules []Rule
+	for _, g := range groups {
+		rules = append(rules, g...)
+	}
+	return rules
+}
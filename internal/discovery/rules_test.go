@@ -0,0 +1,53 @@
+package discovery
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRulePriorities(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fingerprint-rules.json")
+	err := os.WriteFile(path, []byte(`[
+		{"match": {"port": 7000}, "name": "Reports"},
+		{"match": {"process": "reporter"}, "name": "Reporter"}
+	]`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules := NewRuleSet(path)
+	if err := rules.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	e := &ruleEnricher{rules: rules}
+
+	tests := []struct {
+		name    string
+		lp      ListeningPort
+		want    string
+		wantTag bool // known-port
+	}{
+		{"user port rule beats the page title", ListeningPort{Port: 7000, Protocol: "tcp"}, "Reports", false},
+		{"user process rule beats the page title", ListeningPort{Port: 7100, Protocol: "tcp", Process: "reporter"}, "Reporter", false},
+		{"page title beats a built-in port rule", ListeningPort{Port: 5432, Protocol: "tcp"}, "Page title", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newCandidate(tt.lp)
+			c.Propose(Contribution{Field: FieldName, Value: "Page title", Priority: PriorityProbe, Confidence: 0.6, Reason: "HTML page title"})
+			c.Propose(Contribution{Field: FieldName, Value: "my-project", Priority: PriorityProject, Confidence: 0.9, Reason: "project"})
+			e.Enrich(&Run{}, c)
+
+			if got := c.resolve().Name; got != tt.want {
+				t.Errorf("name = %q, want %q", got, tt.want)
+			}
+			tagged := false
+			for _, tag := range c.Service.Tags {
+				tagged = tagged || tag == "known-port"
+			}
+			if tagged != tt.wantTag {
+				t.Errorf("known-port tag = %v, want %v", tagged, tt.wantTag)
+			}
+		})
+	}
+}
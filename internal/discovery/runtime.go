@@ -0,0 +1,160 @@
+package discovery
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Container runtime names, recorded on Service.Runtime
+const (
+	RuntimeDocker         = "docker"
+	RuntimeDockerRootless = "docker-rootless"
+	RuntimePodman         = "podman"
+)
+
+// Runtime is a Docker-API-compatible container engine endpoint
+type Runtime struct {
+	Name string // One of the Runtime* constants
+	Host string // Client host URI, e.g. unix:///run/user/1000/podman/podman.sock
+}
+
+// DetectRuntimes returns the container runtime sockets available on this
+// machine, in priority order: $DOCKER_HOST, the system Docker socket, the
+// rootful Podman socket, and the rootless Podman and Docker sockets under
+// $XDG_RUNTIME_DIR. The same socket reached by several paths is listed once.
+func DetectRuntimes() []Runtime {
+	var candidates []Runtime
+
+	if host := os.Getenv("DOCKER_HOST"); host != "" {
+		candidates = append(candidates, Runtime{Name: runtimeForHost(host), Host: host})
+	}
+	candidates = append(candidates,
+		Runtime{Name: RuntimeDocker, Host: "unix:///var/run/docker.sock"},
+		Runtime{Name: RuntimePodman, Host: "unix:///run/podman/podman.sock"},
+	)
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		candidates = append(candidates,
+			Runtime{Name: RuntimePodman, Host: "unix://" + filepath.Join(dir, "podman", "podman.sock")},
+			Runtime{Name: RuntimeDockerRootless, Host: "unix://" + filepath.Join(dir, "docker.sock")},
+		)
+	}
+
+	var runtimes []Runtime
+	seen := make(map[string]bool)
+	for _, rt := range candidates {
+		key := rt.Host
+		if path, ok := strings.CutPrefix(rt.Host, "unix://"); ok {
+			// Skip sockets that don't exist, and dedupe symlinks such as
+			// podman-docker's /var/run/docker.sock -> /run/podman/podman.sock
+			resolved, err := filepath.EvalSymlinks(path)
+			if err != nil {
+				continue
+			}
+			key = "unix://" + resolved
+			if strings.Contains(resolved, "podman") {
+				rt.Name = RuntimePodman
+			}
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		runtimes = append(runtimes, rt)
+	}
+
+	// Keep the default so the dashboard can report why Docker is unavailable
+	if len(runtimes) == 0 {
+		runtimes = append(runtimes, Runtime{Name: RuntimeDocker, Host: "unix:///var/run/docker.sock"})
+	}
+
+	return runtimes
+}
+
+// runtimeForHost guesses the runtime behind a $DOCKER_HOST value
+func runtimeForHost(host string) string {
+	switch {
+	case strings.Contains(host, "podman"):
+		return RuntimePodman
+	case strings.HasPrefix(host, "unix:///run/user/"):
+		return RuntimeDockerRootless
+	default:
+		return RuntimeDocker
+	}
+}
+
+// portForwarders are processes that listen on a host port on behalf of a
+// container, mapped to the runtime they belong to
+var portForwarders = map[string]string{
+	"docker-proxy":       RuntimeDocker,
+	"rootlesskit":        RuntimeDockerRootless,
+	"rootlessport":       RuntimePodman,
+	"rootlessport-child": RuntimePodman,
+	"slirp4netns":        RuntimePodman,
+	"pasta":              RuntimePodman,
+}
+
+// containerForwarderEnricher recognises ports held by a runtime's port
+// forwarder (docker-proxy, rootlessport, slirp4netns, ...) that no runtime
+// API claimed, e.g. because the rootless Podman socket isn't enabled
+type containerForwarderEnricher struct{}
+
+func (containerForwarderEnricher) Name() string { return "port-forwarder" }
+
+func (containerForwarderEnricher) Prepare(run *Run) error { return nil }
+
+func (containerForwarderEnricher) Enrich(run *Run, c *Candidate) {
+	runtime, ok := portForwarders[c.Port.Process]
+	if !ok {
+		return
+	}
+
+	c.AddTag("container")
+	if c.Service.Container != "" {
+		return // A runtime API already identified the container
+	}
+	c.Service.Runtime = runtime
+
+	reason := fmt.Sprintf("port held by %s, the %s port forwarder", c.Port.Process, runtime)
+	c.Propose(Contribution{
+		Field:      FieldName,
+		Value:      fmt.Sprintf("%s container", runtimeDisplayName(runtime)),
+		Priority:   PriorityProcName + 5,
+		Confidence: 0.5,
+		Reason:     reason,
+	})
+
+	// docker-proxy says where it forwards to: -container-ip 172.17.0.2 -container-port 80
+	if target := forwarderTarget(c.Port.Cmdline); target != "" {
+		c.Propose(Contribution{Field: FieldDescription, Value: "Forwards to " + target, Priority: PriorityProbeHint, Confidence: 0.8, Reason: reason})
+	}
+}
+
+// forwarderTarget extracts the container address from a docker-proxy command line
+func forwarderTarget(cmdline []string) string {
+	var ip, port string
+	for i := 0; i+1 < len(cmdline); i++ {
+		switch cmdline[i] {
+		case "-container-ip":
+			ip = cmdline[i+1]
+		case "-container-port":
+			port = cmdline[i+1]
+		}
+	}
+	if ip == "" || port == "" {
+		return ""
+	}
+	return ip + ":" + port
+}
+
+func runtimeDisplayName(runtime string) string {
+	switch runtime {
+	case RuntimePodman:
+		return "Podman"
+	case RuntimeDockerRootless:
+		return "Rootless Docker"
+	default:
+		return "Docker"
+	}
+}
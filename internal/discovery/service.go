@@ -2,53 +2,42 @@ package discovery
 
 // Service represents a discovered service running on a port
 type Service struct {
-	Port        int      `json:"port"`
-	Protocol    string   `json:"protocol"`    // tcp, udp
-	Name        string   `json:"name"`        // Best guess at service name
-	Description string   `json:"description"` // Additional context
-	URL         string   `json:"url"`         // Clickable URL if HTTP-based
-	Source      string   `json:"source"`      // How we discovered it: docker, process, port-scan
-	Process     string   `json:"process"`     // Process name if available
-	Container   string   `json:"container"`   // Docker container name if applicable
-	Image       string   `json:"image"`       // Docker image if applicable
-	ProjectPath string   `json:"projectPath"` // Path to project folder if found
-	Tags        []string `json:"tags"`        // Additional tags for categorization
-	IsHTTP      bool     `json:"isHttp"`      // Whether this appears to be an HTTP service
-}
-
-// KnownPorts maps common ports to their typical services
-var KnownPorts = map[int]string{
-	22:    "SSH",
-	80:    "HTTP",
-	443:   "HTTPS",
-	1433:  "MSSQL",
-	1521:  "Oracle DB",
-	2375:  "Docker (unencrypted)",
-	2376:  "Docker (TLS)",
-	3000:  "Dev Server (Node/Rails/etc)",
-	3306:  "MySQL",
-	4200:  "Angular Dev Server",
-	5000:  "Flask/ASP.NET Dev Server",
-	5173:  "Vite Dev Server",
-	5432:  "PostgreSQL",
-	5672:  "RabbitMQ",
-	6379:  "Redis",
-	8000:  "Python Dev Server",
-	8080:  "HTTP Alt / Tomcat",
-	8081:  "HTTP Alt",
-	8443:  "HTTPS Alt",
-	8888:  "Jupyter Notebook",
-	9000:  "PHP-FPM / Portainer",
-	9090:  "Prometheus",
-	9200:  "Elasticsearch",
-	9999:  "Dev Machine Proxy",
-	15672: "RabbitMQ Management",
-	27017: "MongoDB",
-}
+	ID             string             `json:"id"` // Stable, URL-safe identity, e.g. tcp-5432 (see ServiceID)
+	Port           int                `json:"port"`
+	Protocol       string             `json:"protocol"`                 // tcp, udp
+	Name           string             `json:"name"`                     // Best guess at service name
+	Description    string             `json:"description"`              // Additional context
+	URL            string             `json:"url"`                      // Clickable URL if HTTP-based
+	ProxyURL       string             `json:"proxyUrl"`                 // Same service through the dashboard's proxy
+	Source         string             `json:"source"`                   // How we discovered it: docker, podman, port-scan
+	Process        string             `json:"process"`                  // Process name if available
+	PID            int                `json:"pid"`                      // Owning process ID, 0 if unknown
+	Command        string             `json:"command"`                  // Full command line of the owning process
+	User           string             `json:"user"`                     // Owner of the listening socket
+	BindAddresses  []string           `json:"bindAddresses"`            // Local addresses the port is bound to
+	Exposure       string             `json:"exposure"`                 // loopback, all, interface (see ClassifyBind)
+	Reachable      bool               `json:"reachable"`                // Whether the port is reachable via the address the request arrived on (set by web)
+	Container      string             `json:"container"`                // Docker container name if applicable
+	Runtime        string             `json:"runtime"`                  // Container runtime: docker, docker-rootless, podman
+	RuntimeHost    string             `json:"runtimeHost,omitempty"`    // Endpoint of that runtime, see Stack.Host
+	ContainerState string             `json:"containerState,omitempty"` // running, paused, ...
+	ContainerPort  int                `json:"containerPort,omitempty"`  // Port inside the container
+	Networks       []ContainerNetwork `json:"networks,omitempty"`       // Container networks and addresses
+	ComposeProject string             `json:"composeProject,omitempty"` // com.docker.compose.project label
+	ComposeService string             `json:"composeService,omitempty"` // com.docker.compose.service label
+	Image          string             `json:"image"`                    // Docker image if applicable
+	ProjectPath    string             `json:"projectPath"`              // Path to project folder if found
+	ProjectSource  string             `json:"projectSource"`            // How ProjectPath was determined (see ProjectSource* constants)
+	Tags           []string           `json:"tags"`                     // Additional tags for categorization
+	IsHTTP         bool               `json:"isHttp"`                   // Whether this appears to be an HTTP service
+	Icon           string             `json:"icon,omitempty"`           // Emoji or image URL from a fingerprint rule
+	Category       string             `json:"category,omitempty"`       // Grouping from a fingerprint rule, e.g. database
+	Hidden         bool               `json:"hidden,omitempty"`         // Hidden by an override
+	Pinned         bool               `json:"pinned,omitempty"`         // Pinned to the top by an override
+	Override       string             `json:"override,omitempty"`       // ID of the most specific override applied
+	AppProtocol    string             `json:"appProtocol,omitempty"`    // Protocol found by fingerprinting: ssh, postgres, redis, ... (see Proto* constants)
+	Version        string             `json:"version,omitempty"`        // Server version reported during the handshake
+	Unit           *SystemdUnit       `json:"unit,omitempty"`           // systemd unit, slice and container scope of the owning process
 
-// HTTPPorts are ports that are typically HTTP services worth probing
-var HTTPPorts = map[int]bool{
-	80: true, 443: true, 3000: true, 4200: true, 5000: true,
-	5173: true, 8000: true, 8080: true, 8081: true, 8443: true,
-	8888: true, 9000: true, 9090: true, 15672: true,
+	Provenance map[Field]Provenance `json:"provenance"` // Which enricher set name/url/project/description, and why
 }
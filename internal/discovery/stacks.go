@@ -0,0 +1,185 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+)
+
+// Aggregated stack states
+const (
+	StackUp       = "up"       // Every container running and healthy
+	StackDegraded = "degraded" // All running, but some unhealthy, restarting or paused
+	StackPartial  = "partial"  // Some containers stopped
+	StackStopped  = "stopped"  // No container running
+)
+
+// Stack is a Docker Compose project: its containers, their aggregated state
+// and the services they provide
+type Stack struct {
+	Name        string           `json:"name"`
+	Runtime     string           `json:"runtime"`
+	Host        string           `json:"host"` // Runtime endpoint; tells rootful and rootless runtimes apart
+	WorkingDir  string           `json:"workingDir,omitempty"`
+	ConfigFiles []string         `json:"configFiles,omitempty"` // Compose files the project was started from
+	State       string           `json:"state"`                 // up, degraded, partial, stopped
+	Running     int              `json:"running"`
+	Total       int              `json:"total"`
+	Containers  []StackContainer `json:"containers"`
+	Services    []Service        `json:"services"`
+}
+
+// StackContainer is one container of a stack, running or not
+type StackContainer struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Service string `json:"service"` // Compose service name
+	Image   string `json:"image"`
+	State   string `json:"state"`  // running, exited, restarting, paused, ...
+	Status  string `json:"status"` // e.g. "Up 5 minutes (healthy)", "Exited (1) 2 hours ago"
+	Healthy bool   `json:"healthy"`
+
+	fullID string
+}
+
+// Stacks lists the Compose projects of every connected runtime, including
+// their stopped containers, which the trackers don't follow
+func (d *Discoverer) Stacks(ctx context.Context) ([]Stack, error) {
+	services := d.GetServices()
+
+	stacks := make([]Stack, 0)
+	var errs []error
+	for _, t := range d.docker {
+		if _, err := t.Containers(); err != nil {
+			continue // Runtime not available
+		}
+		found, err := t.stacks(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", t.runtime.Name, err))
+			continue
+		}
+		stacks = append(stacks, found...)
+	}
+
+	for i := range stacks {
+		for _, svc := range services {
+			if svc.ComposeProject == stacks[i].Name && svc.RuntimeHost == stacks[i].Host {
+				stacks[i].Services = append(stacks[i].Services, svc)
+			}
+		}
+	}
+
+	sort.Slice(stacks, func(i, j int) bool {
+		if stacks[i].Name != stacks[j].Name {
+			return stacks[i].Name < stacks[j].Name
+		}
+		return stacks[i].Host < stacks[j].Host
+	})
+
+	if len(errs) > 0 {
+		return stacks, fmt.Errorf("listing stacks: %v", errs)
+	}
+	return stacks, nil
+}
+
+// stacks queries the runtime for all Compose-managed containers
+func (t *DockerTracker) stacks(ctx context.Context) ([]Stack, error) {
+	cli, err := t.newClient()
+	if err != nil {
+		return nil, err
+	}
+	defer cli.Close()
+
+	containers, err := cli.ContainerList(ctx, container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", labelComposeProject)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing containers: %w", err)
+	}
+
+	byName := make(map[string]*Stack)
+	var order []string
+	for _, c := range containers {
+		// Skip one-off `compose run` containers
+		if c.Labels["com.docker.compose.oneoff"] == "True" {
+			continue
+		}
+
+		name := c.Labels[labelComposeProject]
+		stack, ok := byName[name]
+		if !ok {
+			stack = &Stack{
+				Name:        name,
+				Runtime:     t.runtime.Name,
+				Host:        t.runtime.Host,
+				WorkingDir:  c.Labels[labelComposeWorkingDir],
+				ConfigFiles: splitConfigFiles(c.Labels[labelComposeConfigFiles]),
+			}
+			byName[name] = stack
+			order = append(order, name)
+		}
+
+		stack.Containers = append(stack.Containers, StackContainer{
+			ID:      c.ID[:12],
+			Name:    strings.TrimPrefix(c.Names[0], "/"),
+			Service: c.Labels[labelComposeService],
+			Image:   c.Image,
+			State:   c.State,
+			Status:  c.Status,
+			Healthy: c.State == "running" && !strings.Contains(c.Status, "(unhealthy)"),
+			fullID:  c.ID,
+		})
+	}
+
+	stacks := make([]Stack, 0, len(order))
+	for _, name := range order {
+		stack := byName[name]
+		sort.Slice(stack.Containers, func(i, j int) bool { return stack.Containers[i].Service < stack.Containers[j].Service })
+		stack.aggregate()
+		stacks = append(stacks, *stack)
+	}
+	return stacks, nil
+}
+
+// splitConfigFiles splits the comma-separated config_files label
+func splitConfigFiles(label string) []string {
+	var files []string
+	for _, file := range strings.Split(label, ",") {
+		if file = strings.TrimSpace(file); file != "" {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// aggregate derives the stack state from its containers
+func (s *Stack) aggregate() {
+	s.Total = len(s.Containers)
+	s.Running = 0
+	healthy := 0
+	for _, c := range s.Containers {
+		switch c.State {
+		case "running", "restarting", "paused":
+			s.Running++
+		}
+		if c.Healthy {
+			healthy++
+		}
+	}
+
+	switch {
+	case s.Running == 0:
+		s.State = StackStopped
+	case s.Running < s.Total:
+		s.State = StackPartial
+	case healthy < s.Total:
+		s.State = StackDegraded
+	default:
+		s.State = StackUp
+	}
+}
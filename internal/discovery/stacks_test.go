@@ -0,0 +1,36 @@
+package discovery
+
+import "testing"
+
+func TestStackAggregate(t *testing.T) {
+	running := StackContainer{State: "running", Healthy: true}
+	unhealthy := StackContainer{State: "running", Status: "Up 5 minutes (unhealthy)"}
+	restarting := StackContainer{State: "restarting"}
+	paused := StackContainer{State: "paused"}
+	exited := StackContainer{State: "exited", Status: "Exited (1) 2 hours ago"}
+	created := StackContainer{State: "created"}
+
+	tests := []struct {
+		name           string
+		containers     []StackContainer
+		state          string
+		running, total int
+	}{
+		{"all running", []StackContainer{running, running}, StackUp, 2, 2},
+		{"one unhealthy", []StackContainer{running, unhealthy}, StackDegraded, 2, 2},
+		{"one restarting", []StackContainer{running, restarting}, StackDegraded, 2, 2},
+		{"one paused", []StackContainer{paused, running}, StackDegraded, 2, 2},
+		{"one exited", []StackContainer{running, exited}, StackPartial, 1, 2},
+		{"exited and unhealthy", []StackContainer{unhealthy, exited}, StackPartial, 1, 2},
+		{"none running", []StackContainer{exited, created}, StackStopped, 0, 2},
+		{"no containers", nil, StackStopped, 0, 0},
+	}
+
+	for _, tt := range tests {
+		s := Stack{Containers: tt.containers, Running: 99}
+		s.aggregate()
+		if s.State != tt.state || s.Running != tt.running || s.Total != tt.total {
+			t.Errorf("%s: aggregate() = %s %d/%d, want %s %d/%d", tt.name, s.State, s.Running, s.Total, tt.state, tt.running, tt.total)
+		}
+	}
+}
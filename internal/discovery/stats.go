@@ -0,0 +1,102 @@
+package discovery
+
+import (
+	"sync"
+	"time"
+)
+
+// RunStats counts discovery runs and their errors, for monitoring
+type RunStats struct {
+	Runs         uint64            // Completed Discover runs
+	Duration     time.Duration     // Total time spent in them
+	LastDuration time.Duration     // Time the latest one took
+	LastRun      time.Time         // When the latest one finished
+	LastError    string            // Error of the latest one, if any
+	Steps        []StepTiming      // Steps of the latest one, in order
+	Running      bool              // Whether a run is in progress
+	Started      time.Time         // When the run in progress started
+	Errors       map[string]uint64 // By the source or enricher that failed, or "deadline"
+}
+
+// StepTiming is how long one step of a Discover run took
+type StepTiming struct {
+	Step     string // e.g. ports, prepare:docker, build
+	Duration time.Duration
+}
+
+// runStats accumulates RunStats
+type runStats struct {
+	mu    sync.Mutex
+	stats RunStats
+}
+
+func newRunStats() *runStats {
+	return &runStats{stats: RunStats{Errors: make(map[string]uint64)}}
+}
+
+// started records that a Discover run began
+func (s *runStats) started(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.Running = true
+	s.stats.Started = now
+}
+
+// finished records a Discover run that took d, its steps and its error
+func (s *runStats) finished(d time.Duration, steps []StepTiming, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.Runs++
+	s.stats.Duration += d
+	s.stats.LastDuration = d
+	s.stats.LastRun = time.Now()
+	s.stats.Steps = steps
+	s.stats.LastError = ""
+	if err != nil {
+		s.stats.LastError = err.Error()
+	}
+	s.stats.Running = false
+	s.stats.Started = time.Time{}
+}
+
+// failed counts an error from a step of a run
+func (s *runStats) failed(step string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.Errors[step]++
+}
+
+func (s *runStats) get() RunStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := s.stats
+	stats.Steps = append([]StepTiming(nil), s.stats.Steps...)
+	stats.Errors = make(map[string]uint64, len(s.stats.Errors))
+	for step, n := range s.stats.Errors {
+		stats.Errors[step] = n
+	}
+	return stats
+}
+
+// stepTimer times the steps of one run
+type stepTimer struct {
+	steps []StepTiming
+	last  time.Time
+}
+
+func newStepTimer(start time.Time) *stepTimer {
+	return &stepTimer{last: start}
+}
+
+// done ends a step that ran since the previous one ended
+func (t *stepTimer) done(step string) {
+	now := time.Now()
+	t.steps = append(t.steps, StepTiming{Step: step, Duration: now.Sub(t.last)})
+	t.last = now
+}
+
+// Stats returns how many discovery runs there were, how long they took and
+// which steps failed, and whether one is running now
+func (d *Discoverer) Stats() RunStats {
+	return d.stats.get()
+}
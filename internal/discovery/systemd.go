@@ -0,0 +1,185 @@
+package discovery
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SystemdUnit is the systemd unit a process runs in, read from its cgroup
+type SystemdUnit struct {
+	Name        string `json:"name"`                  // e.g. api.service, session-2.scope
+	Slice       string `json:"slice,omitempty"`       // Innermost slice, e.g. app.slice
+	UserManager bool   `json:"userManager,omitempty"` // Whether the unit belongs to a user's manager (systemctl --user)
+	UID         int    `json:"uid,omitempty"`         // Owner of that user manager
+	Description string `json:"description,omitempty"` // Description= of the unit
+	Container   string `json:"container,omitempty"`   // Container ID when the scope is a container's
+	Pod         string `json:"pod,omitempty"`         // Pod ID when the slice is a Podman or Kubernetes pod's
+	Cgroup      string `json:"cgroup"`                // Full cgroup path
+}
+
+// descriptionTimeout bounds each systemctl call
+const descriptionTimeout = 2 * time.Second
+
+var (
+	userManagerRe = regexp.MustCompile(`^user@(\d+)\.service$`)
+	// docker-<id>.scope, libpod-<id>.scope, cri-containerd-<id>.scope, crio-<id>.scope
+	containerScopeRe = regexp.MustCompile(`^(?:docker|libpod|cri-containerd|crio)-([0-9a-f]{12,64})\.scope$`)
+	// libpod-pod-<id>.slice, kubepods-besteffort-pod<uid>.slice
+	podSliceRe = regexp.MustCompile(`^(?:libpod-pod-|kubepods(?:-[a-z]+)?-pod)([0-9a-f_-]+)\.slice$`)
+	// The cgroupfs driver: /docker/<id>, /kubepods/burstable/pod<uid>/<id>
+	containerDirRe = regexp.MustCompile(`^[0-9a-f]{64}$`)
+	podDirRe       = regexp.MustCompile(`^pod([0-9a-f-]{36})$`)
+)
+
+// readCgroup returns the systemd cgroup path of a process: the unified (v2)
+// hierarchy, or the name=systemd hierarchy on v1 and hybrid setups
+func readCgroup(dir string) string {
+	data, err := os.ReadFile(filepath.Join(dir, "cgroup"))
+	if err != nil {
+		return ""
+	}
+
+	var unified, named string
+	for _, line := range strings.Split(string(data), "\n") {
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		switch {
+		case parts[0] == "0" && parts[1] == "":
+			unified = parts[2]
+		case parts[1] == "name=systemd":
+			named = parts[2]
+		}
+	}
+	if unified != "" && unified != "/" {
+		return unified
+	}
+	return named
+}
+
+// ParseCgroup reads the systemd unit, slice and any container or pod scope
+// out of a cgroup path such as
+// /user.slice/user-1000.slice/user@1000.service/app.slice/api.service.
+// It returns false for paths outside any unit.
+func ParseCgroup(path string) (SystemdUnit, bool) {
+	unit := SystemdUnit{Cgroup: path}
+	underManager := false
+	for _, seg := range strings.Split(strings.Trim(path, "/"), "/") {
+		switch {
+		case userManagerRe.MatchString(seg):
+			unit.UID, _ = strconv.Atoi(userManagerRe.FindStringSubmatch(seg)[1])
+			unit.Name = seg // The manager itself, until one of its units is found
+			underManager = true
+		case strings.HasSuffix(seg, ".slice"):
+			unit.Slice = seg
+			if m := podSliceRe.FindStringSubmatch(seg); m != nil {
+				unit.Pod = strings.ReplaceAll(m[1], "_", "-")
+			}
+		case strings.HasSuffix(seg, ".service") || strings.HasSuffix(seg, ".scope"):
+			unit.Name, unit.UserManager = seg, underManager
+			if m := containerScopeRe.FindStringSubmatch(seg); m != nil {
+				unit.Container = m[1]
+			}
+		case podDirRe.MatchString(seg):
+			unit.Pod = podDirRe.FindStringSubmatch(seg)[1]
+		case containerDirRe.MatchString(seg):
+			unit.Container = seg
+		}
+	}
+	if unit.Name == "" && unit.Container == "" {
+		return SystemdUnit{}, false
+	}
+	return unit, true
+}
+
+// namesService reports whether the unit's description is worth showing as
+// the service name: a service (not a login session or container scope) other
+// than a user manager, described by more than its command line, which is what
+// systemd-run sets when given no description
+func (u SystemdUnit) namesService() bool {
+	return strings.HasSuffix(u.Name, ".service") && !userManagerRe.MatchString(u.Name) &&
+		u.Container == "" && u.Description != "" && u.Description != u.Name &&
+		!strings.HasPrefix(u.Description, "/")
+}
+
+// unitDescriptions caches unit descriptions from systemctl. Descriptions
+// only change on a daemon-reload, so they are kept as long as the unit has
+// listening ports.
+type unitDescriptions struct {
+	mu      sync.Mutex
+	entries map[string]string // Manager and unit name -> Description
+}
+
+func newUnitDescriptions() *unitDescriptions {
+	return &unitDescriptions{entries: make(map[string]string)}
+}
+
+func descriptionKey(u SystemdUnit) string {
+	if u.UserManager {
+		return strconv.Itoa(u.UID) + "/" + u.Name
+	}
+	return "system/" + u.Name
+}
+
+// get returns the Description of a unit, asking systemctl the first time.
+// Units of another user's manager can only be asked about as root.
+func (d *unitDescriptions) get(u SystemdUnit) string {
+	key := descriptionKey(u)
+	d.mu.Lock()
+	desc, ok := d.entries[key]
+	d.mu.Unlock()
+	if ok {
+		return desc
+	}
+
+	args := []string{"show", "--property=Description", "--value"}
+	if u.UserManager {
+		switch {
+		case u.UID == os.Getuid():
+			args = append(args, "--user")
+		case os.Geteuid() == 0:
+			args = append(args, "--user", "--machine="+procIndex.Username(u.UID)+"@.host")
+		default:
+			args = nil
+		}
+	}
+	if args != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), descriptionTimeout)
+		out, err := exec.CommandContext(ctx, "systemctl", append(args, "--", u.Name)...).Output()
+		cancel()
+		if err == nil {
+			desc = strings.TrimSpace(string(out))
+		}
+	}
+
+	d.mu.Lock()
+	d.entries[key] = desc
+	d.mu.Unlock()
+	return desc
+}
+
+// prune forgets the units none of the current ports run in
+func (d *unitDescriptions) prune(ports []ListeningPort) {
+	live := make(map[string]bool)
+	for _, lp := range ports {
+		if u, ok := ParseCgroup(lp.Cgroup); ok {
+			live[descriptionKey(u)] = true
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for key := range d.entries {
+		if !live[key] {
+			delete(d.entries, key)
+		}
+	}
+}
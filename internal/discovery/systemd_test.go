@@ -0,0 +1,124 @@
+package discovery
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseCgroupFile(t *testing.T) {
+	const (
+		dockerID = "4f1c5a1e0b2d3c4e5f60718293a4b5c6d7e8f90112233445566778899aabbccd"
+		podUID   = "0a1b2c3d-4e5f-6071-8293-a4b5c6d7e8f9"
+	)
+
+	tests := []struct {
+		name   string
+		cgroup string // Contents of /proc/<pid>/cgroup
+		want   SystemdUnit
+		ok     bool
+	}{
+		{
+			name:   "v2 system service",
+			cgroup: "0::/system.slice/postgresql.service\n",
+			want:   SystemdUnit{Name: "postgresql.service", Slice: "system.slice", Cgroup: "/system.slice/postgresql.service"},
+			ok:     true,
+		},
+		{
+			name:   "v2 user manager service",
+			cgroup: "0::/user.slice/user-1000.slice/user@1000.service/app.slice/api.service\n",
+			want: SystemdUnit{Name: "api.service", Slice: "app.slice", UserManager: true, UID: 1000,
+				Cgroup: "/user.slice/user-1000.slice/user@1000.service/app.slice/api.service"},
+			ok: true,
+		},
+		{
+			name:   "v2 user manager itself",
+			cgroup: "0::/user.slice/user-1000.slice/user@1000.service/init.scope\n",
+			want: SystemdUnit{Name: "init.scope", Slice: "user-1000.slice", UserManager: true, UID: 1000,
+				Cgroup: "/user.slice/user-1000.slice/user@1000.service/init.scope"},
+			ok: true,
+		},
+		{
+			name:   "v2 login session",
+			cgroup: "0::/user.slice/user-1000.slice/session-2.scope\n",
+			want:   SystemdUnit{Name: "session-2.scope", Slice: "user-1000.slice", Cgroup: "/user.slice/user-1000.slice/session-2.scope"},
+			ok:     true,
+		},
+		{
+			name:   "v2 docker scope",
+			cgroup: "0::/system.slice/docker-" + dockerID + ".scope\n",
+			want: SystemdUnit{Name: "docker-" + dockerID + ".scope", Slice: "system.slice", Container: dockerID,
+				Cgroup: "/system.slice/docker-" + dockerID + ".scope"},
+			ok: true,
+		},
+		{
+			name:   "v2 rootless libpod in a pod",
+			cgroup: "0::/user.slice/user-1000.slice/user@1000.service/user.slice/libpod-pod-abc123.slice/libpod-" + dockerID + ".scope/container\n",
+			want: SystemdUnit{Name: "libpod-" + dockerID + ".scope", Slice: "libpod-pod-abc123.slice", UserManager: true, UID: 1000,
+				Container: dockerID, Pod: "abc123",
+				Cgroup: "/user.slice/user-1000.slice/user@1000.service/user.slice/libpod-pod-abc123.slice/libpod-" + dockerID + ".scope/container"},
+			ok: true,
+		},
+		{
+			name:   "v2 kubepods with the systemd driver",
+			cgroup: "0::/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod0a1b2c3d_4e5f_6071_8293_a4b5c6d7e8f9.slice/cri-containerd-" + dockerID + ".scope\n",
+			want: SystemdUnit{Name: "cri-containerd-" + dockerID + ".scope", Slice: "kubepods-besteffort-pod0a1b2c3d_4e5f_6071_8293_a4b5c6d7e8f9.slice",
+				Container: dockerID, Pod: podUID,
+				Cgroup: "/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod0a1b2c3d_4e5f_6071_8293_a4b5c6d7e8f9.slice/cri-containerd-" + dockerID + ".scope"},
+			ok: true,
+		},
+		{
+			name:   "v1 kubepods with the cgroupfs driver",
+			cgroup: "12:pids:/kubepods/burstable/pod" + podUID + "/" + dockerID + "\n1:name=systemd:/kubepods/burstable/pod" + podUID + "/" + dockerID + "\n",
+			want:   SystemdUnit{Container: dockerID, Pod: podUID, Cgroup: "/kubepods/burstable/pod" + podUID + "/" + dockerID},
+			ok:     true,
+		},
+		{
+			name:   "v1 docker with the cgroupfs driver",
+			cgroup: "11:memory:/docker/" + dockerID + "\n1:name=systemd:/docker/" + dockerID + "\n",
+			want:   SystemdUnit{Container: dockerID, Cgroup: "/docker/" + dockerID},
+			ok:     true,
+		},
+		{
+			name:   "v1 system service",
+			cgroup: "12:cpu,cpuacct:/system.slice/nginx.service\n1:name=systemd:/system.slice/nginx.service\n",
+			want:   SystemdUnit{Name: "nginx.service", Slice: "system.slice", Cgroup: "/system.slice/nginx.service"},
+			ok:     true,
+		},
+		{
+			name:   "hybrid prefers the unified hierarchy",
+			cgroup: "1:name=systemd:/system.slice/old.service\n0::/system.slice/redis.service\n",
+			want:   SystemdUnit{Name: "redis.service", Slice: "system.slice", Cgroup: "/system.slice/redis.service"},
+			ok:     true,
+		},
+		{
+			name:   "hybrid with an empty unified hierarchy",
+			cgroup: "1:name=systemd:/system.slice/redis.service\n0::/\n",
+			want:   SystemdUnit{Name: "redis.service", Slice: "system.slice", Cgroup: "/system.slice/redis.service"},
+			ok:     true,
+		},
+		{name: "root cgroup", cgroup: "0::/\n", ok: false},
+		{name: "slice only", cgroup: "0::/user.slice\n", ok: false},
+		{name: "no systemd hierarchy", cgroup: "12:pids:/\n11:memory:/\n", ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, "cgroup"), []byte(tt.cgroup), 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, ok := ParseCgroup(readCgroup(dir))
+			if ok != tt.ok || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseCgroup(readCgroup()) = %+v, %v, want %+v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestReadCgroupMissing(t *testing.T) {
+	if got := readCgroup(t.TempDir()); got != "" {
+		t.Errorf("readCgroup() without a cgroup file = %q, want empty", got)
+	}
+}
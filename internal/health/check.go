@@ -0,0 +1,234 @@
+package health
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"dev-machine-proxy/internal/discovery"
+)
+
+// Check types
+const (
+	TypeHTTP    = "http"
+	TypeTCP     = "tcp"
+	TypeCommand = "command"
+)
+
+// Defaults for checks that don't set an interval or timeout
+const (
+	DefaultInterval = 30 // seconds
+	DefaultTimeout  = 5  // seconds
+)
+
+// Check is a health check for one service
+type Check struct {
+	ID           string `json:"id"`
+	Service      string `json:"service"`                // Service ID, e.g. tcp-8080
+	Type         string `json:"type"`                   // http, tcp or command
+	Path         string `json:"path,omitempty"`         // http: path on the service URL, default /
+	ExpectStatus int    `json:"expectStatus,omitempty"` // http: required status code; any status below 400 when 0
+	ExpectBody   string `json:"expectBody,omitempty"`   // http: text the response body must contain
+	Command      string `json:"command,omitempty"`      // command: run with sh -c; exit code 0 means up
+	Interval     int    `json:"interval"`               // in seconds
+	Timeout      int    `json:"timeout"`                // in seconds
+}
+
+// ErrUnknownCheck is returned when updating or deleting a missing check
+var ErrUnknownCheck = errors.New("unknown health check")
+
+// ErrInvalidCheck is returned for checks with a missing service, an unknown
+// type or settings that don't fit the type
+var ErrInvalidCheck = errors.New("invalid health check")
+
+// normalize fills in the default interval and timeout and validates the rest
+func (c *Check) normalize() error {
+	if c.Interval == 0 {
+		c.Interval = DefaultInterval
+	}
+	if c.Timeout == 0 {
+		c.Timeout = min(DefaultTimeout, c.Interval)
+	}
+
+	switch {
+	case c.Service == "":
+		return fmt.Errorf("%w: service is required", ErrInvalidCheck)
+	case c.Interval < 1 || c.Timeout < 1:
+		return fmt.Errorf("%w: interval and timeout must be at least one second", ErrInvalidCheck)
+	case c.Timeout > c.Interval:
+		return fmt.Errorf("%w: timeout must not exceed the interval", ErrInvalidCheck)
+	}
+
+	switch c.Type {
+	case TypeHTTP:
+		if c.ExpectStatus != 0 && (c.ExpectStatus < 100 || c.ExpectStatus > 599) {
+			return fmt.Errorf("%w: expectStatus %d is not an HTTP status", ErrInvalidCheck, c.ExpectStatus)
+		}
+	case TypeTCP:
+	case TypeCommand:
+		if strings.TrimSpace(c.Command) == "" {
+			return fmt.Errorf("%w: command is required", ErrInvalidCheck)
+		}
+	default:
+		return fmt.Errorf("%w: type must be http, tcp or command, not %q", ErrInvalidCheck, c.Type)
+	}
+	return nil
+}
+
+// Result is the outcome of running a check once
+type Result struct {
+	Up      bool
+	Latency time.Duration
+	Error   string // Why the check failed
+}
+
+// checkClient doesn't follow redirects, so a login redirect counts as the
+// status it is, and accepts the self-signed certificates of local services
+var checkClient = &http.Client{
+	Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+		DisableKeepAlives: true,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// maxBodyMatch bounds how much of a response body is searched for ExpectBody
+const maxBodyMatch = 256 * 1024
+
+// run performs the check against svc, which is nil when the service isn't
+// currently discovered
+func (c *Check) run(ctx context.Context, svc *discovery.Service) Result {
+	if svc == nil {
+		return Result{Error: "service is not running"}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(c.Timeout)*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	var err error
+	switch c.Type {
+	case TypeHTTP:
+		err = c.runHTTP(ctx, svc)
+	case TypeTCP:
+		err = runTCP(ctx, svc)
+	case TypeCommand:
+		err = c.runCommand(ctx, svc)
+	}
+	result := Result{Up: err == nil, Latency: time.Since(start)}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// serviceHost is where a service is reached from the host: an address it is
+// bound to, which is the container's address for internal ports
+func serviceHost(svc *discovery.Service) string {
+	return discovery.DialHost(svc.BindAddresses)
+}
+
+// serviceURL is the URL an HTTP check starts from
+func serviceURL(svc *discovery.Service) string {
+	if svc.URL != "" {
+		return svc.URL
+	}
+	return "http://" + net.JoinHostPort(serviceHost(svc), strconv.Itoa(svc.Port))
+}
+
+func (c *Check) runHTTP(ctx context.Context, svc *discovery.Service) error {
+	u, err := url.Parse(serviceURL(svc))
+	if err != nil {
+		return err
+	}
+	if c.Path != "" {
+		ref, err := url.Parse("/" + strings.TrimPrefix(c.Path, "/"))
+		if err != nil {
+			return err
+		}
+		u.Path, u.RawPath, u.RawQuery = ref.Path, ref.RawPath, ref.RawQuery
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := checkClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if c.ExpectStatus != 0 && resp.StatusCode != c.ExpectStatus {
+		return fmt.Errorf("status %d, expected %d", resp.StatusCode, c.ExpectStatus)
+	}
+	if c.ExpectStatus == 0 && resp.StatusCode >= 400 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	if c.ExpectBody != "" {
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodyMatch))
+		if err != nil {
+			return fmt.Errorf("reading body: %w", err)
+		}
+		if !strings.Contains(string(body), c.ExpectBody) {
+			return fmt.Errorf("body does not contain %q", c.ExpectBody)
+		}
+	}
+	return nil
+}
+
+func runTCP(ctx context.Context, svc *discovery.Service) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(serviceHost(svc), strconv.Itoa(svc.Port)))
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// runCommand runs the command through the shell with the service's address
+// in SERVICE_HOST, SERVICE_PORT and SERVICE_URL
+func (c *Check) runCommand(ctx context.Context, svc *discovery.Service) error {
+	cmd := exec.CommandContext(ctx, "sh", "-c", c.Command)
+	cmd.Env = append(os.Environ(),
+		"SERVICE_HOST="+serviceHost(svc),
+		"SERVICE_PORT="+strconv.Itoa(svc.Port),
+		"SERVICE_URL="+serviceURL(svc),
+	)
+	cmd.WaitDelay = time.Second // Don't wait on children that keep the output open
+
+	output, err := cmd.CombinedOutput()
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("timed out after %ds", c.Timeout)
+	}
+	if last := lastLine(output); last != "" {
+		return fmt.Errorf("%v: %s", err, last)
+	}
+	return err
+}
+
+// lastLine returns the last non-empty line of a command's output, shortened
+// to fit in an error message
+func lastLine(output []byte) string {
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	last := strings.TrimSpace(lines[len(lines)-1])
+	if len(last) > 200 {
+		last = last[:200] + "…"
+	}
+	return last
+}
@@ -0,0 +1,47 @@
+package health
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckNormalize(t *testing.T) {
+	tests := []struct {
+		name              string
+		check             Check
+		ok                bool
+		interval, timeout int
+	}{
+		{"defaults", Check{Service: "tcp-8080", Type: TypeTCP}, true, DefaultInterval, DefaultTimeout},
+		{"timeout capped by a short interval", Check{Service: "tcp-8080", Type: TypeTCP, Interval: 2}, true, 2, 2},
+		{"http with a status", Check{Service: "tcp-8080", Type: TypeHTTP, ExpectStatus: 204}, true, DefaultInterval, DefaultTimeout},
+		{"command", Check{Service: "tcp-6379", Type: TypeCommand, Command: "redis-cli ping"}, true, DefaultInterval, DefaultTimeout},
+		{"no service", Check{Type: TypeTCP}, false, 0, 0},
+		{"negative interval", Check{Service: "tcp-8080", Type: TypeTCP, Interval: -5}, false, 0, 0},
+		{"negative timeout", Check{Service: "tcp-8080", Type: TypeTCP, Timeout: -1}, false, 0, 0},
+		{"timeout over the interval", Check{Service: "tcp-8080", Type: TypeTCP, Interval: 10, Timeout: 11}, false, 0, 0},
+		{"status out of range", Check{Service: "tcp-8080", Type: TypeHTTP, ExpectStatus: 600}, false, 0, 0},
+		{"blank command", Check{Service: "tcp-8080", Type: TypeCommand, Command: "  "}, false, 0, 0},
+		{"unknown type", Check{Service: "tcp-8080", Type: "ping"}, false, 0, 0},
+		{"no type", Check{Service: "tcp-8080"}, false, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.check
+			err := c.normalize()
+			if !tt.ok {
+				if !errors.Is(err, ErrInvalidCheck) {
+					t.Errorf("normalize() = %v, want ErrInvalidCheck", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("normalize() = %v", err)
+			}
+			if c.Interval != tt.interval || c.Timeout != tt.timeout {
+				t.Errorf("interval, timeout = %d, %d, want %d, %d", c.Interval, c.Timeout, tt.interval, tt.timeout)
+			}
+		})
+	}
+}
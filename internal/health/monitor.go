@@ -0,0 +1,427 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"dev-machine-proxy/internal/discovery"
+)
+
+const (
+	spanRetention    = 7 * 24 * time.Hour // Up/down history, for the 7 day uptime
+	latencyRetention = 24 * time.Hour
+	flushInterval    = time.Minute // How often latency samples are written to disk
+)
+
+// Span is a stretch of time a check kept reporting the same state. Each new
+// span is an up/down transition.
+type Span struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"` // Last check that confirmed the state
+	Up    bool      `json:"up"`
+	Error string    `json:"error,omitempty"` // Why the check failed when the span began
+}
+
+// LatencyPoint is a single check result
+type LatencyPoint struct {
+	Timestamp time.Time `json:"timestamp"`
+	LatencyMs float64   `json:"latencyMs"`
+	Up        bool      `json:"up"`
+}
+
+// History is the persisted record of one check
+type History struct {
+	Spans   []Span         `json:"spans"`
+	Latency []LatencyPoint `json:"latency"`
+}
+
+// Status is a check with its current state and uptime
+type Status struct {
+	Check       Check          `json:"check"`
+	State       string         `json:"state"` // up, down or unknown (not run yet)
+	LastChecked *time.Time     `json:"lastChecked,omitempty"`
+	LastError   string         `json:"lastError,omitempty"`
+	LatencyMs   float64        `json:"latencyMs"`
+	Uptime24h   *float64       `json:"uptime24h"` // Percent of the checked time, nil without data
+	Uptime7d    *float64       `json:"uptime7d"`
+	Transitions []Span         `json:"transitions,omitempty"` // Last 7 days, oldest first
+	Latency     []LatencyPoint `json:"latency,omitempty"`     // Last 24 hours
+}
+
+// Monitor runs health checks on their own schedule, independent of discovery
+type Monitor struct {
+	lookup      func(id string) (discovery.Service, bool)
+	checksPath  string
+	historyPath string
+
+	mu        sync.RWMutex
+	checks    []Check
+	histories map[string]*History // by check ID
+	lastError map[string]string   // by check ID, latest failure
+	nextRun   map[string]time.Time
+	running   map[string]bool
+	dirty     bool
+}
+
+// getHealthPath returns the path to a health check file in the config directory
+func getHealthPath(name string) string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		configDir = os.Getenv("HOME")
+	}
+	return filepath.Join(configDir, "dev-machine-proxy", name)
+}
+
+// NewMonitor creates a health monitor that finds services through lookup
+func NewMonitor(lookup func(id string) (discovery.Service, bool)) *Monitor {
+	m := &Monitor{
+		lookup:      lookup,
+		checksPath:  getHealthPath("health-checks.json"),
+		historyPath: getHealthPath("health-history.json"),
+		histories:   make(map[string]*History),
+		lastError:   make(map[string]string),
+		nextRun:     make(map[string]time.Time),
+		running:     make(map[string]bool),
+	}
+	if err := readJSON(m.checksPath, &m.checks); err != nil {
+		log.Printf("Warning: could not load health checks from %s: %v", m.checksPath, err)
+	}
+	if err := readJSON(m.historyPath, &m.histories); err != nil {
+		log.Printf("Warning: could not load health history from %s: %v", m.historyPath, err)
+	}
+	if m.histories == nil {
+		m.histories = make(map[string]*History)
+	}
+	return m
+}
+
+// Start runs due checks every second and saves the history every minute
+func (m *Monitor) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		flush := time.NewTicker(flushInterval)
+		defer flush.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				m.save()
+				return
+			case <-ticker.C:
+				m.runDue(ctx)
+			case <-flush.C:
+				m.save()
+			}
+		}
+	}()
+}
+
+// runDue starts every check whose interval has passed and that isn't still
+// running from last time
+func (m *Monitor) runDue(ctx context.Context) {
+	now := time.Now()
+	m.mu.Lock()
+	var due []Check
+	for _, c := range m.checks {
+		if m.running[c.ID] || now.Before(m.nextRun[c.ID]) {
+			continue
+		}
+		m.running[c.ID] = true
+		m.nextRun[c.ID] = now.Add(time.Duration(c.Interval) * time.Second)
+		due = append(due, c)
+	}
+	m.mu.Unlock()
+
+	for _, c := range due {
+		go func() {
+			var svc *discovery.Service
+			if s, ok := m.lookup(c.Service); ok {
+				svc = &s
+			}
+			result := c.run(ctx, svc)
+			if ctx.Err() != nil {
+				return // Shutting down; the result says nothing about the service
+			}
+			m.record(c, time.Now(), result)
+		}()
+	}
+}
+
+// record adds a result to the check's history. A result that changes the
+// state, or follows a gap in checking, starts a new span and is saved
+// straight away.
+func (m *Monitor) record(c Check, at time.Time, result Result) {
+	m.mu.Lock()
+	delete(m.running, c.ID)
+	if !m.hasCheckLocked(c.ID) {
+		m.mu.Unlock()
+		return // Deleted while running
+	}
+
+	h := m.histories[c.ID]
+	if h == nil {
+		h = &History{}
+		m.histories[c.ID] = h
+	}
+	m.lastError[c.ID] = result.Error
+
+	// Missing a couple of runs (e.g. while the dashboard was stopped) leaves
+	// a gap rather than stretching the last span over time nobody checked
+	maxGap := time.Duration(2*c.Interval+c.Timeout) * time.Second
+	transition := true
+	if n := len(h.Spans); n > 0 {
+		last := &h.Spans[n-1]
+		contiguous := at.Sub(last.End) <= maxGap
+		switch {
+		case contiguous && last.Up == result.Up:
+			last.End = at
+			transition = false
+		case contiguous:
+			h.Spans = append(h.Spans, Span{Start: last.End, End: at, Up: result.Up, Error: result.Error})
+		default:
+			h.Spans = append(h.Spans, Span{Start: at, End: at, Up: result.Up, Error: result.Error})
+		}
+	} else {
+		h.Spans = append(h.Spans, Span{Start: at, End: at, Up: result.Up, Error: result.Error})
+	}
+
+	h.Latency = append(h.Latency, LatencyPoint{Timestamp: at, LatencyMs: float64(result.Latency.Microseconds()) / 1000, Up: result.Up})
+	pruneHistory(h, at)
+	firstResult := len(h.Spans) == 1 && len(h.Latency) == 1
+	m.dirty = true
+	m.mu.Unlock()
+
+	if transition {
+		if !firstResult {
+			state := "up"
+			if !result.Up {
+				state = "down: " + result.Error
+			}
+			log.Printf("Health check %s for %s is %s", c.ID, c.Service, state)
+		}
+		m.save()
+	}
+}
+
+func pruneHistory(h *History, now time.Time) {
+	spanCutoff := now.Add(-spanRetention)
+	i := 0
+	for i < len(h.Spans) && h.Spans[i].End.Before(spanCutoff) {
+		i++
+	}
+	h.Spans = h.Spans[i:]
+
+	latencyCutoff := now.Add(-latencyRetention)
+	i = 0
+	for i < len(h.Latency) && h.Latency[i].Timestamp.Before(latencyCutoff) {
+		i++
+	}
+	h.Latency = h.Latency[i:]
+}
+
+// uptime returns the percentage of the checked time within window that the
+// check was up, or nil if it wasn't checked during the window
+func uptime(spans []Span, now time.Time, window time.Duration) *float64 {
+	from := now.Add(-window)
+	var checked, up time.Duration
+	for _, s := range spans {
+		start, end := s.Start, s.End
+		if start.Before(from) {
+			start = from
+		}
+		if !end.After(start) {
+			continue
+		}
+		checked += end.Sub(start)
+		if s.Up {
+			up += end.Sub(start)
+		}
+	}
+	if checked == 0 {
+		// A single check covers no time yet; report its state
+		if n := len(spans); n > 0 && !spans[n-1].End.Before(from) {
+			pct := 0.0
+			if spans[n-1].Up {
+				pct = 100
+			}
+			return &pct
+		}
+		return nil
+	}
+	pct := float64(up) / float64(checked) * 100
+	return &pct
+}
+
+// statusLocked builds the Status of a check; detail adds the transitions and
+// latency samples
+func (m *Monitor) statusLocked(c Check, now time.Time, detail bool) Status {
+	st := Status{Check: c, State: "unknown"}
+	h := m.histories[c.ID]
+	if h == nil || len(h.Spans) == 0 {
+		return st
+	}
+
+	last := h.Spans[len(h.Spans)-1]
+	st.State = "down"
+	if last.Up {
+		st.State = "up"
+	}
+	st.LastChecked = &last.End
+	st.LastError = m.lastError[c.ID]
+	if st.LastError == "" && !last.Up {
+		st.LastError = last.Error // Not re-run since the dashboard started
+	}
+	if n := len(h.Latency); n > 0 {
+		st.LatencyMs = h.Latency[n-1].LatencyMs
+	}
+	st.Uptime24h = uptime(h.Spans, now, 24*time.Hour)
+	st.Uptime7d = uptime(h.Spans, now, 7*24*time.Hour)
+	if detail {
+		st.Transitions = append([]Span{}, h.Spans...)
+		st.Latency = append([]LatencyPoint{}, h.Latency...)
+	}
+	return st
+}
+
+// Statuses returns every check with its current state, without history
+func (m *Monitor) Statuses() []Status {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	result := make([]Status, len(m.checks))
+	for i, c := range m.checks {
+		result[i] = m.statusLocked(c, now, false)
+	}
+	return result
+}
+
+// ServiceHealth returns the checks of one service with their history
+func (m *Monitor) ServiceHealth(serviceID string) []Status {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	result := []Status{}
+	for _, c := range m.checks {
+		if c.Service == serviceID {
+			result = append(result, m.statusLocked(c, now, true))
+		}
+	}
+	return result
+}
+
+// Checks returns the configured health checks
+func (m *Monitor) Checks() []Check {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]Check{}, m.checks...)
+}
+
+// AddCheck saves a new check; it first runs on the next tick
+func (m *Monitor) AddCheck(c Check) (Check, error) {
+	if err := c.normalize(); err != nil {
+		return Check{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c.ID = time.Now().Format("20060102150405.000000000")
+	m.checks = append(m.checks, c)
+	if err := m.saveChecksLocked(); err != nil {
+		return Check{}, err
+	}
+	return c, nil
+}
+
+// UpdateCheck replaces the check with the same ID and runs it again soon.
+// The history is kept.
+func (m *Monitor) UpdateCheck(c Check) (Check, error) {
+	if err := c.normalize(); err != nil {
+		return Check{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.checks {
+		if m.checks[i].ID == c.ID {
+			m.checks[i] = c
+			delete(m.nextRun, c.ID)
+			return c, m.saveChecksLocked()
+		}
+	}
+	return Check{}, fmt.Errorf("%w: %s", ErrUnknownCheck, c.ID)
+}
+
+// DeleteCheck removes a check and its history
+func (m *Monitor) DeleteCheck(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.checks {
+		if m.checks[i].ID == id {
+			m.checks = append(m.checks[:i], m.checks[i+1:]...)
+			delete(m.histories, id)
+			delete(m.lastError, id)
+			delete(m.nextRun, id)
+			m.dirty = true
+			return m.saveChecksLocked()
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrUnknownCheck, id)
+}
+
+func (m *Monitor) hasCheckLocked(id string) bool {
+	for _, c := range m.checks {
+		if c.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Monitor) saveChecksLocked() error {
+	return writeJSON(m.checksPath, m.checks)
+}
+
+// save writes the history if it changed since the last save
+func (m *Monitor) save() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.dirty {
+		return
+	}
+	if err := writeJSON(m.historyPath, m.histories); err != nil {
+		log.Printf("Warning: could not save health history: %v", err)
+		return
+	}
+	m.dirty = false
+}
+
+func readJSON(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func writeJSON(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,128 @@
+package health
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"dev-machine-proxy/internal/discovery"
+)
+
+func TestUptime(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	ago := func(d time.Duration) time.Time { return now.Add(-d) }
+	const day = 24 * time.Hour
+
+	tests := []struct {
+		name            string
+		spans           []Span
+		want24h, want7d float64 // -1 for no data
+	}{
+		{"no checks", nil, -1, -1},
+		{"always up", []Span{{Start: ago(3 * day), End: now, Up: true}}, 100, 100},
+		{"down half of the last day", []Span{
+			{Start: ago(day), End: ago(12 * time.Hour), Up: true},
+			{Start: ago(12 * time.Hour), End: now, Up: false},
+		}, 50, 50},
+		{"outage before the last day", []Span{
+			{Start: ago(3 * day), End: ago(day), Up: false},
+			{Start: ago(day), End: now, Up: true},
+		}, 100, 100.0 / 3},
+		{"gaps aren't counted", []Span{
+			{Start: ago(5 * time.Hour), End: ago(4 * time.Hour), Up: true},
+			{Start: ago(2 * time.Hour), End: ago(time.Hour), Up: false},
+		}, 50, 50},
+		{"span straddling the window", []Span{{Start: ago(2 * day), End: ago(12 * time.Hour), Up: false}}, 0, 0},
+		{"older than the window", []Span{{Start: ago(9 * day), End: ago(8 * day), Up: true}}, -1, -1},
+		{"single check", []Span{{Start: ago(time.Minute), End: ago(time.Minute), Up: true}}, 100, 100},
+		{"single failed check", []Span{{Start: ago(2 * day), End: ago(2 * day), Up: false}}, -1, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, w := range []struct {
+				window time.Duration
+				want   float64
+			}{{day, tt.want24h}, {7 * day, tt.want7d}} {
+				got := uptime(tt.spans, now, w.window)
+				switch {
+				case got == nil && w.want != -1:
+					t.Errorf("uptime(%v) = nil, want %.2f", w.window, w.want)
+				case got != nil && (w.want == -1 || *got-w.want > 1e-9 || w.want-*got > 1e-9):
+					t.Errorf("uptime(%v) = %.2f, want %.2f", w.window, *got, w.want)
+				}
+			}
+		})
+	}
+}
+
+func TestRecordSpans(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	m := NewMonitor(func(string) (discovery.Service, bool) { return discovery.Service{}, false })
+	c, err := m.AddCheck(Check{Service: "tcp-8080", Type: TypeTCP, Interval: 10, Timeout: 5}) // Runs more than 25s apart leave a gap
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	at := func(seconds int) time.Time { return start.Add(time.Duration(seconds) * time.Second) }
+	up := Result{Up: true, Latency: time.Millisecond}
+	down := Result{Error: "connection refused"}
+
+	steps := []struct {
+		at     int
+		result Result
+		want   []Span
+	}{
+		{0, up, []Span{{Start: at(0), End: at(0), Up: true}}},
+		{10, up, []Span{{Start: at(0), End: at(10), Up: true}}},
+		{20, down, []Span{
+			{Start: at(0), End: at(10), Up: true},
+			{Start: at(10), End: at(20), Error: "connection refused"},
+		}},
+		{30, down, []Span{
+			{Start: at(0), End: at(10), Up: true},
+			{Start: at(10), End: at(30), Error: "connection refused"},
+		}},
+		{40, up, []Span{
+			{Start: at(0), End: at(10), Up: true},
+			{Start: at(10), End: at(30), Error: "connection refused"},
+			{Start: at(30), End: at(40), Up: true},
+		}},
+		{200, up, []Span{ // Same state after a gap still starts a span
+			{Start: at(0), End: at(10), Up: true},
+			{Start: at(10), End: at(30), Error: "connection refused"},
+			{Start: at(30), End: at(40), Up: true},
+			{Start: at(200), End: at(200), Up: true},
+		}},
+		{210, down, []Span{
+			{Start: at(0), End: at(10), Up: true},
+			{Start: at(10), End: at(30), Error: "connection refused"},
+			{Start: at(30), End: at(40), Up: true},
+			{Start: at(200), End: at(200), Up: true},
+			{Start: at(200), End: at(210), Error: "connection refused"},
+		}},
+		{8 * 24 * 3600, up, []Span{ // Earlier spans fall out of the retention
+			{Start: at(8 * 24 * 3600), End: at(8 * 24 * 3600), Up: true},
+		}},
+	}
+
+	for _, step := range steps {
+		m.record(c, at(step.at), step.result)
+		if got := m.histories[c.ID].Spans; !reflect.DeepEqual(got, step.want) {
+			t.Fatalf("after the result at %ds, spans = %+v, want %+v", step.at, got, step.want)
+		}
+	}
+	if n := len(m.histories[c.ID].Latency); n != 1 {
+		t.Errorf("kept %d latency samples, want only the last day's", n)
+	}
+
+	// Results for a check deleted while it ran are dropped
+	if err := m.DeleteCheck(c.ID); err != nil {
+		t.Fatal(err)
+	}
+	m.record(c, at(8*24*3600+10), down)
+	if got := m.histories[c.ID]; got != nil && len(got.Spans) > 1 {
+		t.Errorf("recorded a result for a deleted check: %+v", got.Spans)
+	}
+}
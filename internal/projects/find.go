@@ -0,0 +1,225 @@
+package projects
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"dev-machine-proxy/internal/config"
+)
+
+// DefaultMaxDepth is how deep below a root projects are looked for when the
+// root doesn't say: enough for ~/code/org/repo/packages/app
+const DefaultMaxDepth = 4
+
+// Location is a project directory found under one of the project roots
+type Location struct {
+	Name     string   // Path relative to its root, e.g. org/repo or repo/packages/web
+	Path     string   // Absolute path
+	Root     string   // The root it was found under
+	Markers  []string // Files that marked it as a project: .git, go.mod, package.json, compose files
+	Monorepo bool     // Whether it contains further projects (workspaces)
+}
+
+// projectMarkers are the files or directories that make a directory a project
+var projectMarkers = []string{".git", "go.mod", "package.json", "compose.yaml", "compose.yml", "docker-compose.yml", "docker-compose.yaml"}
+
+// skipDirs are never walked, ignored or not
+var skipDirs = map[string]bool{"node_modules": true, ".git": true}
+
+// Find walks the roots for project directories. Each root is searched to its
+// max depth; a directory with a project marker is a project, and its
+// subdirectories are only searched further when it's a monorepo. Paths ignored
+// by a .gitignore, hidden directories and node_modules are skipped. A project
+// found under several roots is listed once.
+func Find(roots []config.ProjectRoot) []Location {
+	var found []Location
+	seen := make(map[string]bool)
+	for _, root := range roots {
+		for _, loc := range findInRoot(root) {
+			if !seen[loc.Path] {
+				seen[loc.Path] = true
+				found = append(found, loc)
+			}
+		}
+	}
+	return found
+}
+
+// RescanInterval is how long a Finder reuses a walk while its roots are unchanged
+const RescanInterval = 5 * time.Minute
+
+// Finder caches Find for discovery runs and project listings, which happen far
+// more often than projects are created. It walks the roots again when they
+// change, when its last walk is RescanInterval old, or after Invalidate.
+type Finder struct {
+	roots func() []config.ProjectRoot
+
+	mu      sync.Mutex
+	last    []config.ProjectRoot // Roots of the cached walk
+	scanned time.Time
+	found   []Location
+}
+
+// NewFinder creates a Finder. roots is called on every Find, so changes to
+// the configured roots apply straight away.
+func NewFinder(roots func() []config.ProjectRoot) *Finder {
+	return &Finder{roots: roots}
+}
+
+// Find returns the projects under the current roots (see the package Find)
+func (f *Finder) Find() []Location {
+	roots := f.roots()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.scanned.IsZero() || time.Since(f.scanned) >= RescanInterval || !reflect.DeepEqual(roots, f.last) {
+		f.found = Find(roots)
+		f.last = roots
+		f.scanned = time.Now()
+	}
+	return f.found
+}
+
+// Invalidate makes the next Find walk the roots again
+func (f *Finder) Invalidate() {
+	f.mu.Lock()
+	f.scanned = time.Time{}
+	f.mu.Unlock()
+}
+
+// ExpandPath makes a root path absolute, expanding a leading ~ and resolving
+// symlinks so it compares equal to process working directories
+func ExpandPath(p string) string {
+	if p == "~" || strings.HasPrefix(p, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			p = filepath.Join(home, strings.TrimPrefix(p, "~"))
+		}
+	}
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return p
+	}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		return resolved
+	}
+	return abs
+}
+
+func findInRoot(root config.ProjectRoot) []Location {
+	if root.Path == "" {
+		return nil
+	}
+	rootPath := ExpandPath(root.Path)
+	maxDepth := root.MaxDepth
+	if maxDepth <= 0 {
+		maxDepth = DefaultMaxDepth
+	}
+
+	var found []Location
+	var walk func(dir, rel string, depth int, ignores []ignoreRule)
+	walk = func(dir, rel string, depth int, ignores []ignoreRule) {
+		ignores = append(ignores[:len(ignores):len(ignores)], readGitignore(dir, rel)...)
+
+		// A monorepo is searched further even when it isn't included
+		// itself, so globs like acme/*/packages/* can reach its packages
+		markers := markersIn(dir)
+		monorepo := len(markers) > 0 && isMonorepo(dir)
+		if len(markers) > 0 && included(root, rel) {
+			name := rel
+			if name == "" {
+				name = filepath.Base(rootPath)
+			}
+			found = append(found, Location{Name: name, Path: dir, Root: rootPath, Markers: markers, Monorepo: monorepo})
+		}
+		if (len(markers) > 0 && !monorepo) || depth == maxDepth {
+			return
+		}
+
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if !entry.IsDir() || skipDirs[name] || strings.HasPrefix(name, ".") {
+				continue
+			}
+			childRel := name
+			if rel != "" {
+				childRel = rel + "/" + name
+			}
+			if excluded(root, childRel) || ignored(ignores, childRel, true) {
+				continue
+			}
+			walk(filepath.Join(dir, name), childRel, depth+1, ignores)
+		}
+	}
+	walk(rootPath, "", 0, nil)
+
+	sort.Slice(found, func(i, j int) bool { return found[i].Path < found[j].Path })
+	return found
+}
+
+// markersIn lists the project markers present in dir
+func markersIn(dir string) []string {
+	var markers []string
+	for _, m := range projectMarkers {
+		if _, err := os.Stat(filepath.Join(dir, m)); err == nil {
+			markers = append(markers, m)
+		}
+	}
+	return markers
+}
+
+// isMonorepo reports whether dir declares workspaces: npm/yarn workspaces,
+// pnpm, Lerna, Nx, Turborepo, go.work or a Cargo workspace
+func isMonorepo(dir string) bool {
+	for _, f := range []string{"pnpm-workspace.yaml", "lerna.json", "nx.json", "turbo.json", "go.work"} {
+		if _, err := os.Stat(filepath.Join(dir, f)); err == nil {
+			return true
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "package.json")); err == nil {
+		var pkg struct {
+			Workspaces json.RawMessage `json:"workspaces"`
+		}
+		if json.Unmarshal(data, &pkg) == nil && len(pkg.Workspaces) > 0 && string(pkg.Workspaces) != "null" {
+			return true
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "Cargo.toml")); err == nil && strings.Contains(string(data), "[workspace]") {
+		return true
+	}
+	return false
+}
+
+// included reports whether a project at rel passes the root's include globs
+// (all projects do when there are none)
+func included(root config.ProjectRoot, rel string) bool {
+	if len(root.Include) == 0 {
+		return true
+	}
+	for _, glob := range root.Include {
+		if matchGlob(glob, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// excluded reports whether rel matches one of the root's exclude globs;
+// excluded directories aren't walked at all
+func excluded(root config.ProjectRoot, rel string) bool {
+	for _, glob := range root.Exclude {
+		if matchGlob(glob, rel) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,171 @@
+package projects
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"dev-machine-proxy/internal/config"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"acme", "acme", true},
+		{"acme", "acme/web", false},
+		{"acme/*", "acme/web", true},
+		{"acme/*", "acme/web/packages", false},
+		{"acme/**", "acme", true},
+		{"acme/**", "acme/web/packages/ui", true},
+		{"**/vendor", "vendor", true},
+		{"**/vendor", "acme/api/vendor", true},
+		{"**/vendor", "acme/api/vendored", false},
+		{"acme/*/packages/*", "acme/shop/packages/web", true},
+		{"acme/*/packages/*", "acme/shop/packages", false},
+		{"a/**/z", "a/b/c/z", true},
+		{"a/**/z", "a/z", true},
+		{"*-old", "shop-old", true},
+		{"[", "[", false}, // Malformed patterns match nothing
+	}
+
+	for _, tt := range tests {
+		if got := matchGlob(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestIgnored(t *testing.T) {
+	rules := []ignoreRule{
+		{pattern: "build", dirOnly: true},
+		{pattern: "*.log"},
+		{pattern: "tmp/cache", anchored: true},
+		{base: "web", pattern: "dist", dirOnly: true},
+		{base: "web", pattern: "scripts/gen", anchored: true},
+		{pattern: "keep.log", negate: true},
+	}
+
+	tests := []struct {
+		rel   string
+		isDir bool
+		want  bool
+	}{
+		{"build", true, true},
+		{"api/build", true, true},
+		{"build", false, false}, // dirOnly
+		{"debug.log", false, true},
+		{"api/debug.log", false, true},
+		{"keep.log", false, false}, // Negated by a later rule
+		{"tmp/cache", true, true},
+		{"api/tmp/cache", true, false}, // Anchored to the root
+		{"web/dist", true, true},
+		{"dist", true, false}, // Rule belongs to web/.gitignore
+		{"web/scripts/gen", true, true},
+		{"web/app/scripts/gen", true, false},
+		{"webapp/dist", true, false},
+		{"src", true, false},
+	}
+
+	for _, tt := range tests {
+		if got := ignored(rules, tt.rel, tt.isDir); got != tt.want {
+			t.Errorf("ignored(%q, dir=%v) = %v, want %v", tt.rel, tt.isDir, got, tt.want)
+		}
+	}
+}
+
+// writeTree creates files (with the given contents) under dir
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func locationNames(locs []Location) []string {
+	names := []string{}
+	for _, loc := range locs {
+		names = append(names, loc.Name)
+	}
+	return names
+}
+
+func TestFindInRoot(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"acme/shop/package.json":              `{"workspaces": ["packages/*"]}`,
+		"acme/shop/packages/web/package.json": `{}`,
+		"acme/shop/packages/api/go.mod":       "module api",
+		"acme/blog/go.mod":                    "module blog",
+		"acme/blog/cmd/tool/go.mod":           "module tool", // Inside a plain project, not searched
+		"acme/old/compose.yml":                "services: {}",
+		"acme/ignored/go.mod":                 "module ignored",
+		"acme/.gitignore":                     "ignored/\n",
+		"solo/go.mod":                         "module solo",
+		"solo/node_modules/dep/package.json":  `{}`,
+	})
+
+	tests := []struct {
+		name string
+		root config.ProjectRoot
+		want []string
+	}{
+		{"everything", config.ProjectRoot{Path: dir}, []string{"acme/blog", "acme/old", "acme/shop", "acme/shop/packages/api", "acme/shop/packages/web", "solo"}},
+		{"include", config.ProjectRoot{Path: dir, Include: []string{"acme/**"}}, []string{"acme/blog", "acme/old", "acme/shop", "acme/shop/packages/api", "acme/shop/packages/web"}},
+		{"include packages only", config.ProjectRoot{Path: dir, Include: []string{"acme/*/packages/*"}}, []string{"acme/shop/packages/api", "acme/shop/packages/web"}},
+		{"exclude", config.ProjectRoot{Path: dir, Exclude: []string{"acme/old", "**/packages"}}, []string{"acme/blog", "acme/shop", "solo"}},
+		{"max depth", config.ProjectRoot{Path: dir, MaxDepth: 1}, []string{"solo"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := locationNames(findInRoot(tt.root)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("findInRoot() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFinderCaches(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"one/go.mod": "module one"})
+
+	roots := []config.ProjectRoot{{Path: dir}}
+	f := NewFinder(func() []config.ProjectRoot { return roots })
+	if got := locationNames(f.Find()); !reflect.DeepEqual(got, []string{"one"}) {
+		t.Fatalf("Find() = %q", got)
+	}
+
+	// New projects show up on a rescan, not on every call
+	writeTree(t, dir, map[string]string{"two/go.mod": "module two"})
+	if got := locationNames(f.Find()); !reflect.DeepEqual(got, []string{"one"}) {
+		t.Errorf("cached Find() = %q, want [one]", got)
+	}
+	f.Invalidate()
+	if got := locationNames(f.Find()); !reflect.DeepEqual(got, []string{"one", "two"}) {
+		t.Errorf("Find() after Invalidate = %q, want [one two]", got)
+	}
+
+	// Changed roots are walked straight away
+	writeTree(t, dir, map[string]string{"three/go.mod": "module three"})
+	roots = []config.ProjectRoot{{Path: dir, Exclude: []string{"one"}}}
+	if got := locationNames(f.Find()); !reflect.DeepEqual(got, []string{"three", "two"}) {
+		t.Errorf("Find() after a root change = %q, want [three two]", got)
+	}
+
+	// And stale walks are redone
+	writeTree(t, dir, map[string]string{"four/go.mod": "module four"})
+	f.scanned = time.Now().Add(-RescanInterval)
+	if got := locationNames(f.Find()); !reflect.DeepEqual(got, []string{"four", "three", "two"}) {
+		t.Errorf("Find() after RescanInterval = %q, want [four three two]", got)
+	}
+}
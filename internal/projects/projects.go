@@ -23,39 +23,24 @@ type Project struct {
 	Tags         []string  `json:"tags"`
 }
 
-// Scanner scans a directory for projects
+// Scanner scans the project roots for projects
 type Scanner struct {
-	projectsDir string
+	finder *Finder
 }
 
-// NewScanner creates a new project scanner
-func NewScanner(projectsDir string) *Scanner {
-	return &Scanner{projectsDir: projectsDir}
+// NewScanner creates a new project scanner over the projects finder finds
+func NewScanner(finder *Finder) *Scanner {
+	return &Scanner{finder: finder}
 }
 
-// Scan finds all projects in the configured directory
+// Scan finds all projects under the configured roots
 func (s *Scanner) Scan() []Project {
-	if s.projectsDir == "" {
-		return nil
-	}
-
-	entries, err := os.ReadDir(s.projectsDir)
-	if err != nil {
-		return nil
-	}
-
 	var projects []Project
-	for _, entry := range entries {
-		if !entry.IsDir() {
-			continue
-		}
-		// Skip hidden directories
-		if strings.HasPrefix(entry.Name(), ".") {
-			continue
+	for _, loc := range s.finder.Find() {
+		project := s.analyzeProject(loc.Name, loc.Path)
+		if loc.Monorepo {
+			project.Tags = append(project.Tags, "monorepo")
 		}
-
-		path := filepath.Join(s.projectsDir, entry.Name())
-		project := s.analyzeProject(entry.Name(), path)
 		projects = append(projects, project)
 	}
 
@@ -0,0 +1,334 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"dev-machine-proxy/internal/discovery"
+)
+
+// PathPrefix is the URL prefix used for path-based proxying (/svc/<name>/...)
+const PathPrefix = "/svc/"
+
+// Handler forwards dashboard requests to discovered services
+type Handler struct {
+	discoverer *discovery.Discoverer
+	transport  *http.Transport
+	baseHosts  []string // Dashboard hosts whose subdomains name services
+}
+
+// DefaultBaseHosts are the dashboard hosts whose subdomains are proxied
+// unless others are set: localhost and this machine's hostname
+func DefaultBaseHosts() []string {
+	hosts := []string{"localhost"}
+	if name, err := os.Hostname(); err == nil && name != "" {
+		hosts = append(hosts, name)
+		if short, _, ok := strings.Cut(name, "."); ok {
+			hosts = append(hosts, short)
+		}
+	}
+	return hosts
+}
+
+// NewHandler creates a new proxy handler
+func NewHandler(d *discovery.Discoverer) *Handler {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true} // Dev servers use self-signed certs
+
+	return &Handler{
+		discoverer: d,
+		transport:  transport,
+		baseHosts:  DefaultBaseHosts(),
+	}
+}
+
+// SetBaseHosts replaces the hosts the dashboard is reached at whose
+// subdomains are proxied to services, e.g. devbox.tailnet.ts.net
+func (h *Handler) SetBaseHosts(hosts []string) {
+	h.baseHosts = nil
+	for _, host := range hosts {
+		if host = strings.TrimSuffix(strings.TrimSpace(host), "."); host != "" {
+			h.baseHosts = append(h.baseHosts, host)
+		}
+	}
+}
+
+// IsBaseHost reports whether host (without a port) is one of the dashboard
+// hosts that <service>.<host> subdomains are served under
+func (h *Handler) IsBaseHost(host string) bool {
+	host = strings.TrimSuffix(host, ".")
+	if host == "" || net.ParseIP(host) != nil {
+		return false
+	}
+	for _, base := range h.baseHosts {
+		if strings.EqualFold(host, base) {
+			return true
+		}
+	}
+	return false
+}
+
+// ServeHTTP handles path-based proxy requests under /svc/<name>/
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, PathPrefix)
+	key, subPath, hasSlash := strings.Cut(rest, "/")
+	if key == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	svc, ok := h.lookup(key)
+	if !ok {
+		http.Error(w, fmt.Sprintf("No discovered service matches %q", key), http.StatusBadGateway)
+		return
+	}
+
+	// Relative links in the proxied app only resolve under a trailing slash
+	if !hasSlash {
+		target := PathPrefix + key + "/"
+		if r.URL.RawQuery != "" {
+			target += "?" + r.URL.RawQuery
+		}
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+		return
+	}
+
+	h.forward(w, r, svc, PathPrefix+key, "/"+subPath)
+}
+
+// ServeSubdomain proxies requests whose Host is <name>.<base-host>, where the
+// base host is one the dashboard is reached at (see SetBaseHosts). It returns
+// false without writing anything when the host doesn't name a service.
+func (h *Handler) ServeSubdomain(w http.ResponseWriter, r *http.Request) bool {
+	host := r.Host
+	if hostOnly, _, err := net.SplitHostPort(host); err == nil {
+		host = hostOnly
+	}
+
+	label, base, ok := strings.Cut(host, ".")
+	if !ok || !h.IsBaseHost(base) {
+		return false
+	}
+	svc, ok := h.lookup(label)
+	if !ok {
+		return false
+	}
+
+	h.forward(w, r, svc, "", r.URL.Path)
+	return true
+}
+
+// forward proxies a request to a service. prefix is the path the dashboard
+// mounted the service under ("" for subdomain routing) and path is the
+// request path as the service should see it.
+func (h *Handler) forward(w http.ResponseWriter, r *http.Request, svc discovery.Service, prefix, path string) {
+	target := TargetURL(svc)
+
+	rp := &httputil.ReverseProxy{
+		Transport: h.transport,
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.Out.URL.Path = path
+			pr.Out.URL.RawPath = ""
+			pr.SetURL(target)
+			pr.SetXForwarded()
+			if prefix != "" {
+				pr.Out.Header.Set("X-Forwarded-Prefix", prefix)
+			}
+		},
+		ModifyResponse: func(resp *http.Response) error {
+			rewriteLocation(resp, target, publicScheme(r), r.Host, prefix)
+			rewriteCookies(resp, prefix)
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+			log.Printf("Proxy error for %s (port %d): %v", svc.Name, svc.Port, err)
+			http.Error(w, fmt.Sprintf("Proxy error: %v", err), http.StatusBadGateway)
+		},
+	}
+
+	rp.ServeHTTP(w, r)
+}
+
+// lookup finds the service addressed by a proxy key (see Key) or a bare port
+// number. Internal container ports are only proxied when the host can reach
+// them, and never by bare port number, which always means the host port.
+func (h *Handler) lookup(key string) (discovery.Service, bool) {
+	services := h.discoverer.GetServices()
+	key = strings.ToLower(key)
+
+	for _, svc := range services {
+		if svc.Protocol != "tcp" {
+			continue
+		}
+		if svc.Exposure == discovery.ExposureInternal {
+			if svc.IsHTTP && Key(svc, services) == key {
+				return svc, true
+			}
+			continue
+		}
+		if Key(svc, services) == key || strconv.Itoa(svc.Port) == key {
+			return svc, true
+		}
+	}
+	return discovery.Service{}, false
+}
+
+// Key returns the name a service is addressed by in proxy URLs. It is the
+// slugified service name, suffixed with the port when several services share
+// it, and also with the container for internal container ports.
+func Key(svc discovery.Service, all []discovery.Service) string {
+	slug := Slug(svc.Name)
+	if slug == "" && svc.Exposure != discovery.ExposureInternal {
+		return strconv.Itoa(svc.Port)
+	}
+
+	suffix := strconv.Itoa(svc.Port)
+	if svc.Exposure == discovery.ExposureInternal {
+		suffix = Slug(svc.Container) + "-" + suffix
+		if slug == "" || slug == Slug(svc.Container) {
+			return suffix
+		}
+	}
+
+	for _, other := range all {
+		if other.Protocol == "tcp" && Slug(other.Name) == slug && !sameService(other, svc) {
+			return slug + "-" + suffix
+		}
+	}
+	return slug
+}
+
+func sameService(a, b discovery.Service) bool {
+	return a.Port == b.Port && a.Protocol == b.Protocol && a.Exposure == b.Exposure && a.Container == b.Container
+}
+
+// Slug converts a service name into a lowercase, DNS-label-safe identifier
+func Slug(name string) string {
+	var b strings.Builder
+	lastDash := true // Suppresses leading dashes
+
+	for _, c := range strings.ToLower(name) {
+		if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') {
+			b.WriteRune(c)
+			lastDash = false
+		} else if !lastDash {
+			b.WriteByte('-')
+			lastDash = true
+		}
+	}
+
+	return strings.TrimSuffix(b.String(), "-")
+}
+
+// TargetURL returns the URL the proxy forwards a service's traffic to: an
+// address the service is bound to (see discovery.DialHost), or the container address
+// for internal container ports
+func TargetURL(svc discovery.Service) *url.URL {
+	scheme := "http"
+	if strings.HasPrefix(svc.URL, "https://") {
+		scheme = "https"
+	}
+
+	host := discovery.DialHost(svc.BindAddresses)
+	if svc.Exposure == discovery.ExposureInternal {
+		if u, err := url.Parse(svc.URL); err == nil && u.Hostname() != "" {
+			host = u.Hostname()
+		}
+	}
+
+	return &url.URL{
+		Scheme: scheme,
+		Host:   net.JoinHostPort(host, strconv.Itoa(svc.Port)),
+	}
+}
+
+// publicScheme is the scheme the browser used to reach the dashboard
+func publicScheme(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// rewriteLocation maps redirects that point at the service back onto the dashboard
+func rewriteLocation(resp *http.Response, target *url.URL, publicScheme, publicHost, prefix string) {
+	location := resp.Header.Get("Location")
+	if location == "" {
+		return
+	}
+
+	loc, err := url.Parse(location)
+	if err != nil {
+		return
+	}
+
+	if loc.Host != "" {
+		// Absolute redirect: only rewrite ones aimed at the service itself
+		if loc.Port() != target.Port() || (!isLoopbackHost(loc.Hostname()) && loc.Hostname() != target.Hostname()) {
+			return
+		}
+		loc.Scheme = ""
+		loc.Host = ""
+		if prefix == "" {
+			loc.Host = publicHost
+			loc.Scheme = publicScheme
+		}
+	}
+
+	if prefix != "" && strings.HasPrefix(loc.Path, "/") && !strings.HasPrefix(loc.Path, prefix+"/") {
+		loc.Path = prefix + loc.Path
+		loc.RawPath = ""
+	}
+
+	resp.Header.Set("Location", loc.String())
+}
+
+// rewriteCookies scopes Set-Cookie paths to the proxy prefix so services don't
+// clobber each other's (or the dashboard's) cookies
+func rewriteCookies(resp *http.Response, prefix string) {
+	if prefix == "" {
+		return
+	}
+
+	cookies := resp.Header.Values("Set-Cookie")
+	if len(cookies) == 0 {
+		return
+	}
+
+	resp.Header.Del("Set-Cookie")
+	for _, raw := range cookies {
+		parts := strings.Split(raw, ";")
+		hasPath := false
+		for i, part := range parts {
+			name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+			if !strings.EqualFold(name, "path") {
+				continue
+			}
+			hasPath = true
+			if strings.HasPrefix(value, "/") && !strings.HasPrefix(value, prefix+"/") {
+				parts[i] = " Path=" + prefix + value
+			}
+		}
+		if !hasPath {
+			parts = append(parts, " Path="+prefix+"/")
+		}
+		resp.Header.Add("Set-Cookie", strings.Join(parts, ";"))
+	}
+}
+
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"dev-machine-proxy/internal/discovery"
+)
+
+func TestTargetURL(t *testing.T) {
+	tests := []struct {
+		name string
+		svc  discovery.Service
+		want string
+	}{
+		{"unknown binds", discovery.Service{Port: 3000}, "http://127.0.0.1:3000"},
+		{"all ipv4", discovery.Service{Port: 3000, BindAddresses: []string{"0.0.0.0"}}, "http://127.0.0.1:3000"},
+		{"ipv4 loopback", discovery.Service{Port: 3000, BindAddresses: []string{"127.0.0.1"}}, "http://127.0.0.1:3000"},
+		{"other loopback", discovery.Service{Port: 3000, BindAddresses: []string{"127.0.0.2"}}, "http://127.0.0.2:3000"},
+		{"ipv6 loopback only", discovery.Service{Port: 5173, BindAddresses: []string{"::1"}}, "http://[::1]:5173"},
+		{"all ipv6", discovery.Service{Port: 8080, BindAddresses: []string{"::"}}, "http://[::1]:8080"},
+		{"ipv6 and ipv4", discovery.Service{Port: 8080, BindAddresses: []string{"::1", "127.0.0.1"}}, "http://127.0.0.1:8080"},
+		{"one interface", discovery.Service{Port: 8000, BindAddresses: []string{"192.168.1.20"}}, "http://192.168.1.20:8000"},
+		{"interface and loopback", discovery.Service{Port: 8000, BindAddresses: []string{"10.0.0.5", "::1"}}, "http://[::1]:8000"},
+		{"https", discovery.Service{Port: 8443, URL: "https://localhost:8443", BindAddresses: []string{"0.0.0.0"}}, "https://127.0.0.1:8443"},
+		{
+			"internal container port",
+			discovery.Service{Port: 80, URL: "http://172.18.0.3:80", Exposure: discovery.ExposureInternal},
+			"http://172.18.0.3:80",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TargetURL(tt.svc).String(); got != tt.want {
+				t.Errorf("TargetURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsBaseHost(t *testing.T) {
+	h := &Handler{}
+	h.SetBaseHosts([]string{"localhost", " devbox.tailnet.ts.net ", ""})
+
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"localhost", true},
+		{"LOCALHOST", true},
+		{"devbox.tailnet.ts.net", true},
+		{"devbox.tailnet.ts.net.", true},
+		{"tailnet.ts.net", false},
+		{"evil.example", false},
+		{"localhost.evil.example", false},
+		{"127.0.0.1", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			if got := h.IsBaseHost(tt.host); got != tt.want {
+				t.Errorf("IsBaseHost(%q) = %v, want %v", tt.host, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServeSubdomainIgnoresForeignHosts(t *testing.T) {
+	h := &Handler{}
+	h.SetBaseHosts([]string{"localhost"})
+
+	// None of these may reach service lookup, which needs a discoverer
+	for _, host := range []string{"localhost:9999", "10.0.0.5:9999", "web.evil.example", "web.localhost.evil.example:9999", "web.other:9999"} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Host = host
+		if h.ServeSubdomain(httptest.NewRecorder(), r) {
+			t.Errorf("ServeSubdomain(%q) = true, want false", host)
+		}
+	}
+}
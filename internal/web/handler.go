@@ -1,18 +1,30 @@
 package web
 
 import (
+	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
 	"net"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
 	"dev-machine-proxy/internal/config"
 	"dev-machine-proxy/internal/discovery"
+	"dev-machine-proxy/internal/health"
 	"dev-machine-proxy/internal/projects"
+	"dev-machine-proxy/internal/proxy"
 	"dev-machine-proxy/internal/system"
 	"dev-machine-proxy/internal/terminal"
 	"dev-machine-proxy/internal/usage"
+
+	"github.com/gorilla/websocket"
 )
 
 // Handler serves the web dashboard
@@ -21,27 +33,48 @@ type Handler struct {
 	configMgr      *config.Manager
 	sysMonitor     *system.Monitor
 	usageMonitor   *usage.Monitor
+	healthMonitor  *health.Monitor
 	termHandler    *terminal.Handler
+	proxyHandler   *proxy.Handler
+	projectFinder  *projects.Finder
 	projectScanner *projects.Scanner
 	mux            *http.ServeMux
+	pathProxy      bool // Whether services are also proxied under /svc/ (see EnablePathProxy)
 }
 
 // NewHandler creates a new web handler
-func NewHandler(d *discovery.Discoverer, cfg *config.Manager, mon *system.Monitor, usageMon *usage.Monitor, projectsDir string) *Handler {
+func NewHandler(d *discovery.Discoverer, cfg *config.Manager, mon *system.Monitor, usageMon *usage.Monitor, healthMon *health.Monitor, projectFinder *projects.Finder) *Handler {
 	h := &Handler{
 		discoverer:     d,
 		configMgr:      cfg,
 		sysMonitor:     mon,
 		usageMonitor:   usageMon,
+		healthMonitor:  healthMon,
 		termHandler:    terminal.NewHandler(),
-		projectScanner: projects.NewScanner(projectsDir),
+		proxyHandler:   proxy.NewHandler(d),
+		projectFinder:  projectFinder,
+		projectScanner: projects.NewScanner(projectFinder),
 		mux:            http.NewServeMux(),
 	}
 
 	h.mux.HandleFunc("/", h.handleIndex)
 	h.mux.HandleFunc("/config", h.handleConfigPage)
 	h.mux.HandleFunc("/favicon.ico", h.handleFavicon)
+	h.mux.HandleFunc("/metrics", h.handleMetrics)
 	h.mux.HandleFunc("/api/services", h.handleAPIServices)
+	h.mux.HandleFunc("/api/services/", h.handleAPIService)
+	h.mux.HandleFunc("/api/services/history", h.handleAPIServiceHistory)
+	h.mux.HandleFunc("/api/action-token", h.handleAPIActionToken)
+	h.mux.HandleFunc("/api/discover", h.handleAPIDiscover)
+	h.mux.HandleFunc("/api/discover/status", h.handleAPIDiscoverStatus)
+	h.mux.HandleFunc("/api/health-checks", h.handleAPIHealthChecks)
+	h.mux.HandleFunc("/api/events", h.handleAPIEvents)
+	h.mux.HandleFunc("/api/stacks", h.handleAPIStacks)
+	h.mux.HandleFunc("/api/stacks/", h.handleAPIStackAction)
+	h.mux.HandleFunc("/api/containers/", h.handleAPIContainerAction)
+	h.mux.HandleFunc("/api/overrides", h.handleAPIOverrides)
+	h.mux.HandleFunc("/api/rules", h.handleAPIRules)
+	h.mux.HandleFunc("/api/rules/test", h.handleAPIRuleTest)
 	h.mux.HandleFunc("/api/config", h.handleAPIConfig)
 	h.mux.HandleFunc("/api/themes", h.handleAPIThemes)
 	h.mux.HandleFunc("/api/stats", h.handleAPIStats)
@@ -50,26 +83,901 @@ func NewHandler(d *discovery.Discoverer, cfg *config.Manager, mon *system.Monito
 	h.mux.HandleFunc("/api/daily-tasks", h.handleAPIDailyTasks)
 	h.mux.HandleFunc("/api/daily-tasks/toggle", h.handleAPIDailyTaskToggle)
 	h.mux.HandleFunc("/ws/terminal", h.termHandler.ServeWS)
+	h.mux.HandleFunc("/ws/logs", h.handleWSLogs)
 
 	return h
 }
 
+// SetProxyHosts sets the hosts the dashboard is reached at whose subdomains
+// are proxied to services, replacing proxy.DefaultBaseHosts
+func (h *Handler) SetProxyHosts(hosts []string) {
+	h.proxyHandler.SetBaseHosts(hosts)
+}
+
+// EnablePathProxy also serves discovered services under /svc/<name>/. Those
+// apps then share the dashboard's origin, so they can call its API as the
+// user, which is why it is off unless asked for.
+func (h *Handler) EnablePathProxy() {
+	h.pathProxy = true
+	h.mux.Handle(proxy.PathPrefix, h.proxyHandler)
+}
+
 // ServeHTTP implements http.Handler
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// <service>.<dashboard-host> requests go straight to the service
+	if h.proxyHandler.ServeSubdomain(w, r) {
+		return
+	}
 	h.mux.ServeHTTP(w, r)
 }
 
 // handleAPIServices returns services as JSON
 func (h *Handler) handleAPIServices(w http.ResponseWriter, r *http.Request) {
 	services := h.discoverer.GetServices()
-	services = adjustServiceURLs(services, r)
+	services = h.adjustServiceURLs(services, r)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(services)
 }
 
-// handleAPIConfig handles GET and POST for config
+// handleAPIServiceHistory returns when each service was seen listening,
+// most recent first. Query parameters: port, and since/until as RFC 3339
+// times or durations before now (e.g. since=24h).
+func (h *Handler) handleAPIServiceHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	var q discovery.HistoryQuery
+	if port := query.Get("port"); port != "" {
+		n, err := strconv.Atoi(port)
+		if err != nil || n < 1 || n > 65535 {
+			http.Error(w, "port must be a number from 1 to 65535", http.StatusBadRequest)
+			return
+		}
+		q.Port = n
+	}
+	var err error
+	if q.Since, err = parseHistoryTime(query.Get("since")); err != nil {
+		http.Error(w, "since: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if q.Until, err = parseHistoryTime(query.Get("until")); err != nil {
+		http.Error(w, "until: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.discoverer.History(q))
+}
+
+// parseHistoryTime reads an RFC 3339 time, or a duration meaning that long
+// ago. An empty value is the zero time (unbounded).
+func parseHistoryTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, errors.New("expected an RFC 3339 time or a duration such as 24h")
+	}
+	return t, nil
+}
+
+// maxDiscoverTimeout caps the timeout a client can ask a discovery run for
+const maxDiscoverTimeout = 2 * time.Minute
+
+// DiscoverStatus is the state of discovery runs as served by the API
+type DiscoverStatus struct {
+	Running        bool              `json:"running"`
+	StartedAt      *time.Time        `json:"startedAt,omitempty"` // Of the run in progress
+	Runs           uint64            `json:"runs"`
+	LastRun        *time.Time        `json:"lastRun,omitempty"`
+	LastDurationMs float64           `json:"lastDurationMs"`
+	LastError      string            `json:"lastError,omitempty"`
+	Steps          []DiscoverStep    `json:"steps"` // Of the last completed run
+	Errors         map[string]uint64 `json:"errors"`
+}
+
+// DiscoverStep is how long one step of the last run took
+type DiscoverStep struct {
+	Step       string  `json:"step"`
+	DurationMs float64 `json:"durationMs"`
+}
+
+func (h *Handler) discoverStatus() DiscoverStatus {
+	stats := h.discoverer.Stats()
+	status := DiscoverStatus{
+		Running:        stats.Running,
+		Runs:           stats.Runs,
+		LastDurationMs: durationMs(stats.LastDuration),
+		LastError:      stats.LastError,
+		Steps:          make([]DiscoverStep, len(stats.Steps)),
+		Errors:         stats.Errors,
+	}
+	if stats.Running {
+		status.StartedAt = &stats.Started
+	}
+	if !stats.LastRun.IsZero() {
+		status.LastRun = &stats.LastRun
+	}
+	for i, step := range stats.Steps {
+		status.Steps[i] = DiscoverStep{Step: step.Step, DurationMs: durationMs(step.Duration)}
+	}
+	return status
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// handleAPIDiscover runs discovery now. POST starts a run, or joins the one
+// in progress, and answers when it is over with the number of services, any
+// error and the run status; with wait=false it answers 202 straight away and
+// the run can be followed at /api/discover/status.
+// timeout (a duration, default 20s) bounds the run. Project roots are walked
+// again rather than taken from the cache. DELETE cancels the run in progress.
+// Both need the action token and a JSON content type, so other sites can't
+// make the machine rescan or cancel runs.
+func (h *Handler) handleAPIDiscover(w http.ResponseWriter, r *http.Request) {
+	if (r.Method == http.MethodPost || r.Method == http.MethodDelete) && !(requireJSON(w, r) && h.authorizeAction(w, r)) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+	case http.MethodDelete:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]bool{"cancelled": h.discoverer.CancelDiscover()})
+		return
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	timeout := discovery.DefaultDiscoverTimeout
+	if value := query.Get("timeout"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 || d > maxDiscoverTimeout {
+			http.Error(w, "timeout must be a duration up to "+maxDiscoverTimeout.String(), http.StatusBadRequest)
+			return
+		}
+		timeout = d
+	}
+
+	h.projectFinder.Invalidate()
+
+	// The run outlives the request, so other callers sharing it aren't cut
+	// short when this client goes away
+	done := make(chan struct{})
+	var services []discovery.Service
+	var err error
+	go func() {
+		defer close(done)
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		services, err = h.discoverer.Discover(ctx)
+		if err != nil {
+			log.Printf("Warning: requested discovery had errors: %v", err)
+		}
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	if query.Get("wait") == "false" {
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]bool{"accepted": true})
+		return
+	}
+
+	select {
+	case <-done:
+	case <-r.Context().Done():
+		return
+	}
+	result := map[string]any{
+		"services": len(services),
+		"status":   h.discoverStatus(),
+	}
+	if err != nil {
+		result["error"] = err.Error()
+	}
+	json.NewEncoder(w).Encode(result)
+}
+
+// handleAPIDiscoverStatus returns whether discovery is running and how the
+// last run went
+func (h *Handler) handleAPIDiscoverStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.discoverStatus())
+}
+
+// handleAPIStacks returns Docker Compose projects with their aggregated state
+func (h *Handler) handleAPIStacks(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	stacks, err := h.discoverer.Stacks(ctx)
+	if err != nil && len(stacks) == 0 {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	all := h.discoverer.GetServices()
+	for i := range stacks {
+		for j, svc := range stacks[i].Services {
+			stacks[i].Services[j] = h.adjustServiceURL(svc, all, r)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stacks)
+}
+
+// handleAPIContainerAction handles POST /api/containers/<id>/<action>, where
+// action is start, stop, restart, pause, unpause or remove
+func (h *Handler) handleAPIContainerAction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.authorizeAction(w, r) {
+		return
+	}
+
+	id, action, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/containers/"), "/")
+	if !ok || id == "" || action == "" {
+		http.Error(w, "Expected /api/containers/<id>/<action>", http.StatusNotFound)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Minute)
+	defer cancel()
+
+	if err := h.discoverer.ContainerAction(ctx, id, action); err != nil {
+		status := http.StatusBadGateway
+		if errors.Is(err, discovery.ErrUnknownContainer) {
+			status = http.StatusNotFound
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// handleAPIStackAction handles POST /api/stacks/<project>/<action>[?host=],
+// where action is up, down or restart. Compose output is streamed back as
+// newline-delimited JSON: {"line": ...} per line, then {"done": true, "error": ...}.
+func (h *Handler) handleAPIStackAction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.authorizeAction(w, r) {
+		return
+	}
+
+	project, action, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/stacks/"), "/")
+	if !ok || project == "" || action == "" {
+		http.Error(w, "Expected /api/stacks/<project>/<action>", http.StatusNotFound)
+		return
+	}
+
+	// Pulling images for `up` can take a while
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Minute)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("X-Accel-Buffering", "no")
+	out := &ndjsonLineWriter{w: w}
+	flusher, _ := w.(http.Flusher)
+	out.flusher = flusher
+
+	err := h.discoverer.ComposeAction(ctx, r.URL.Query().Get("host"), project, action, out)
+
+	result := map[string]any{"done": true}
+	if err != nil {
+		result["error"] = err.Error()
+	}
+	json.NewEncoder(w).Encode(result)
+}
+
+// ndjsonLineWriter wraps each written line as {"line": ...} and flushes it
+type ndjsonLineWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+func (n *ndjsonLineWriter) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		if err := json.NewEncoder(n.w).Encode(map[string]string{"line": line}); err != nil {
+			return 0, err
+		}
+	}
+	if n.flusher != nil {
+		n.flusher.Flush()
+	}
+	return len(p), nil
+}
+
+// actionTokenCookie holds the action token for the dashboard. It is HttpOnly
+// so page scripts (including proxied apps) can't read it.
+const actionTokenCookie = "action_token"
+
+// actionTokenMaxAge is how long a browser keeps the action token cookie
+const actionTokenMaxAge = 30 * 24 * time.Hour
+
+// authorizeAction checks the token of a state-changing request, from the
+// X-Action-Token header (scripts) or the dashboard's cookie, writing a 401
+// that says where to find the token if it's wrong
+func (h *Handler) authorizeAction(w http.ResponseWriter, r *http.Request) bool {
+	token, err := h.configMgr.ActionToken()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+
+	given := r.Header.Get("X-Action-Token")
+	if given == "" && sameOrigin(r) {
+		if cookie, err := r.Cookie(actionTokenCookie); err == nil {
+			given = cookie.Value
+		}
+	}
+
+	if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+		http.Error(w, fmt.Sprintf("Action token required; it is stored in %s", h.configMgr.ActionTokenPath()), http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// sameOrigin reports whether a request comes from a page on the dashboard's
+// own origin. Browsers send Origin with every POST, PUT and DELETE, so this
+// keeps sibling origins such as <service>.<host> from using the cookie even
+// where SameSite counts them as the same site.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		site := r.Header.Get("Sec-Fetch-Site")
+		return site == "" || site == "same-origin"
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// handleAPIActionToken checks a token typed into the dashboard and stores it
+// in an HttpOnly, SameSite=Strict cookie (POST {"token": "..."}), forgets it
+// (DELETE), or says whether the browser has it (GET: 204 or 401)
+func (h *Handler) handleAPIActionToken(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		if h.authorizeAction(w, r) {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	case http.MethodPost:
+		if !requireJSON(w, r) {
+			return
+		}
+		var req struct {
+			Token string `json:"token"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		r.Header.Set("X-Action-Token", strings.TrimSpace(req.Token))
+		if !h.authorizeAction(w, r) {
+			return
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     actionTokenCookie,
+			Value:    strings.TrimSpace(req.Token),
+			Path:     "/",
+			MaxAge:   int(actionTokenMaxAge / time.Second),
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteStrictMode,
+		})
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		http.SetCookie(w, &http.Cookie{
+			Name:     actionTokenCookie,
+			Path:     "/",
+			MaxAge:   -1,
+			HttpOnly: true,
+			SameSite: http.SameSiteStrictMode,
+		})
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// requireJSON rejects a state-changing request whose body isn't declared as
+// JSON. Browsers only send that content type cross-site after a CORS
+// preflight, which this server never grants, so other sites can't forge the
+// request with a form.
+func requireJSON(w http.ResponseWriter, r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/json" {
+		http.Error(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+		return false
+	}
+	return true
+}
+
+// logsUpgrader accepts log viewer WebSockets from the dashboard's own origin
+// only. Browsers don't apply CORS to WebSockets, so without the check any
+// page could read logs with the user's cookie.
+var logsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	CheckOrigin:     sameOrigin,
+}
+
+// logPauseBuffer is how many lines a paused log view keeps for when it resumes
+const logPauseBuffer = 1000
+
+// logMessage is sent to log viewers: a log line, or a status message
+type logMessage struct {
+	Type string `json:"type"` // line, info, error, end
+	*discovery.LogLine
+	Message string `json:"message,omitempty"`
+}
+
+// handleWSLogs streams container logs over a WebSocket. Query parameters:
+// container (repeatable) or stack (plus host when several runtimes have it)
+// select the containers; since and tail select the range. Clients can send
+// {"filter": "text"} and {"paused": true|false} to control the stream.
+// Logs often hold secrets, so viewers need the action token.
+func (h *Handler) handleWSLogs(w http.ResponseWriter, r *http.Request) {
+	if !sameOrigin(r) {
+		http.Error(w, "Cross-origin log viewers are not allowed", http.StatusForbidden)
+		return
+	}
+	if !h.authorizeAction(w, r) {
+		return
+	}
+
+	query := r.URL.Query()
+	containers := query["container"]
+
+	conn, err := logsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("WebSocket upgrade error: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	if stack := query.Get("stack"); stack != "" {
+		names, err := h.discoverer.StackContainers(ctx, query.Get("host"), stack)
+		if err != nil {
+			conn.WriteJSON(logMessage{Type: "error", Message: err.Error()})
+			return
+		}
+		containers = append(containers, names...)
+	}
+	if len(containers) == 0 {
+		conn.WriteJSON(logMessage{Type: "error", Message: "no container or stack given"})
+		return
+	}
+
+	tail := query.Get("tail")
+	if tail == "" {
+		tail = "200"
+	}
+	opts := discovery.LogOptions{Since: query.Get("since"), Tail: tail}
+
+	lines := make(chan discovery.LogLine, 256)
+	streamDone := make(chan error, 1)
+	go func() {
+		streamDone <- h.discoverer.StreamLogs(ctx, containers, opts, lines)
+	}()
+
+	// Control messages from the browser; a read error means it went away
+	type control struct {
+		Filter *string `json:"filter"`
+		Paused *bool   `json:"paused"`
+	}
+	controls := make(chan control)
+	go func() {
+		defer cancel()
+		for {
+			var c control
+			if err := conn.ReadJSON(&c); err != nil {
+				return
+			}
+			select {
+			case controls <- c:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var filter string
+	var paused bool
+	var held []discovery.LogLine
+	dropped := 0
+	var finished bool
+	var finishErr error
+
+	send := func(line discovery.LogLine) error {
+		if filter != "" && !strings.Contains(strings.ToLower(line.Text), filter) && !strings.Contains(strings.ToLower(line.Container), filter) {
+			return nil
+		}
+		return conn.WriteJSON(logMessage{Type: "line", LogLine: &line})
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case c := <-controls:
+			if c.Filter != nil {
+				filter = strings.ToLower(*c.Filter)
+			}
+			if c.Paused != nil && paused != *c.Paused {
+				paused = *c.Paused
+				if !paused {
+					for _, line := range held {
+						if send(line) != nil {
+							return
+						}
+					}
+					if dropped > 0 {
+						conn.WriteJSON(logMessage{Type: "info", Message: fmt.Sprintf("%d lines dropped while paused", dropped)})
+					}
+					held, dropped = nil, 0
+				}
+			}
+
+		case line := <-lines:
+			if paused {
+				if len(held) >= logPauseBuffer {
+					held = held[1:]
+					dropped++
+				}
+				held = append(held, line)
+				continue
+			}
+			if send(line) != nil {
+				return
+			}
+
+		case err := <-streamDone:
+			finished, finishErr = true, err
+			streamDone = nil // Keep serving controls until the browser closes
+		}
+
+		// Report the end once every queued line has been delivered
+		if finished && len(lines) == 0 {
+			if finishErr != nil {
+				conn.WriteJSON(logMessage{Type: "error", Message: finishErr.Error()})
+			} else {
+				conn.WriteJSON(logMessage{Type: "end", Message: "log stream ended"})
+			}
+			finished = false
+		}
+	}
+}
+
+// handleAPIEvents streams service changes as Server-Sent Events
+func (h *Handler) handleAPIEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	events, unsubscribe := h.discoverer.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // Disable buffering in nginx-style proxies
+	fmt.Fprint(w, "retry: 5000\n\n")
+	flusher.Flush()
+
+	// Comment lines keep idle connections from being closed by proxies
+	heartbeat := time.NewTicker(30 * time.Second)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			// URLs are rewritten for the requesting host, same as /api/services.
+			// The event is shared between subscribers, so rewrite a copy.
+			all := h.discoverer.GetServices()
+			changes := make([]discovery.ServiceChange, len(event.Changes))
+			for i, change := range event.Changes {
+				change.Service = h.adjustServiceURL(change.Service, all, r)
+				changes[i] = change
+			}
+			event.Changes = changes
+
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: services\ndata: %s\n\n", data)
+			flusher.Flush()
+
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+// handleAPIOverrides handles GET, POST, PUT and DELETE for per-service
+// overrides. Changes need the action token and a JSON body, and apply to the
+// service list immediately.
+func (h *Handler) handleAPIOverrides(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && !(requireJSON(w, r) && h.authorizeAction(w, r)) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case http.MethodGet:
+		json.NewEncoder(w).Encode(h.discoverer.Overrides())
+
+	case http.MethodPost:
+		var o discovery.Override
+		if err := json.NewDecoder(r.Body).Decode(&o); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		saved, err := h.discoverer.AddOverride(o)
+		if err != nil {
+			http.Error(w, err.Error(), overrideErrorStatus(err))
+			return
+		}
+		json.NewEncoder(w).Encode(saved)
+
+	case http.MethodPut:
+		var o discovery.Override
+		if err := json.NewDecoder(r.Body).Decode(&o); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := h.discoverer.UpdateOverride(o); err != nil {
+			http.Error(w, err.Error(), overrideErrorStatus(err))
+			return
+		}
+		json.NewEncoder(w).Encode(o)
+
+	case http.MethodDelete:
+		var req struct {
+			ID string `json:"id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := h.discoverer.DeleteOverride(req.ID); err != nil {
+			http.Error(w, err.Error(), overrideErrorStatus(err))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func overrideErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, discovery.ErrInvalidOverride):
+		return http.StatusBadRequest
+	case errors.Is(err, discovery.ErrUnknownOverride):
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// handleAPIService serves per-service resources: GET
+// /api/services/<id>/health and /api/services/<id>/icon
+func (h *Handler) handleAPIService(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, resource, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/services/"), "/")
+	switch {
+	case ok && id != "" && resource == "health":
+		h.serveServiceHealth(w, id)
+	case ok && id != "" && resource == "icon":
+		h.serveServiceIcon(w, r, id)
+	default:
+		http.Error(w, "Expected /api/services/<id>/health or /api/services/<id>/icon", http.StatusNotFound)
+	}
+}
+
+// serveServiceHealth returns a service's health checks with their uptime,
+// transitions and latency
+func (h *Handler) serveServiceHealth(w http.ResponseWriter, id string) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"service": id,
+		"checks":  h.healthMonitor.ServiceHealth(id),
+	})
+}
+
+// serveServiceIcon serves the icon cached for a service. Icons come from the
+// services themselves, so SVGs are locked down to keep their scripts from
+// running on the dashboard's origin.
+func (h *Handler) serveServiceIcon(w http.ResponseWriter, r *http.Request, id string) {
+	icon, err := h.discoverer.ServiceIcon(id)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, discovery.ErrNoIcon) {
+			status = http.StatusNotFound
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", icon.ContentType)
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; sandbox")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if r.URL.Query().Get("v") == icon.Hash {
+		w.Header().Set("Cache-Control", "public, max-age=86400") // The URL changes with the icon
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	w.Write(icon.Data)
+}
+
+// handleAPIHealthChecks manages health checks. GET lists every check with
+// its current state. Adding, changing or deleting checks needs a JSON body
+// and the action token; command checks run on this machine.
+func (h *Handler) handleAPIHealthChecks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && !(requireJSON(w, r) && h.authorizeAction(w, r)) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case http.MethodGet:
+		json.NewEncoder(w).Encode(h.healthMonitor.Statuses())
+
+	case http.MethodPost, http.MethodPut:
+		var c health.Check
+		if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var saved health.Check
+		var err error
+		if r.Method == http.MethodPost {
+			saved, err = h.healthMonitor.AddCheck(c)
+		} else {
+			saved, err = h.healthMonitor.UpdateCheck(c)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), healthCheckErrorStatus(err))
+			return
+		}
+		json.NewEncoder(w).Encode(saved)
+
+	case http.MethodDelete:
+		var req struct {
+			ID string `json:"id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := h.healthMonitor.DeleteCheck(req.ID); err != nil {
+			http.Error(w, err.Error(), healthCheckErrorStatus(err))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func healthCheckErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, health.ErrInvalidCheck):
+		return http.StatusBadRequest
+	case errors.Is(err, health.ErrUnknownCheck):
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// handleAPIRules returns the fingerprint rules: the user's rules file, any
+// error loading it, and the built-in defaults that follow it
+func (h *Handler) handleAPIRules(w http.ResponseWriter, r *http.Request) {
+	rules := h.discoverer.Rules()
+	rules.Reload()
+	user, err := rules.UserRules()
+
+	resp := map[string]any{
+		"path":     rules.Path(),
+		"rules":    user,
+		"defaults": discovery.DefaultRules(),
+	}
+	if err != nil {
+		resp["error"] = err.Error()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handleAPIRuleTest handles POST /api/rules/test with {"rule": {...}, "port": N},
+// reporting whether the rule matches what listens on the port and why
+func (h *Handler) handleAPIRuleTest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Rule discovery.Rule `json:"rule"`
+		Port int            `json:"port"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	result, err := h.discoverer.TestRule(ctx, req.Rule, req.Port)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, discovery.ErrInvalidRule):
+			status = http.StatusBadRequest
+		case errors.Is(err, discovery.ErrNotListening):
+			status = http.StatusNotFound
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// handleAPIConfig handles GET and POST for config. Saving needs a JSON body
+// and the action token, as the config includes HTML injected into every page.
 func (h *Handler) handleAPIConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && !(requireJSON(w, r) && h.authorizeAction(w, r)) {
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
 
 	switch r.Method {
@@ -261,25 +1169,56 @@ func todayString() string {
 	return config.TodayString()
 }
 
-func adjustServiceURLs(services []discovery.Service, r *http.Request) []discovery.Service {
+func (h *Handler) adjustServiceURLs(services []discovery.Service, r *http.Request) []discovery.Service {
+	adjusted := make([]discovery.Service, len(services))
+	for i, svc := range services {
+		adjusted[i] = h.adjustServiceURL(svc, services, r)
+	}
+	return adjusted
+}
+
+// adjustServiceURL fills in the request-dependent fields of a service. all is
+// the full service list, used to disambiguate proxy keys.
+func (h *Handler) adjustServiceURL(svc discovery.Service, all []discovery.Service, r *http.Request) discovery.Service {
 	host := requestHostname(r)
 	if host == "" {
-		return services
+		return svc
 	}
 
-	adjusted := make([]discovery.Service, len(services))
-	copy(adjusted, services)
-
-	for i := range adjusted {
-		if adjusted[i].URL == "" {
-			continue
-		}
-		if updated, ok := replaceLocalhostURL(adjusted[i].URL, host); ok {
-			adjusted[i].URL = updated
+	svc.Reachable = discovery.ReachableFrom(svc.BindAddresses, requestLocalIP(r))
+	if svc.IsHTTP {
+		svc.ProxyURL = h.proxyURL(svc, all, r)
+	}
+	if svc.URL != "" {
+		if updated, ok := replaceLocalhostURL(svc.URL, host); ok {
+			svc.URL = updated
 		}
 	}
 
-	return adjusted
+	return svc
+}
+
+// proxyURL is where the dashboard proxies a service: /svc/<name>/ when path
+// proxying is enabled, otherwise <name>.<host> when the dashboard was reached
+// at one of its proxy hosts (IP addresses have no subdomains)
+func (h *Handler) proxyURL(svc discovery.Service, all []discovery.Service, r *http.Request) string {
+	var path string
+	if u, err := url.Parse(svc.URL); err == nil {
+		path = strings.TrimPrefix(u.Path, "/") // Keep a rule's URL path
+	}
+
+	key := proxy.Key(svc, all)
+	if h.pathProxy {
+		return proxy.PathPrefix + key + "/" + path
+	}
+	if !h.proxyHandler.IsBaseHost(requestHostname(r)) {
+		return ""
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + key + "." + r.Host + "/" + path
 }
 
 func requestHostname(r *http.Request) string {
@@ -296,6 +1235,25 @@ func requestHostname(r *http.Request) string {
 	return r.Host
 }
 
+// requestLocalIP returns the local address the request's connection arrived on
+func requestLocalIP(r *http.Request) net.IP {
+	addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	if !ok {
+		return nil
+	}
+
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return nil
+	}
+
+	// Normalise IPv4-mapped IPv6 (::ffff:a.b.c.d) so it compares as IPv4
+	if v4 := tcpAddr.IP.To4(); v4 != nil {
+		return v4
+	}
+	return tcpAddr.IP
+}
+
 func replaceLocalhostURL(rawURL, host string) (string, bool) {
 	parsed, err := url.Parse(rawURL)
 	if err != nil || parsed.Host == "" {
@@ -0,0 +1,218 @@
+package web
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"dev-machine-proxy/internal/config"
+	"dev-machine-proxy/internal/discovery"
+	"dev-machine-proxy/internal/proxy"
+)
+
+func TestSameOrigin(t *testing.T) {
+	tests := []struct {
+		name      string
+		host      string
+		origin    string
+		fetchSite string
+		want      bool
+	}{
+		{"no headers", "localhost:9999", "", "", true},
+		{"same origin", "localhost:9999", "http://localhost:9999", "same-origin", true},
+		{"host case", "LocalHost:9999", "http://localhost:9999", "", true},
+		{"other port", "localhost:9999", "http://localhost:5173", "same-site", false},
+		{"service subdomain", "localhost:9999", "http://web.localhost:9999", "same-site", false},
+		{"other site", "devbox:9999", "https://evil.example", "cross-site", false},
+		{"no origin, cross site", "localhost:9999", "", "cross-site", false},
+		{"opaque origin", "localhost:9999", "null", "cross-site", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "http://"+tt.host+"/api/containers/web/stop", nil)
+			r.Host = tt.host
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if tt.fetchSite != "" {
+				r.Header.Set("Sec-Fetch-Site", tt.fetchSite)
+			}
+			if got := sameOrigin(r); got != tt.want {
+				t.Errorf("sameOrigin() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProxyURL(t *testing.T) {
+	svc := discovery.Service{Name: "Web App", Port: 5173, Protocol: "tcp", URL: "http://localhost:5173/shop", IsHTTP: true}
+	all := []discovery.Service{svc}
+
+	tests := []struct {
+		name      string
+		pathProxy bool
+		host      string
+		tls       bool
+		want      string
+	}{
+		{"subdomain", false, "localhost:9999", false, "http://web-app.localhost:9999/shop"},
+		{"subdomain over tls", false, "devbox.vpn", true, "https://web-app.devbox.vpn/shop"},
+		{"ip address", false, "10.0.0.5:9999", false, ""},
+		{"ipv6 address", false, "[::1]:9999", false, ""},
+		{"unknown host", false, "other.example:9999", false, ""},
+		{"path", true, "10.0.0.5:9999", false, "/svc/web-app/shop"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Handler{proxyHandler: proxy.NewHandler(nil), pathProxy: tt.pathProxy}
+			h.SetProxyHosts([]string{"localhost", "devbox.vpn"})
+			r := httptest.NewRequest("GET", "/api/services", nil)
+			r.Host = tt.host
+			if tt.tls {
+				r.TLS = &tls.ConnectionState{}
+			}
+			if got := h.proxyURL(svc, all, r); got != tt.want {
+				t.Errorf("proxyURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleWSLogsRefusals(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	h := &Handler{configMgr: config.NewManager()}
+	token, err := h.configMgr.ActionToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		origin string
+		header string
+		cookie string
+		want   int
+	}{
+		{"no token", "http://localhost:9999", "", "", http.StatusUnauthorized},
+		{"wrong token", "", "nope", "", http.StatusUnauthorized},
+		{"foreign origin with cookie", "http://evil.example", "", token, http.StatusForbidden},
+		{"service subdomain with cookie", "http://web.localhost:9999", "", token, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/ws/logs?container=web", nil)
+			r.Host = "localhost:9999"
+			r.Header.Set("Connection", "Upgrade")
+			r.Header.Set("Upgrade", "websocket")
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if tt.header != "" {
+				r.Header.Set("X-Action-Token", tt.header)
+			}
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: actionTokenCookie, Value: tt.cookie})
+			}
+			w := httptest.NewRecorder()
+			h.handleWSLogs(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleAPIConfigSave(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	h := &Handler{configMgr: config.NewManager()}
+	token, err := h.configMgr.ActionToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := h.configMgr.Get()
+	cfg.CustomHeadHTML = "<script>alert(1)</script>"
+	body, _ := json.Marshal(cfg)
+
+	tests := []struct {
+		name        string
+		contentType string
+		header      string
+		cookie      string
+		origin      string
+		want        int
+	}{
+		{"form post", "application/x-www-form-urlencoded", token, "", "", http.StatusUnsupportedMediaType},
+		{"no token", "application/json", "", "", "", http.StatusUnauthorized},
+		{"cookie from a foreign origin", "application/json", "", token, "http://evil.example", http.StatusUnauthorized},
+		{"token", "application/json", token, "", "", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/api/config", bytes.NewReader(body))
+			r.Host = "localhost:9999"
+			r.Header.Set("Content-Type", tt.contentType)
+			if tt.header != "" {
+				r.Header.Set("X-Action-Token", tt.header)
+			}
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: actionTokenCookie, Value: tt.cookie})
+			}
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			w := httptest.NewRecorder()
+			h.handleAPIConfig(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+			if saved := h.configMgr.Get().CustomHeadHTML == cfg.CustomHeadHTML; saved != (tt.want == http.StatusOK) {
+				t.Errorf("config saved = %v", saved)
+			}
+		})
+	}
+}
+
+func TestHandleAPIDiscoverRefusals(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	h := &Handler{configMgr: config.NewManager()}
+	token, err := h.configMgr.ActionToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		method, contentType, token string
+		want                       int
+	}{
+		{http.MethodPost, "", token, http.StatusUnsupportedMediaType},
+		{http.MethodPost, "text/plain", token, http.StatusUnsupportedMediaType},
+		{http.MethodPost, "application/json", "", http.StatusUnauthorized},
+		{http.MethodDelete, "", token, http.StatusUnsupportedMediaType},
+		{http.MethodDelete, "application/json", "nope", http.StatusUnauthorized},
+		{http.MethodGet, "", "", http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, "/api/discover", nil)
+		r.Host = "localhost:9999"
+		if tt.contentType != "" {
+			r.Header.Set("Content-Type", tt.contentType)
+		}
+		if tt.token != "" {
+			r.Header.Set("X-Action-Token", tt.token)
+		}
+		w := httptest.NewRecorder()
+		h.handleAPIDiscover(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%s with %q and token %q: status = %d, want %d", tt.method, tt.contentType, tt.token, w.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package web
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"dev-machine-proxy/internal/config"
+	"dev-machine-proxy/internal/discovery"
+	"dev-machine-proxy/internal/usage"
+)
+
+// metricsPrefix namespaces every exported metric
+const metricsPrefix = "devproxy_"
+
+// stoppedServiceWindow is how long a stopped service is still exported, with
+// up 0, after it was last seen
+const stoppedServiceWindow = 24 * time.Hour
+
+// metricsWriter collects samples and writes them in the Prometheus text
+// exposition format, each metric family's samples together under its HELP
+// and TYPE lines
+type metricsWriter struct {
+	families map[string]*metricFamily
+	order    []string
+}
+
+type metricFamily struct {
+	kind, help string
+	samples    []string
+}
+
+// label is one name="value" pair of a sample
+type label struct {
+	name, value string
+}
+
+func newMetricsWriter() *metricsWriter {
+	return &metricsWriter{families: make(map[string]*metricFamily)}
+}
+
+func (m *metricsWriter) sample(name, kind, help string, value float64, labels ...label) {
+	name = metricsPrefix + name
+	familyName := name
+	if kind == "summary" {
+		familyName = strings.TrimSuffix(strings.TrimSuffix(name, "_sum"), "_count")
+	}
+	family, ok := m.families[familyName]
+	if !ok {
+		family = &metricFamily{kind: kind, help: help}
+		m.families[familyName] = family
+		m.order = append(m.order, familyName)
+	}
+
+	line := name
+	if len(labels) > 0 {
+		pairs := make([]string, len(labels))
+		for i, l := range labels {
+			pairs[i] = l.name + `="` + escapeLabel(l.value) + `"`
+		}
+		line += "{" + strings.Join(pairs, ",") + "}"
+	}
+	family.samples = append(family.samples, line+" "+strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+func (m *metricsWriter) writeTo(w io.Writer) {
+	for _, name := range m.order {
+		family := m.families[name]
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, family.help, name, family.kind)
+		for _, line := range family.samples {
+			fmt.Fprintln(w, line)
+		}
+	}
+}
+
+func (m *metricsWriter) gauge(name, help string, value float64, labels ...label) {
+	m.sample(name, "gauge", help, value, labels...)
+}
+
+func (m *metricsWriter) counter(name, help string, value float64, labels ...label) {
+	m.sample(name, "counter", help, value, labels...)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// handleMetrics serves system stats, AI usage, discovered services, discovery
+// runs and daily tasks for Prometheus to scrape
+func (h *Handler) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	m := newMetricsWriter()
+	h.writeSystemMetrics(m)
+	h.writeUsageMetrics(m)
+	h.writeServiceMetrics(m)
+	h.writeDiscoveryMetrics(m)
+	h.writeDailyTaskMetrics(m)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.writeTo(w)
+}
+
+func (h *Handler) writeSystemMetrics(m *metricsWriter) {
+	stats := h.sysMonitor.GetCurrent()
+	if stats.Timestamp.IsZero() {
+		return // Not collected yet
+	}
+
+	m.gauge("cpu_usage_percent", "CPU usage of the machine.", stats.CPUPercent)
+	m.gauge("memory_total_bytes", "Total memory of the machine.", float64(stats.MemoryTotal))
+	m.gauge("memory_used_bytes", "Memory in use.", float64(stats.MemoryUsed))
+	m.gauge("memory_usage_percent", "Memory in use, as a percentage of the total.", stats.MemoryPercent)
+	for _, p := range stats.TopCPU {
+		m.gauge("top_cpu_process_percent", "CPU usage of the processes using the most CPU.", p.CPUPercent,
+			label{"pid", strconv.Itoa(p.PID)}, label{"name", p.Name})
+	}
+	for _, p := range stats.TopMemory {
+		m.gauge("top_memory_process_bytes", "Memory of the processes using the most memory.", p.MemoryMB*1024*1024,
+			label{"pid", strconv.Itoa(p.PID)}, label{"name", p.Name})
+	}
+}
+
+// usageWindow is one rate limit window of an AI tool
+type usageWindow struct {
+	tool, window string
+	status       usage.WindowStatus
+}
+
+func (h *Handler) writeUsageMetrics(m *metricsWriter) {
+	latest := h.usageMonitor.GetResponse().Latest
+	var windows []usageWindow
+	if latest.Claude != nil {
+		windows = append(windows,
+			usageWindow{"claude", "five_hour", latest.Claude.FiveHour},
+			usageWindow{"claude", "seven_day", latest.Claude.SevenDay})
+	}
+	if latest.Codex != nil {
+		windows = append(windows, usageWindow{"codex", "primary", latest.Codex.Primary})
+		if latest.Codex.Secondary != nil {
+			windows = append(windows, usageWindow{"codex", "secondary", *latest.Codex.Secondary})
+		}
+	}
+
+	for _, win := range windows {
+		labels := []label{{"tool", win.tool}, {"window", win.window}}
+		current, forecast := win.status.Current, win.status.Forecast
+		m.gauge("ai_usage_percent", "Share of the AI rate limit window used.", current.UsedPercent, labels...)
+		m.gauge("ai_usage_reset_seconds", "Seconds until the AI rate limit window resets.", float64(current.ResetInSeconds), labels...)
+		m.gauge("ai_usage_rate_percent_per_hour", "Forecast rate at which the AI rate limit window is being used.", forecast.RatePerHour, labels...)
+		m.gauge("ai_usage_projected_at_reset_percent", "Forecast usage of the AI rate limit window when it resets.", forecast.ProjectedAtReset, labels...)
+		m.gauge("ai_usage_will_exhaust", "Whether the AI rate limit window is forecast to run out before it resets.", boolValue(forecast.WillExhaust), labels...)
+		if forecast.HoursToExhaust >= 0 {
+			m.gauge("ai_usage_hours_to_exhaust", "Forecast hours until the AI rate limit window runs out.", forecast.HoursToExhaust, labels...)
+		}
+	}
+}
+
+func (h *Handler) writeServiceMetrics(m *metricsWriter) {
+	const help = "Whether the service is listening: 1 for discovered services, 0 for those seen in the last day that stopped."
+	services := h.discoverer.GetServices()
+	listening := make(map[string]bool, len(services))
+	for _, svc := range services {
+		listening[svc.ID] = true
+		m.gauge("service_up", help, 1, serviceLabels(svc.ID, svc.Port, svc.Protocol, svc.Name, svc.ProjectPath, svc.Container)...)
+	}
+
+	// Sightings come most recent first, so the first one of a service is its latest
+	for _, s := range h.discoverer.History(discovery.HistoryQuery{Since: time.Now().Add(-stoppedServiceWindow)}) {
+		if listening[s.ServiceID] {
+			continue
+		}
+		listening[s.ServiceID] = true
+		m.gauge("service_up", help, 0, serviceLabels(s.ServiceID, s.Port, s.Protocol, s.Name, s.ProjectPath, s.Container)...)
+	}
+	m.gauge("services", "Number of discovered services.", float64(len(services)))
+}
+
+func serviceLabels(id string, port int, protocol, name, project, container string) []label {
+	return []label{
+		{"id", id},
+		{"port", strconv.Itoa(port)},
+		{"protocol", protocol},
+		{"name", name},
+		{"project", project},
+		{"container", container},
+	}
+}
+
+func (h *Handler) writeDiscoveryMetrics(m *metricsWriter) {
+	stats := h.discoverer.Stats()
+	const durationHelp = "Time spent in discovery runs."
+	m.sample("discovery_duration_seconds_sum", "summary", durationHelp, stats.Duration.Seconds())
+	m.sample("discovery_duration_seconds_count", "summary", durationHelp, float64(stats.Runs))
+	m.gauge("discovery_running", "Whether a discovery run is in progress.", boolValue(stats.Running))
+	m.gauge("discovery_last_duration_seconds", "Time the latest discovery run took.", stats.LastDuration.Seconds())
+	if !stats.LastRun.IsZero() {
+		m.gauge("discovery_last_run_timestamp_seconds", "When the latest discovery run finished.", float64(stats.LastRun.Unix()))
+	}
+
+	steps := make([]string, 0, len(stats.Errors))
+	for step := range stats.Errors {
+		steps = append(steps, step)
+	}
+	sort.Strings(steps)
+	for _, step := range steps {
+		m.counter("discovery_errors_total", "Discovery errors by the source or enricher that failed, or deadline for runs cut short.", float64(stats.Errors[step]), label{"step", step})
+	}
+}
+
+func (h *Handler) writeDailyTaskMetrics(m *metricsWriter) {
+	today := config.TodayString()
+	tasks := h.configMgr.GetDailyTasks()
+	done := 0
+	for _, task := range tasks {
+		labels := []label{{"id", task.ID}, {"name", task.Name}}
+		m.gauge("daily_task_completed", "Whether the daily task is done today.", boolValue(task.Completions[today]), labels...)
+		m.gauge("daily_task_streak_days", "Current streak of the daily task.", float64(task.CurrentStreak), labels...)
+		m.gauge("daily_task_longest_streak_days", "Longest streak of the daily task.", float64(task.LongestStreak), labels...)
+		if task.Completions[today] {
+			done++
+		}
+	}
+	m.gauge("daily_tasks", "Number of daily tasks.", float64(len(tasks)))
+	m.gauge("daily_tasks_completed", "Number of daily tasks done today.", float64(done))
+}
@@ -0,0 +1,54 @@
+package web
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEscapeLabel(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"web-app", "web-app"},
+		{"", ""},
+		{`say "hi"`, `say \"hi\"`},
+		{`C:\dev\app`, `C:\\dev\\app`},
+		{"line one\nline two", `line one\nline two`},
+		{`\"`, `\\\"`},
+		{"tab\tand unicode ✓", "tab\tand unicode ✓"},
+	}
+
+	for _, tt := range tests {
+		if got := escapeLabel(tt.in); got != tt.want {
+			t.Errorf("escapeLabel(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMetricsWriterGroupsFamilies(t *testing.T) {
+	m := newMetricsWriter()
+	m.gauge("service_up", "Whether the service is listening", 1, label{"name", `My "App"`}, label{"port", "3000"})
+	m.counter("discovery_runs_total", "Discovery runs", 4)
+	m.gauge("service_up", "Whether the service is listening", 0, label{"name", "db"}, label{"port", "5432"})
+	m.sample("discovery_duration_seconds_sum", "summary", "Discovery run time", 1.5)
+	m.sample("discovery_duration_seconds_count", "summary", "Discovery run time", 4)
+
+	var out strings.Builder
+	m.writeTo(&out)
+
+	want := `# HELP devproxy_service_up Whether the service is listening
+# TYPE devproxy_service_up gauge
+devproxy_service_up{name="My \"App\"",port="3000"} 1
+devproxy_service_up{name="db",port="5432"} 0
+# HELP devproxy_discovery_runs_total Discovery runs
+# TYPE devproxy_discovery_runs_total counter
+devproxy_discovery_runs_total 4
+# HELP devproxy_discovery_duration_seconds Discovery run time
+# TYPE devproxy_discovery_duration_seconds summary
+devproxy_discovery_duration_seconds_sum 1.5
+devproxy_discovery_duration_seconds_count 4
+`
+	if out.String() != want {
+		t.Errorf("writeTo() =\n%s\nwant\n%s", out.String(), want)
+	}
+}
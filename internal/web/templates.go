@@ -345,6 +345,15 @@ h1 {
     color: var(--text-primary);
 }
 
+.service-icon {
+    display: inline-block;
+    width: 1.25rem;
+    height: 1.25rem;
+    margin-right: 0.4rem;
+    vertical-align: -0.15rem;
+    object-fit: contain;
+}
+
 .service-port {
     font-family: 'Courier New', monospace;
     font-size: 1.1rem;
@@ -379,7 +388,9 @@ h1 {
     letter-spacing: 0.5px;
 }
 
-.tag.docker {
+.tag.docker,
+.tag.podman,
+.tag.container {
     background: var(--tag-docker-bg);
     color: var(--tag-docker-text);
 }
@@ -399,6 +410,44 @@ h1 {
     color: var(--tag-known-text);
 }
 
+.tag.category {
+    background: var(--bg-card);
+    color: var(--text-secondary);
+    border: 1px solid var(--border-color);
+}
+
+.tag.internal {
+    background: var(--bg-card);
+    color: var(--text-secondary);
+    border: 1px dashed var(--border-color);
+}
+
+.tag.exposure-warning {
+    background: rgba(255, 152, 0, 0.2);
+    color: #ff9800;
+}
+
+.tag.health-up {
+    background: rgba(76, 175, 80, 0.2);
+    color: #4caf50;
+}
+
+.tag.health-down {
+    background: rgba(244, 67, 54, 0.2);
+    color: #f44336;
+}
+
+.tag.proxy-link {
+    background: var(--port-bg);
+    color: var(--port-text);
+    text-decoration: none;
+    margin-left: auto;
+}
+
+.tag.proxy-link:hover {
+    text-decoration: underline;
+}
+
 .project-status-icons {
     display: flex;
     gap: 0.4rem;
@@ -444,6 +493,118 @@ h1 {
     to { transform: rotate(360deg); }
 }
 
+.stack-state {
+    font-size: 0.7rem;
+    font-weight: 600;
+    padding: 0.2rem 0.5rem;
+    border-radius: 4px;
+    white-space: nowrap;
+    background: var(--tag-http-bg);
+    color: var(--tag-http-text);
+}
+
+.stack-state.degraded,
+.stack-state.partial {
+    background: var(--tag-project-bg);
+    color: var(--tag-project-text);
+}
+
+.stack-state.stopped {
+    background: var(--bg-card);
+    color: var(--text-muted);
+}
+
+.stack-members {
+    display: flex;
+    flex-direction: column;
+    gap: 0.25rem;
+}
+
+.stack-member {
+    display: flex;
+    justify-content: space-between;
+    font-size: 0.85rem;
+    padding: 0.3rem 0.5rem;
+    border-radius: 6px;
+    background: var(--bg-card);
+}
+
+.stack-member.link {
+    cursor: pointer;
+}
+
+.stack-member.link:hover {
+    color: var(--accent-primary);
+}
+
+.stack-member.stopped {
+    color: var(--text-muted);
+}
+
+.stack-member-port {
+    color: var(--text-secondary);
+    font-family: monospace;
+}
+
+.card-actions {
+    display: flex;
+    flex-wrap: wrap;
+    gap: 0.4rem;
+    margin-top: 0.75rem;
+}
+
+.action-btn {
+    font-size: 0.7rem;
+    padding: 0.2rem 0.6rem;
+    border-radius: 4px;
+    border: 1px solid var(--border-color);
+    background: transparent;
+    color: var(--text-secondary);
+    cursor: pointer;
+}
+
+.action-btn:hover {
+    color: var(--accent-primary);
+    border-color: var(--accent-primary);
+}
+
+.action-btn.danger:hover {
+    color: #ff6b6b;
+    border-color: #ff6b6b;
+}
+
+.action-btn.small {
+    font-size: 0.65rem;
+    padding: 0.05rem 0.4rem;
+    margin-left: 0.4rem;
+}
+
+.action-status {
+    font-size: 0.75rem;
+    margin-top: 0.4rem;
+    font-family: monospace;
+    white-space: nowrap;
+    overflow: hidden;
+    text-overflow: ellipsis;
+}
+
+.action-status:empty {
+    display: none;
+}
+
+.action-status.pending {
+    color: var(--text-secondary);
+}
+
+.action-status.ok {
+    color: var(--accent-secondary);
+}
+
+.action-status.error {
+    color: #ff6b6b;
+    white-space: normal;
+}
+
 .source-badge {
     font-size: 0.65rem;
     color: var(--text-muted);
@@ -945,6 +1106,207 @@ h1 {
 #terminal {
     height: 350px;
 }
+
+.log-viewer {
+    position: fixed;
+    left: 5vw;
+    right: 5vw;
+    bottom: 2rem;
+    height: 60vh;
+    z-index: 900;
+    flex-direction: column;
+    background: var(--bg-primary);
+    border: 1px solid var(--border-color);
+    border-radius: 12px;
+    box-shadow: 0 10px 40px rgba(0, 0, 0, 0.5);
+    overflow: hidden;
+}
+
+.log-viewer-header {
+    display: flex;
+    align-items: center;
+    gap: 0.5rem;
+    padding: 0.6rem 1rem;
+    border-bottom: 1px solid var(--border-color);
+}
+
+.log-viewer-title {
+    flex: 1;
+    font-weight: 600;
+    color: var(--text-primary);
+}
+
+.log-viewer-header input,
+.log-viewer-header select {
+    font-size: 0.8rem;
+    padding: 0.2rem 0.4rem;
+    border-radius: 4px;
+    border: 1px solid var(--border-color);
+    background: var(--bg-card);
+    color: var(--text-primary);
+}
+
+.log-lines {
+    flex: 1;
+    margin: 0;
+    padding: 0.5rem 1rem;
+    overflow-y: auto;
+    font-size: 0.78rem;
+    line-height: 1.4;
+    color: var(--text-primary);
+    white-space: pre-wrap;
+    word-break: break-all;
+}
+
+.log-line.stderr {
+    color: #ff6b6b;
+}
+
+.log-line.info,
+.log-line.end,
+.log-line.error {
+    color: var(--text-muted);
+    font-style: italic;
+}
+
+.log-time {
+    color: var(--text-muted);
+}
+
+.log-prefix {
+    font-weight: 600;
+}
+
+.override-editor {
+    position: fixed;
+    top: 15vh;
+    left: 50%;
+    transform: translateX(-50%);
+    width: min(420px, 90vw);
+    z-index: 950;
+    padding: 1rem 1.25rem;
+    background: var(--bg-primary);
+    border: 1px solid var(--border-color);
+    border-radius: 12px;
+    box-shadow: 0 10px 40px rgba(0, 0, 0, 0.5);
+}
+
+.override-editor h3 {
+    margin: 0 0 0.75rem;
+    font-size: 1rem;
+    color: var(--text-primary);
+}
+
+.override-editor label {
+    display: block;
+    margin-bottom: 0.5rem;
+    font-size: 0.8rem;
+    color: var(--text-secondary);
+}
+
+.override-editor input[type="text"],
+.override-editor select {
+    display: block;
+    width: 100%;
+    box-sizing: border-box;
+    margin-top: 0.2rem;
+    font-size: 0.85rem;
+    padding: 0.3rem 0.5rem;
+    border-radius: 4px;
+    border: 1px solid var(--border-color);
+    background: var(--bg-card);
+    color: var(--text-primary);
+}
+
+.override-editor .checkbox-row {
+    display: flex;
+    gap: 1.25rem;
+}
+
+.override-editor .checkbox-row label {
+    display: flex;
+    align-items: center;
+    gap: 0.3rem;
+}
+
+.override-editor .card-actions {
+    justify-content: flex-end;
+}
+
+.service-card.pinned {
+    border-color: var(--accent-primary);
+}
+
+.service-card.is-hidden {
+    opacity: 0.5;
+}
+
+.service-card.stopped {
+    opacity: 0.5;
+    border-style: dashed;
+    cursor: default;
+}
+
+.service-card.stopped:hover {
+    opacity: 0.8;
+}
+
+.restart-hint {
+    font-family: monospace;
+    font-size: 0.75rem;
+    word-break: break-all;
+}
+
+.hidden-toggle {
+    margin-left: 0.5rem;
+    color: var(--accent-primary);
+    cursor: pointer;
+}
+
+.refresh-now {
+    margin-left: 0.5rem;
+    color: var(--accent-primary);
+    cursor: pointer;
+}
+
+.refresh-now.running {
+    color: var(--text-muted);
+    cursor: progress;
+}
+
+.toast-container {
+    position: fixed;
+    bottom: 1.5rem;
+    right: 1.5rem;
+    display: flex;
+    flex-direction: column;
+    gap: 0.5rem;
+    z-index: 1000;
+}
+
+.toast {
+    background: var(--bg-secondary);
+    border: 1px solid var(--border-color);
+    border-left: 4px solid var(--accent-primary);
+    border-radius: 8px;
+    padding: 0.75rem 1rem;
+    color: var(--text-primary);
+    font-size: 0.85rem;
+    box-shadow: 0 4px 16px rgba(0, 0, 0, 0.3);
+    transition: opacity 0.3s ease;
+}
+
+.toast.appeared {
+    border-left-color: var(--accent-secondary);
+}
+
+.toast.disappeared {
+    border-left-color: #ff5555;
+}
+
+.toast.fading {
+    opacity: 0;
+}
 `
 
 const indexHTML = `<!DOCTYPE html>
@@ -1139,7 +1501,7 @@ const indexHTML = `<!DOCTYPE html>
                     <span class="summary-badge" id="summary-services">0 services</span>
                 </div>
             </div>
-            <p class="section-subtitle">Auto-discovered services running on this machine <span class="refresh-info" id="refresh-info">(refreshes every 30 seconds)</span></p>
+            <p class="section-subtitle">Auto-discovered services running on this machine <span class="refresh-info" id="refresh-info">(refreshes every 30 seconds)</span><span class="refresh-now" id="refresh-now" onclick="refreshNow()" title="Run discovery now">Refresh now</span><span class="hidden-toggle" id="hidden-toggle" onclick="toggleHiddenServices()"></span></p>
             <div class="section-content">
                 <div id="services" class="services-grid">
                     <div class="loading">
@@ -1198,6 +1560,54 @@ const indexHTML = `<!DOCTYPE html>
         </div>
     </div>
 
+    <div id="toasts" class="toast-container"></div>
+    <div id="log-viewer" class="log-viewer" style="display: none;">
+        <div class="log-viewer-header">
+            <span class="log-viewer-title" id="log-viewer-title">Logs</span>
+            <input type="text" id="log-filter" placeholder="Filter..." oninput="setLogFilter(this.value)">
+            <select id="log-tail" onchange="reconnectLogs()" title="Lines of history">
+                <option value="100">last 100</option>
+                <option value="500" selected>last 500</option>
+                <option value="all">all</option>
+            </select>
+            <select id="log-since" onchange="reconnectLogs()" title="Time range">
+                <option value="">any time</option>
+                <option value="10m">last 10 min</option>
+                <option value="1h">last hour</option>
+                <option value="24h">last day</option>
+            </select>
+            <button class="action-btn" id="log-pause" onclick="toggleLogPause()">pause</button>
+            <button class="action-btn" onclick="closeLogs()">close</button>
+        </div>
+        <pre id="log-lines" class="log-lines"></pre>
+    </div>
+    <div id="override-editor" class="override-editor" style="display: none;">
+        <h3 id="override-title">Edit service</h3>
+        <label>Apply to
+            <select id="override-scope"></select>
+        </label>
+        <label>Name <input type="text" id="override-name"></label>
+        <label>Description <input type="text" id="override-description"></label>
+        <label>Icon <input type="text" id="override-icon" placeholder="Emoji or image URL"></label>
+        <label>Launch path <input type="text" id="override-path" placeholder="/admin"></label>
+        <label>Scheme
+            <select id="override-scheme">
+                <option value="">as discovered</option>
+                <option value="http">http</option>
+                <option value="https">https</option>
+            </select>
+        </label>
+        <div class="checkbox-row">
+            <label><input type="checkbox" id="override-pinned"> pin to top</label>
+            <label><input type="checkbox" id="override-hidden"> hide</label>
+        </div>
+        <div class="card-actions">
+            <button class="action-btn danger" id="override-reset" onclick="deleteOverride()">reset</button>
+            <button class="action-btn" onclick="closeOverrideEditor()">cancel</button>
+            <button class="action-btn" onclick="saveOverride()">save</button>
+        </div>
+    </div>
+
     <script src="https://cdn.jsdelivr.net/npm/@xterm/xterm@5.5.0/lib/xterm.min.js"></script>
     <script src="https://cdn.jsdelivr.net/npm/@xterm/addon-fit@0.10.0/lib/addon-fit.min.js"></script>
     <script>
@@ -1246,9 +1656,9 @@ const indexHTML = `<!DOCTYPE html>
 
         async function loadServices() {
             try {
-                const response = await fetch('/api/services');
+                const [response, stacks, history] = await Promise.all([fetch('/api/services'), loadStacks(), loadRecentHistory(), loadHealth()]);
                 const services = await response.json();
-                renderServices(services);
+                renderServices(services, stacks, history);
             } catch (error) {
                 console.error('Failed to load services:', error);
                 document.getElementById('services').innerHTML = ` + "`" + `
@@ -1260,14 +1670,120 @@ const indexHTML = `<!DOCTYPE html>
             }
         }
 
-        function renderServices(services) {
+        // Runs discovery now instead of waiting for the next refresh, e.g.
+        // right after docker compose up
+        async function refreshNow() {
+            const button = document.getElementById('refresh-now');
+            if (button.classList.contains('running')) return;
+            button.classList.add('running');
+            button.textContent = 'Refreshing...';
+            try {
+                const response = await actionFetch('/api/discover', {
+                    headers: { 'Content-Type': 'application/json' },
+                });
+                const result = await response.json();
+                await loadServices();
+                const took = (result.status.lastDurationMs / 1000).toFixed(1) + 's';
+                if (result.error) {
+                    showToast('Discovery finished with errors in ' + took + ': ' + result.error, 'error');
+                } else {
+                    showToast('Found ' + result.services + ' services in ' + took);
+                }
+            } catch (error) {
+                showToast('Could not refresh: ' + error.message, 'error');
+            } finally {
+                button.classList.remove('running');
+                button.textContent = 'Refresh now';
+            }
+        }
+
+        // Health check states by service ID, for the tag on each card
+        let healthByService = {};
+
+        async function loadHealth() {
+            try {
+                const response = await fetch('/api/health-checks');
+                if (!response.ok) return;
+                healthByService = {};
+                (await response.json()).forEach(status => {
+                    (healthByService[status.check.service] = healthByService[status.check.service] || []).push(status);
+                });
+            } catch (error) {
+                console.error('Failed to load health checks:', error);
+            }
+        }
+
+        // One tag for all of a service's checks: down if any is down, with
+        // the lowest 24h uptime
+        function healthTag(svc) {
+            const statuses = (healthByService[svc.id] || []).filter(st => st.state !== 'unknown');
+            if (!statuses.length) return '';
+
+            const down = statuses.filter(st => st.state === 'down');
+            const uptimes = statuses.map(st => st.uptime24h).filter(u => u !== null);
+            const uptime = uptimes.length ? ' ' + Math.min(...uptimes).toFixed(1) + '%' : '';
+            const title = down.length
+                ? down.map(st => st.check.type + ': ' + st.lastError).join('\n')
+                : statuses.map(st => st.check.type + ': ' + st.latencyMs.toFixed(0) + ' ms').join('\n');
+            return ` + "`" + `<span class="tag ${down.length ? 'health-down' : 'health-up'}" title="${escapeHtml(title + '\n24h uptime; details at /api/services/' + svc.id + '/health')}">${down.length ? 'down' : 'healthy'}${uptime}</span>` + "`" + `;
+        }
+
+        // Sightings of the last day, for the services that stopped since
+        async function loadRecentHistory() {
+            try {
+                const response = await fetch('/api/services/history?since=24h');
+                if (!response.ok) return [];
+                return await response.json();
+            } catch (error) {
+                return [];
+            }
+        }
+
+        // Compose stacks are optional: without a container runtime the
+        // services render as plain cards
+        async function loadStacks() {
+            try {
+                const response = await fetch('/api/stacks');
+                if (!response.ok) return [];
+                return await response.json();
+            } catch (error) {
+                return [];
+            }
+        }
+
+        let showHidden = false;
+        let servicesByKey = {};
+
+        function renderServices(services, stacks, history) {
             const container = document.getElementById('services');
 
+            // The latest sighting of each service that isn't listening any more
+            lastHistory = history || [];
+            const listening = new Set((services || []).map(svc => svc.id));
+            const stopped = [];
+            (history || []).forEach(s => {
+                if (!s.running && !listening.has(s.serviceId)) {
+                    listening.add(s.serviceId);
+                    stopped.push(s);
+                }
+            });
+
+            // Hidden services stay out of the list (and the count) unless asked for;
+            // pinned ones go first
+            const hiddenCount = (services || []).filter(svc => svc.hidden).length;
+            document.getElementById('hidden-toggle').textContent = hiddenCount
+                ? (showHidden ? 'hide ' : 'show ') + hiddenCount + ' hidden'
+                : '';
+            services = (services || []).filter(svc => showHidden || !svc.hidden);
+            services.sort((a, b) => (b.pinned ? 1 : 0) - (a.pinned ? 1 : 0));
+            servicesByKey = {};
+            services.forEach(svc => { servicesByKey[svc.id] = svc; });
+
             // Update summary badge
             const count = services ? services.length : 0;
             document.getElementById('summary-services').textContent = count + ' service' + (count !== 1 ? 's' : '');
 
-            if (!services || services.length === 0) {
+            if ((!services || services.length === 0) && stopped.length === 0) {
                 container.innerHTML = ` + "`" + `
                     <div class="empty-state">
                         <p>No services discovered</p>
@@ -1276,28 +1792,556 @@ const indexHTML = `<!DOCTYPE html>
                 return;
             }
 
-            container.innerHTML = services.map(svc => ` + "`" + `
-                <div class="service-card ${svc.isHttp ? 'http' : ''}"
-                     ${svc.url ? ` + "`" + `onclick="window.open('${svc.url}', '_blank')"` + "`" + ` : ''}>
+            // Services of one compose project render as a single stack card,
+            // placed where its first service would have been
+            const stackByKey = {};
+            (stacks || []).forEach(stack => { stackByKey[stack.host + '/' + stack.name] = stack; });
+            const rendered = new Set();
+            container.innerHTML = services.map(svc => {
+                const key = svc.runtimeHost + '/' + svc.composeProject;
+                const stack = svc.composeProject && stackByKey[key];
+                if (!stack) return serviceCard(svc);
+                if (rendered.has(key)) return '';
+                rendered.add(key);
+                return stackCard(stack, services.filter(s => s.runtimeHost + '/' + s.composeProject === key));
+            }).join('') + stopped.map(stoppedCard).join('');
+        }
+
+        // A greyed-out card for a service seen in the last day, with the
+        // command that should bring it back
+        function stoppedCard(s) {
+            const owner = s.container ? 'Container: ' + s.container : (s.process ? 'Process: ' + s.process : '');
+            return ` + "`" + `
+                <div class="service-card stopped" title="Seen ${escapeHtml(new Date(s.firstSeen).toLocaleString())} to ${escapeHtml(new Date(s.lastSeen).toLocaleString())}">
                     <div class="service-header">
                         <div>
-                            <div class="service-name">${escapeHtml(svc.name)}</div>
+                            <div class="service-name">${escapeHtml(s.name)}</div>
+                            <div class="source-badge">stopped ${timeAgo(s.lastSeen)}</div>
+                        </div>
+                        <div class="service-port">:${s.port}${s.protocol === 'udp' ? '/udp' : ''}</div>
+                    </div>
+                    <div class="service-details">
+                        ${owner ? ` + "`" + `<p title="${escapeHtml(s.command || '')}">${escapeHtml(owner)}</p>` + "`" + ` : ''}
+                        ${s.projectPath ? ` + "`" + `<p>Project: ${escapeHtml(s.projectPath)}</p>` + "`" + ` : ''}
+                        ${s.restart ? ` + "`" + `<p class="restart-hint">${escapeHtml(s.restart)}</p>` + "`" + ` : ''}
+                    </div>
+                    ${s.restart ? ` + "`" + `
+                        <div class="card-actions">
+                            <button class="action-btn" title="Copy the command that restarts it" onclick="copyRestartHint(event, ${jsArg(s.serviceId)}, ${jsArg(s.firstSeen)})">copy restart command</button>
+                        </div>
+                    ` + "`" + ` : ''}
+                </div>
+            ` + "`" + `;
+        }
+
+        let lastHistory = [];
+
+        function copyRestartHint(event, serviceId, firstSeen) {
+            event.stopPropagation();
+            const s = lastHistory.find(s => s.serviceId === serviceId && s.firstSeen === firstSeen);
+            if (!s) return;
+            // The clipboard API needs a secure context (localhost or HTTPS)
+            if (!navigator.clipboard) {
+                window.prompt('Restart command', s.restart);
+                return;
+            }
+            navigator.clipboard.writeText(s.restart)
+                .then(() => showToast('Copied: ' + s.restart))
+                .catch(() => window.prompt('Restart command', s.restart));
+        }
+
+        // "5m ago", "3h ago"
+        function timeAgo(time) {
+            const minutes = Math.max(0, Math.round((Date.now() - new Date(time)) / 60000));
+            if (minutes < 60) return minutes + 'm ago';
+            return Math.round(minutes / 60) + 'h ago';
+        }
+
+        function serviceCard(svc) {
+            return ` + "`" + `
+                <div class="service-card ${svc.isHttp ? 'http' : ''} ${svc.pinned ? 'pinned' : ''} ${svc.hidden ? 'is-hidden' : ''}"
+                     ${serviceLink(svc) ? ` + "`" + `onclick="window.open(${jsArg(serviceLink(svc))}, '_blank')"` + "`" + ` : ''}>
+                    <div class="service-header">
+                        <div>
+                            <div class="service-name" title="${escapeHtml(provenanceText(svc, 'name'))}">${serviceIcon(svc)}${escapeHtml(svc.name)}</div>
                             <div class="source-badge">${svc.source}</div>
                         </div>
-                        <div class="service-port">:${svc.port}</div>
+                        <div class="service-port">
+                            :${svc.port}${svc.protocol === 'udp' ? '/udp' : ''}
+                            <button class="action-btn small" title="Rename, hide, pin or change the launch URL" onclick="openOverrideEditor(event, ${jsArg(svc.id)})">edit</button>
+                        </div>
                     </div>
                     <div class="service-details">
-                        ${svc.container ? ` + "`" + `<p>Container: ${escapeHtml(svc.container)}</p>` + "`" + ` : ''}
+                        ${svc.container ? ` + "`" + `<p>Container: ${escapeHtml(svc.container)}${svc.runtime && svc.runtime !== 'docker' ? ' (' + escapeHtml(svc.runtime) + ')' : ''}</p>` + "`" + ` : ''}
+                        ${svc.containerPort && svc.containerPort !== svc.port ? ` + "`" + `<p>Container port: ${svc.containerPort}</p>` + "`" + ` : ''}
                         ${svc.image ? ` + "`" + `<p>Image: ${escapeHtml(svc.image)}</p>` + "`" + ` : ''}
-                        ${svc.process ? ` + "`" + `<p>Process: ${escapeHtml(svc.process)}</p>` + "`" + ` : ''}
-                        ${svc.projectPath ? ` + "`" + `<p>Project: ${escapeHtml(svc.projectPath)}</p>` + "`" + ` : ''}
+                        ${svc.appProtocol ? ` + "`" + `<p>Protocol: ${escapeHtml(svc.appProtocol)}${svc.version ? ' (' + escapeHtml(svc.version) + ')' : ''}</p>` + "`" + ` : ''}
+                        ${svc.networks && svc.networks.length ? ` + "`" + `<p>Networks: ${escapeHtml(svc.networks.map(n => n.name + (n.ip ? ' (' + n.ip + ')' : '')).join(', '))}</p>` + "`" + ` : ''}
+                        ${svc.process ? ` + "`" + `<p title="${escapeHtml(svc.command)}">Process: ${escapeHtml(svc.process)}${svc.pid ? ' (' + svc.pid + ')' : ''}${svc.user ? ' as ' + escapeHtml(svc.user) : ''}</p>` + "`" + ` : ''}
+                        ${svc.unit ? ` + "`" + `<p title="${escapeHtml(svc.unit.cgroup)}">${unitText(svc.unit)}</p>` + "`" + ` : ''}
+                        ${svc.bindAddresses && svc.bindAddresses.length ? ` + "`" + `<p>Bound: ${escapeHtml(svc.bindAddresses.join(', '))}</p>` + "`" + ` : ''}
+                        ${svc.projectPath ? ` + "`" + `<p title="Matched by ${escapeHtml(svc.projectSource)}">Project: ${escapeHtml(svc.projectPath)}</p>` + "`" + ` : ''}
                         ${svc.description ? ` + "`" + `<p>${escapeHtml(svc.description)}</p>` + "`" + ` : ''}
                     </div>
                     <div class="service-tags">
+                        ${svc.category ? ` + "`" + `<span class="tag category" title="${escapeHtml(provenanceText(svc, 'category'))}">${escapeHtml(svc.category)}</span>` + "`" + ` : ''}
                         ${(svc.tags || []).map(tag => ` + "`" + `<span class="tag ${tag}">${tag}</span>` + "`" + `).join('')}
+                        ${healthTag(svc)}
+                        ${exposureTag(svc)}
+                        ${svc.proxyUrl ? ` + "`" + `<a class="tag proxy-link" href="${escapeHtml(svc.proxyUrl)}" target="_blank" onclick="event.stopPropagation()" title="Open through the dashboard proxy">via proxy</a>` + "`" + ` : ''}
                     </div>
+                    ${svc.container ? containerActions(svc.container, svc.containerState) : ''}
                 </div>
-            ` + "`" + `).join('');
+            ` + "`" + `;
+        }
+
+        function containerActions(name, state) {
+            const actions = state === 'paused' ? ['unpause', 'stop', 'remove'] : ['restart', 'stop', 'pause', 'remove'];
+            return ` + "`" + `
+                <div class="card-actions">
+                    <button class="action-btn" onclick="event.stopPropagation(); openLogs({ container: ${jsArg(name)} }, ${jsArg(name)})">logs</button>
+                    ${actions.map(action => ` + "`" + `<button class="action-btn ${action === 'remove' ? 'danger' : ''}" onclick="containerAction(event, ${jsArg(name)}, '${action}')">${action}</button>` + "`" + `).join('')}
+                </div>
+                ${actionStatusHtml('c:' + name)}
+            ` + "`" + `;
+        }
+
+        const stackStateLabels = { up: 'all up', degraded: 'degraded', partial: 'partially stopped', stopped: 'stopped' };
+
+        function stackCard(stack, members) {
+            const stopped = (stack.containers || []).filter(c => c.state !== 'running');
+            return ` + "`" + `
+                <div class="service-card stack-card">
+                    <div class="service-header">
+                        <div>
+                            <div class="service-name">${escapeHtml(stack.name)}</div>
+                            <div class="source-badge">compose stack${stack.runtime !== 'docker' ? ' (' + escapeHtml(stack.runtime) + ')' : ''}</div>
+                        </div>
+                        <span class="stack-state ${stack.state}" title="${stack.running} of ${stack.total} containers running">${stackStateLabels[stack.state] || stack.state} ${stack.running}/${stack.total}</span>
+                    </div>
+                    <div class="service-details">
+                        ${stack.workingDir ? ` + "`" + `<p>Project: ${escapeHtml(stack.workingDir)}</p>` + "`" + ` : ''}
+                    </div>
+                    <div class="stack-members">
+                        ${members.map(svc => ` + "`" + `
+                            <div class="stack-member ${serviceLink(svc) ? 'link' : ''}"
+                                 ${serviceLink(svc) ? ` + "`" + `onclick="window.open(${jsArg(serviceLink(svc))}, '_blank')"` + "`" + ` : ''}
+                                 title="${escapeHtml(svc.container + (svc.description ? ' - ' + svc.description : ''))}">
+                                <span>${escapeHtml(svc.composeService || svc.name)}</span>
+                                <span class="stack-member-port">${svc.exposure === 'internal' ? 'internal ' : ''}:${svc.port}${svc.protocol === 'udp' ? '/udp' : ''}</span>
+                            </div>
+                        ` + "`" + `).join('')}
+                        ${stopped.map(c => ` + "`" + `
+                            <div class="stack-member stopped" title="${escapeHtml(c.status)}">
+                                <span>${escapeHtml(c.service || c.name)}</span>
+                                <span class="stack-member-port">
+                                    ${escapeHtml(c.state)}
+                                    <button class="action-btn small" onclick="containerAction(event, ${jsArg(c.name)}, '${c.state === 'paused' ? 'unpause' : 'start'}')">${c.state === 'paused' ? 'unpause' : 'start'}</button>
+                                </span>
+                            </div>
+                            ${actionStatusHtml('c:' + c.name)}
+                        ` + "`" + `).join('')}
+                    </div>
+                    <div class="card-actions">
+                        <button class="action-btn" onclick="event.stopPropagation(); openLogs({ stack: ${jsArg(stack.name)}, host: ${jsArg(stack.host)} }, ${jsArg(stack.name)})">logs</button>
+                        ${['up', 'restart', 'down'].map(action => ` + "`" + `<button class="action-btn ${action === 'down' ? 'danger' : ''}" onclick="stackAction(event, ${jsArg(stack.host)}, ${jsArg(stack.name)}, '${action}')">${action}</button>` + "`" + `).join('')}
+                    </div>
+                    ${actionStatusHtml('s:' + stack.host + '/' + stack.name)}
+                </div>
+            ` + "`" + `;
+        }
+
+        // Container log viewer: one WebSocket per open view. Filtering and
+        // pausing happen server-side so a noisy container doesn't flood the page.
+        let logSocket = null;
+        let logTarget = null;
+        let logPaused = false;
+        const maxLogLines = 5000;
+        const logColors = ['#00d9ff', '#00ff88', '#ffc107', '#ff79c6', '#bd93f9', '#ff9f43', '#8be9fd', '#f1fa8c'];
+
+        // Logs need the action token too; make sure the browser has it
+        // before connecting, since a refused WebSocket gives no reason
+        async function openLogs(target, title) {
+            try {
+                await actionFetch('/api/action-token', { method: 'GET' });
+            } catch (error) {
+                alert(error.message);
+                return;
+            }
+            logTarget = target;
+            document.getElementById('log-viewer-title').textContent = 'Logs: ' + title;
+            document.getElementById('log-viewer').style.display = 'flex';
+            reconnectLogs();
+        }
+
+        function closeLogs() {
+            if (logSocket) logSocket.close();
+            logSocket = null;
+            logTarget = null;
+            document.getElementById('log-viewer').style.display = 'none';
+        }
+
+        function reconnectLogs() {
+            if (!logTarget) return;
+            if (logSocket) logSocket.close();
+
+            const params = new URLSearchParams(logTarget);
+            params.set('tail', document.getElementById('log-tail').value);
+            const since = document.getElementById('log-since').value;
+            if (since) params.set('since', since);
+
+            const lines = document.getElementById('log-lines');
+            lines.innerHTML = '';
+            logPaused = false;
+            document.getElementById('log-pause').textContent = 'pause';
+
+            const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
+            const socket = new WebSocket(protocol + '//' + window.location.host + '/ws/logs?' + params);
+            logSocket = socket;
+
+            socket.onopen = () => {
+                const filter = document.getElementById('log-filter').value;
+                if (filter) socket.send(JSON.stringify({ filter }));
+            };
+            socket.onmessage = (event) => {
+                if (socket !== logSocket) return;
+                appendLogMessage(JSON.parse(event.data), !!logTarget.stack);
+            };
+            socket.onclose = () => {
+                if (socket === logSocket) appendLogMessage({ type: 'info', message: 'Disconnected' });
+            };
+        }
+
+        function appendLogMessage(msg, showContainer) {
+            const lines = document.getElementById('log-lines');
+            const atBottom = lines.scrollTop + lines.clientHeight >= lines.scrollHeight - 20;
+
+            const row = document.createElement('div');
+            row.className = 'log-line ' + (msg.type === 'line' ? msg.stream : msg.type);
+            if (msg.type === 'line') {
+                const time = msg.time ? new Date(msg.time).toLocaleTimeString() : '';
+                const prefix = showContainer
+                    ? ` + "`" + `<span class="log-prefix" style="color: ${logColor(msg.container)}">${escapeHtml(msg.container)} |</span> ` + "`" + `
+                    : '';
+                row.dataset.text = (msg.container + ' ' + msg.line).toLowerCase();
+                row.innerHTML = ` + "`" + `<span class="log-time">${time}</span> ${prefix}${escapeHtml(msg.line)}` + "`" + `;
+            } else {
+                row.textContent = '-- ' + msg.message + ' --';
+            }
+            applyLogFilter(row, document.getElementById('log-filter').value.toLowerCase());
+
+            lines.appendChild(row);
+            while (lines.childElementCount > maxLogLines) lines.removeChild(lines.firstChild);
+            if (atBottom) lines.scrollTop = lines.scrollHeight;
+        }
+
+        function logColor(name) {
+            let hash = 0;
+            for (const c of name) hash = (hash * 31 + c.charCodeAt(0)) >>> 0;
+            return logColors[hash % logColors.length];
+        }
+
+        function applyLogFilter(row, filter) {
+            if (row.dataset.text === undefined) return;
+            row.style.display = !filter || row.dataset.text.includes(filter) ? '' : 'none';
+        }
+
+        function setLogFilter(value) {
+            const filter = value.toLowerCase();
+            document.querySelectorAll('#log-lines .log-line').forEach(row => applyLogFilter(row, filter));
+            if (logSocket && logSocket.readyState === WebSocket.OPEN) {
+                logSocket.send(JSON.stringify({ filter: value }));
+            }
+        }
+
+        function toggleLogPause() {
+            logPaused = !logPaused;
+            document.getElementById('log-pause').textContent = logPaused ? 'resume' : 'pause';
+            if (logSocket && logSocket.readyState === WebSocket.OPEN) {
+                logSocket.send(JSON.stringify({ paused: logPaused }));
+            }
+        }
+
+        // Action progress survives re-renders triggered by the change feed
+        const actionStatus = {};
+
+        function actionStatusHtml(key) {
+            const status = actionStatus[key];
+            return ` + "`" + `<div class="action-status ${status ? status.kind : ''}" data-status-key="${escapeHtml(key)}">${status ? escapeHtml(status.text) : ''}</div>` + "`" + `;
+        }
+
+        function setActionStatus(key, text, kind) {
+            actionStatus[key] = { text, kind };
+            document.querySelectorAll('.action-status').forEach(el => {
+                if (el.dataset.statusKey === key) {
+                    el.className = 'action-status ' + kind;
+                    el.textContent = text;
+                }
+            });
+        }
+
+        // Actions need the token from the server's config directory; ask for
+        // it once and let the server keep it in an HttpOnly cookie, out of
+        // reach of scripts. Requests are POSTs unless options say otherwise.
+        localStorage.removeItem('actionToken'); // Stored here by older versions
+        async function actionFetch(url, options = {}) {
+            const send = () => fetch(url, { method: 'POST', ...options });
+            let response = await send();
+            if (response.status === 401) {
+                const message = (await response.text()).trim();
+                const token = prompt(message + '\n\nEnter the action token:');
+                if (!token) throw new Error('Action token required');
+                const login = await fetch('/api/action-token', {
+                    method: 'POST',
+                    headers: { 'Content-Type': 'application/json' },
+                    body: JSON.stringify({ token: token.trim() }),
+                });
+                if (!login.ok) throw new Error((await login.text()).trim() || login.statusText);
+                response = await send();
+            }
+            if (!response.ok) {
+                throw new Error((await response.text()).trim() || response.statusText);
+            }
+            return response;
+        }
+
+        async function containerAction(event, name, action) {
+            event.stopPropagation();
+            if (action === 'remove' && !confirm('Remove container ' + name + '? This cannot be undone.')) return;
+
+            const key = 'c:' + name;
+            setActionStatus(key, action + ' ' + name + '...', 'pending');
+            try {
+                await actionFetch('/api/containers/' + encodeURIComponent(name) + '/' + action);
+                setActionStatus(key, action + ' ' + name + ': done', 'ok');
+                loadServices();
+            } catch (error) {
+                setActionStatus(key, error.message, 'error');
+            }
+        }
+
+        // Streams compose output into the stack card, one line at a time
+        async function stackAction(event, host, project, action) {
+            event.stopPropagation();
+            if (action === 'down' && !confirm('Stop and remove all containers of ' + project + '?')) return;
+
+            const key = 's:' + host + '/' + project;
+            setActionStatus(key, 'docker compose ' + action + '...', 'pending');
+            try {
+                const response = await actionFetch('/api/stacks/' + encodeURIComponent(project) + '/' + action + '?host=' + encodeURIComponent(host));
+                const reader = response.body.getReader();
+                const decoder = new TextDecoder();
+                let buffer = '';
+                let result = null;
+                while (true) {
+                    const { done, value } = await reader.read();
+                    if (done) break;
+                    buffer += decoder.decode(value, { stream: true });
+                    const lines = buffer.split('\n');
+                    buffer = lines.pop();
+                    for (const line of lines) {
+                        if (!line) continue;
+                        const msg = JSON.parse(line);
+                        if (msg.done) {
+                            result = msg;
+                        } else {
+                            setActionStatus(key, msg.line, 'pending');
+                        }
+                    }
+                }
+                if (!result) throw new Error('Connection closed before compose finished');
+                if (result.error) throw new Error(result.error);
+                setActionStatus(key, 'docker compose ' + action + ': done', 'ok');
+                loadServices();
+            } catch (error) {
+                setActionStatus(key, error.message, 'error');
+            }
+        }
+
+        // Services the browser can't reach directly (e.g. bound to 127.0.0.1)
+        // open through the dashboard proxy instead
+        function serviceLink(svc) {
+            const link = svc.url && svc.reachable ? svc.url : (svc.proxyUrl || svc.url);
+            return link && /^(https?:\/\/|\/)/i.test(link) ? link : '';
+        }
+
+        // Describe the systemd unit or container scope a service's process runs in
+        function unitText(unit) {
+            if (unit.container) {
+                return 'Container scope: ' + escapeHtml(unit.container.slice(0, 12)) + (unit.pod ? ' in pod ' + escapeHtml(unit.pod.slice(0, 12)) : '');
+            }
+            const name = unit.name || unit.slice;
+            return 'Unit: ' + escapeHtml(name) + (unit.userManager ? ' (user)' : '') + (unit.slice && unit.name ? ' in ' + escapeHtml(unit.slice) : '');
+        }
+
+        // Explains which discovery source chose a field, e.g. "Name from docker: compose service label"
+        function provenanceText(svc, field) {
+            const prov = svc.provenance && svc.provenance[field];
+            if (!prov) return '';
+            const label = field.charAt(0).toUpperCase() + field.slice(1);
+            return label + ' from ' + prov.source + (prov.reason ? ': ' + prov.reason : '');
+        }
+
+        function toggleHiddenServices() {
+            showHidden = !showHidden;
+            loadServices();
+        }
+
+        // Per-service overrides, edited in a small dialog. An override is keyed
+        // by port, container or project; the dialog offers whichever apply.
+        let editingService = null;
+        let editingOverride = null;
+
+        async function openOverrideEditor(event, key) {
+            event.stopPropagation();
+            const svc = servicesByKey[key];
+            if (!svc) return;
+
+            editingService = svc;
+            editingOverride = null;
+            if (svc.override) {
+                try {
+                    const overrides = await (await fetch('/api/overrides')).json();
+                    editingOverride = overrides.find(o => o.id === svc.override) || null;
+                } catch (error) {
+                    console.error('Failed to load overrides:', error);
+                }
+            }
+            const o = editingOverride || {};
+
+            const scopes = [['port', svc.exposure === 'internal' ? 'Port ' + svc.port + ' of ' + svc.container : 'Port ' + svc.port]];
+            if (svc.container) scopes.push(['container', 'Container ' + svc.container]);
+            if (svc.projectPath) scopes.push(['project', 'Project ' + svc.projectPath]);
+            const scope = o.project && !o.port && !o.container ? 'project' : (o.container && !o.port ? 'container' : 'port');
+            document.getElementById('override-scope').innerHTML = scopes.map(([value, label]) =>
+                ` + "`" + `<option value="${value}" ${value === scope ? 'selected' : ''}>${escapeHtml(label)}</option>` + "`" + `).join('');
+
+            document.getElementById('override-title').textContent = 'Edit ' + svc.name;
+            document.getElementById('override-name').value = o.name || '';
+            document.getElementById('override-name').placeholder = svc.name;
+            document.getElementById('override-description').value = o.description || '';
+            document.getElementById('override-description').placeholder = svc.description || '';
+            document.getElementById('override-icon').value = o.icon || '';
+            document.getElementById('override-path').value = o.urlPath || '';
+            document.getElementById('override-scheme').value = o.scheme || '';
+            document.getElementById('override-pinned').checked = !!o.pinned;
+            document.getElementById('override-hidden').checked = !!o.hidden;
+            document.getElementById('override-reset').style.display = editingOverride ? '' : 'none';
+            document.getElementById('override-editor').style.display = 'block';
+        }
+
+        function closeOverrideEditor() {
+            editingService = null;
+            editingOverride = null;
+            document.getElementById('override-editor').style.display = 'none';
+        }
+
+        async function saveOverride() {
+            const svc = editingService;
+            if (!svc) return;
+
+            const override = {
+                name: document.getElementById('override-name').value.trim(),
+                description: document.getElementById('override-description').value.trim(),
+                icon: document.getElementById('override-icon').value.trim(),
+                urlPath: document.getElementById('override-path').value.trim(),
+                scheme: document.getElementById('override-scheme').value,
+                pinned: document.getElementById('override-pinned').checked,
+                hidden: document.getElementById('override-hidden').checked,
+            };
+            const scope = document.getElementById('override-scope').value;
+            if (scope === 'port') {
+                override.port = svc.port;
+                if (svc.exposure === 'internal') override.container = svc.container;
+            } else if (scope === 'container') {
+                override.container = svc.container;
+            } else {
+                override.project = svc.projectPath;
+            }
+            if (editingOverride) override.id = editingOverride.id;
+
+            try {
+                await actionFetch('/api/overrides', {
+                    method: editingOverride ? 'PUT' : 'POST',
+                    headers: { 'Content-Type': 'application/json' },
+                    body: JSON.stringify(override),
+                });
+                closeOverrideEditor();
+                loadServices();
+            } catch (error) {
+                showToast('Could not save: ' + error.message, 'error');
+            }
+        }
+
+        async function deleteOverride() {
+            if (!editingOverride) return;
+            try {
+                await actionFetch('/api/overrides', {
+                    method: 'DELETE',
+                    headers: { 'Content-Type': 'application/json' },
+                    body: JSON.stringify({ id: editingOverride.id }),
+                });
+                closeOverrideEditor();
+                loadServices();
+            } catch (error) {
+                showToast('Could not reset: ' + error.message, 'error');
+            }
+        }
+
+        // Icons are an image URL (from a rule, or the service's own favicon
+        // cached by the dashboard) or a short text such as an emoji
+        function serviceIcon(svc) {
+            if (!svc.icon) return '';
+            if (/^(https?:)?\//.test(svc.icon)) {
+                return ` + "`" + `<img class="service-icon" src="${escapeHtml(svc.icon)}" alt="" onerror="this.remove()">` + "`" + `;
+            }
+            return ` + "`" + `<span class="service-icon">${escapeHtml(svc.icon)}</span>` + "`" + `;
+        }
+
+        function exposureTag(svc) {
+            if (svc.exposure === 'loopback') {
+                return ` + "`" + `<span class="tag exposure-warning" title="Bound to ${escapeHtml((svc.bindAddresses || []).join(', '))} - only reachable from this machine or via the proxy">localhost only</span>` + "`" + `;
+            }
+            if (!svc.reachable && svc.exposure === 'interface') {
+                return ` + "`" + `<span class="tag exposure-warning" title="Bound to ${escapeHtml((svc.bindAddresses || []).join(', '))} - not the interface you are connected through">other interface</span>` + "`" + `;
+            }
+            return '';
+        }
+
+        // Live service changes pushed by the server on every discovery run
+        function subscribeServiceEvents() {
+            if (!window.EventSource) return;
+            const source = new EventSource('/api/events');
+            source.addEventListener('services', (e) => {
+                const event = JSON.parse(e.data);
+                (event.changes || []).forEach(showServiceChange);
+                loadServices();
+            });
+        }
+
+        function showServiceChange(change) {
+            const svc = change.service;
+            const label = 'Port ' + svc.port + (svc.protocol === 'udp' ? '/udp' : '') + ' (' + svc.name + ')';
+            let message;
+            if (change.type === 'appeared') {
+                message = label + ' came up';
+            } else if (change.type === 'disappeared') {
+                message = label + ' went down';
+            } else {
+                message = label + ' changed ' + (change.fields || []).join(', ');
+            }
+            showToast(message, change.type);
+        }
+
+        function showToast(message, type) {
+            const toast = document.createElement('div');
+            toast.className = 'toast ' + (type || '');
+            toast.textContent = message;
+            document.getElementById('toasts').appendChild(toast);
+            setTimeout(() => {
+                toast.classList.add('fading');
+                setTimeout(() => toast.remove(), 300);
+            }, 5000);
         }
 
         async function loadProjects() {
@@ -1337,7 +2381,7 @@ const indexHTML = `<!DOCTYPE html>
                 container.innerHTML = ` + "`" + `
                     <div class="empty-state">
                         <p>No projects found</p>
-                        <p style="font-size: 0.8rem; margin-top: 0.5rem;">Set the -projects flag to scan a directory</p>
+                        <p style="font-size: 0.8rem; margin-top: 0.5rem;">Add project roots in settings or set the -projects flag</p>
                     </div>
                 ` + "`" + `;
                 return;
@@ -1604,11 +2648,21 @@ const indexHTML = `<!DOCTYPE html>
             input.select();
         }
 
+        // Quotes a value as a JavaScript string for an inline event handler
+        // attribute such as onclick="fn(${jsArg(value)})"
+        function jsArg(value) {
+            return escapeHtml(JSON.stringify(value === null || value === undefined ? '' : String(value)));
+        }
+
+        // Escapes text for HTML content and quoted attribute values
         function escapeHtml(text) {
-            if (!text) return '';
-            const div = document.createElement('div');
-            div.textContent = text;
-            return div.innerHTML;
+            if (text === null || text === undefined) return '';
+            return String(text)
+                .replace(/&/g, '&amp;')
+                .replace(/</g, '&lt;')
+                .replace(/>/g, '&gt;')
+                .replace(/"/g, '&quot;')
+                .replace(/'/g, '&#39;');
         }
 
         // Section collapse toggle
@@ -2057,6 +3111,7 @@ const indexHTML = `<!DOCTYPE html>
             loadDailyTasks();
             loadUsage();
             initTerminal();
+            subscribeServiceEvents();
             // Set up refresh with configured interval
             setInterval(loadProjects, refreshInterval);
             setInterval(loadServices, refreshInterval);
@@ -2353,6 +3408,12 @@ const configHTML = `<!DOCTYPE html>
                 <textarea id="custom-head" placeholder="<link href='https://fonts.googleapis.com/...' rel='stylesheet'>"></textarea>
             </div>
 
+            <div class="form-group">
+                <label for="project-roots">Project Roots</label>
+                <p class="description">JSON list of directories searched for projects, each with an optional maxDepth and include/exclude globs</p>
+                <textarea id="project-roots" placeholder='[{"path": "~/code", "maxDepth": 4, "exclude": ["archive/**"]}]'></textarea>
+            </div>
+
             <div class="form-group">
                 <label>Section Order & Visibility</label>
                 <p class="description">Drag to reorder, toggle visibility with checkboxes</p>
@@ -2435,6 +3496,9 @@ const configHTML = `<!DOCTYPE html>
                 document.getElementById('refresh').value = config.refreshInterval;
                 document.getElementById('terminal-font').value = config.terminalFont || '';
                 document.getElementById('custom-head').value = config.customHeadHtml || '';
+                document.getElementById('project-roots').value = config.projectRoots && config.projectRoots.length
+                    ? JSON.stringify(config.projectRoots, null, 2)
+                    : '';
                 currentTheme = config.theme;
                 document.body.setAttribute('data-theme', config.theme);
 
@@ -2491,7 +3555,41 @@ const configHTML = `<!DOCTYPE html>
             });
         }
 
+        // Settings change what every page loads, so saving needs the action
+        // token (prompted for once, then kept in a cookie) like the dashboard's actions
+        async function actionFetch(url, options = {}) {
+            const send = () => fetch(url, { method: 'POST', ...options });
+            let response = await send();
+            if (response.status === 401) {
+                const message = (await response.text()).trim();
+                const token = prompt(message + '\n\nEnter the action token:');
+                if (!token) throw new Error('Action token required');
+                const login = await fetch('/api/action-token', {
+                    method: 'POST',
+                    headers: { 'Content-Type': 'application/json' },
+                    body: JSON.stringify({ token: token.trim() }),
+                });
+                if (!login.ok) throw new Error((await login.text()).trim() || login.statusText);
+                response = await send();
+            }
+            if (!response.ok) {
+                throw new Error((await response.text()).trim() || response.statusText);
+            }
+            return response;
+        }
+
         async function saveConfig() {
+            let projectRoots = [];
+            const rootsText = document.getElementById('project-roots').value.trim();
+            if (rootsText) {
+                try {
+                    projectRoots = JSON.parse(rootsText);
+                } catch (error) {
+                    alert('Project roots are not valid JSON: ' + error.message);
+                    return;
+                }
+            }
+
             const config = {
                 title: document.getElementById('title').value,
                 refreshInterval: parseInt(document.getElementById('refresh').value, 10),
@@ -2506,24 +3604,22 @@ const configHTML = `<!DOCTYPE html>
                     dailyTasks: document.getElementById('section-daily-tasks').checked,
                     terminal: document.getElementById('section-terminal').checked
                 },
-                sectionOrder: getSectionOrder()
+                sectionOrder: getSectionOrder(),
+                projectRoots: projectRoots
             };
 
             try {
-                const response = await fetch('/api/config', {
-                    method: 'POST',
+                await actionFetch('/api/config', {
                     headers: { 'Content-Type': 'application/json' },
                     body: JSON.stringify(config)
                 });
 
-                if (response.ok) {
-                    const status = document.getElementById('save-status');
-                    status.classList.add('show');
-                    setTimeout(() => status.classList.remove('show'), 2000);
-                }
+                const status = document.getElementById('save-status');
+                status.classList.add('show');
+                setTimeout(() => status.classList.remove('show'), 2000);
             } catch (error) {
                 console.error('Failed to save config:', error);
-                alert('Failed to save settings');
+                alert('Failed to save settings: ' + error.message);
             }
         }
 
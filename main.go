@@ -1,14 +1,18 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"dev-machine-proxy/internal/config"
 	"dev-machine-proxy/internal/discovery"
+	"dev-machine-proxy/internal/health"
+	"dev-machine-proxy/internal/projects"
 	"dev-machine-proxy/internal/system"
 	"dev-machine-proxy/internal/usage"
 	"dev-machine-proxy/internal/web"
@@ -16,13 +20,20 @@ import (
 
 func main() {
 	port := flag.Int("port", 9999, "Port to serve the dashboard on")
-	projectsDir := flag.String("projects", "", "Directory containing project folders to scan for port references")
+	projectsDir := flag.String("projects", "", "Extra project root to scan, in addition to the projectRoots in the config")
 	refreshInterval := flag.Duration("refresh", 30*time.Second, "How often to refresh service discovery")
+	proxyHosts := flag.String("proxy-hosts", "", "Comma-separated hosts the dashboard is reached at whose subdomains are proxied to services (default localhost and the machine's hostname)")
+	pathProxy := flag.Bool("path-proxy", false, "Also proxy services under /svc/<name>/ on the dashboard's own origin")
 	flag.Parse()
 
 	// Load configuration
 	configMgr := config.NewManager()
 	log.Printf("Config loaded from %s", configMgr.Get().Title)
+	if _, err := configMgr.ActionToken(); err != nil {
+		log.Printf("Warning: container actions disabled, no action token: %v", err)
+	} else {
+		log.Printf("Container actions require the token in %s", configMgr.ActionTokenPath())
+	}
 
 	// Start system monitor (collect stats every 2 seconds, keep 60 data points = 2 minutes)
 	sysMonitor := system.NewMonitor(60)
@@ -34,12 +45,27 @@ func main() {
 	usageMonitor.Start(5 * time.Minute)
 	log.Println("AI usage monitor started")
 
-	// Create the service discoverer
-	disc := discovery.New(*projectsDir)
+	// Project roots come from the config, plus -projects if given
+	projectRoots := func() []config.ProjectRoot {
+		roots := configMgr.Get().ProjectRoots
+		if *projectsDir != "" {
+			roots = append([]config.ProjectRoot{{Path: *projectsDir}}, roots...)
+		}
+		return roots
+	}
+
+	// Discovery and the Projects section share one cached walk of the roots
+	projectFinder := projects.NewFinder(projectRoots)
+
+	// Create the service discoverer and follow Docker container events
+	disc := discovery.New(projectFinder)
+	disc.WatchDocker(context.Background())
 
 	// Initial discovery
 	log.Println("Starting initial service discovery...")
-	services, err := disc.Discover()
+	ctx, cancel := context.WithTimeout(context.Background(), discovery.DefaultDiscoverTimeout)
+	services, err := disc.Discover(ctx)
+	cancel()
 	if err != nil {
 		log.Printf("Warning: initial discovery had errors: %v", err)
 	}
@@ -50,14 +76,28 @@ func main() {
 		ticker := time.NewTicker(*refreshInterval)
 		for range ticker.C {
 			log.Println("Refreshing service discovery...")
-			if _, err := disc.Discover(); err != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), discovery.DefaultDiscoverTimeout)
+			if _, err := disc.Discover(ctx); err != nil {
 				log.Printf("Warning: discovery refresh had errors: %v", err)
 			}
+			cancel()
 		}
 	}()
 
+	// Run health checks on their own schedule
+	healthMonitor := health.NewMonitor(disc.ServiceByID)
+	healthMonitor.Start(context.Background())
+	log.Println("Health monitor started")
+
 	// Set up web server
-	handler := web.NewHandler(disc, configMgr, sysMonitor, usageMonitor, *projectsDir)
+	handler := web.NewHandler(disc, configMgr, sysMonitor, usageMonitor, healthMonitor, projectFinder)
+	if *proxyHosts != "" {
+		handler.SetProxyHosts(strings.Split(*proxyHosts, ","))
+	}
+	if *pathProxy {
+		handler.EnablePathProxy()
+		log.Println("Path-based proxying enabled under /svc/; proxied apps can use the dashboard API")
+	}
 
 	addr := fmt.Sprintf(":%d", *port)
 	log.Printf("Starting dashboard on http://localhost%s", addr)